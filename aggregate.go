@@ -0,0 +1,126 @@
+package docdb_poc
+
+import (
+	"context"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	db "docdb_poc/db"
+)
+
+func (c *client) Aggregate(ctx context.Context, collection string, p *db.Pipeline, opts ...db.Option) ([]bson.M, error) {
+	stages, err := p.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	stages, err = c.preparePipeline(ctx, collection, p, stages)
+	if err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Debugf("Aggregating documents of %s with %v", collection, c.settings().Shape(stages))
+
+	cur, err := coll.Aggregate(ctx, stages)
+	if err != nil {
+		return nil, asDomainError(err, collection, "unable to aggregate documents")
+	}
+
+	var found []bson.M
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, wraperrors.Wrap(err, "unable to read documents")
+	}
+
+	for i, doc := range found {
+		// the fields are restricted before the first stage, so computed fields are kept
+		if found[i], err = c.readResult(collection, nil, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+// preparePipeline authorizes reading the collection and the collections joined by the Pipeline. The documents
+// are restricted to those granted to the caller, and to their granted fields, before the first stage. The values
+// of the leading $match stages compared to encrypted fields are encrypted.
+//
+// Stages writing their output to a collection are rejected as the pipeline only runs with read access.
+func (c *client) preparePipeline(ctx context.Context, collection string, p *db.Pipeline, stages mongo.Pipeline) (mongo.Pipeline, error) {
+	for _, stage := range stages {
+		if op := stage[0].Key; op == "$out" || op == "$merge" {
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "stage "+op, "a stage that does not write to a collection")
+		}
+	}
+
+	grant, err := c.authorize(ctx, collection, db.OpRead)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, joined := range p.Collections() {
+		g, err := c.authorize(ctx, joined, db.OpRead)
+		if err != nil {
+			return nil, err
+		}
+
+		// the restrictions of a grant cannot be applied to the documents joined by a stage
+		if g != nil && (len(g.Fields) > 0 || len(g.Filter) > 0) {
+			logrus.Warnf("Denied joining %s within an aggregation of %s as access to it is restricted", joined, collection)
+
+			return nil, db.ErrUnauthorized
+		}
+	}
+
+	prepared := make(mongo.Pipeline, 0, len(stages)+2)
+
+	if grant != nil && len(grant.Filter) > 0 {
+		filter, err := c.encryptFilter(collection, grant.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		prepared = append(prepared, bson.D{{Key: "$match", Value: filter}})
+	}
+
+	// fields that are not granted can not be referenced by any stage, including a $match
+	if grant != nil && len(grant.Fields) > 0 {
+		fields := bson.D{}
+		for _, f := range grant.Fields {
+			fields = append(fields, bson.E{Key: f, Value: 1})
+		}
+
+		prepared = append(prepared, bson.D{{Key: "$project", Value: fields}})
+	}
+
+	for ; len(stages) > 0 && stages[0][0].Key == "$match"; stages = stages[1:] {
+		stage := stages[0]
+
+		if filter, ok := stage[0].Value.(bson.M); ok {
+			if filter, err = c.encryptFilter(collection, filter); err != nil {
+				return nil, err
+			}
+
+			stage = bson.D{{Key: "$match", Value: filter}}
+		}
+
+		prepared = append(prepared, stage)
+	}
+
+	return append(prepared, stages...), nil
+}
@@ -0,0 +1,84 @@
+package docdb_poc
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/utils/ctxutil"
+
+	db "docdb_poc/db"
+	"docdb_poc/internal/mongo/config"
+)
+
+// configuredPolicy loads the configured Policy; nil when no policy is configured and every caller is authorized.
+func configuredPolicy() (*db.Policy, error) {
+	name := config.GetString(config.MongoDBPolicy)
+	if name == "" {
+		return nil, nil
+	}
+
+	return db.LoadPolicy(name)
+}
+
+// authorize checks that the caller of the context may perform the operation on the collection; the returned
+// Grant restricts the fields and documents the operation may access.
+func (c *client) authorize(ctx context.Context, collection string, op db.Operation) (*db.Grant, error) {
+	p := c.policy.Load()
+	if p == nil {
+		return nil, nil
+	}
+
+	g, err := p.Authorize(ctx, collection, op)
+	if err != nil {
+		logrus.Warnf("Denied %s of %s to principal %q and client %q", op, collection, ctxutil.Principal(ctx), ctxutil.ClientID(ctx))
+
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// authorizeRebuild checks that the caller of the context may rewrite the derived data of every document of the
+// collection from the fields: a rebuild reads and updates all documents, so a Grant restricted to some
+// documents or not allowing one of the fields is denied.
+func (c *client) authorizeRebuild(ctx context.Context, collection string, fields ...string) error {
+	for _, op := range []db.Operation{db.OpRead, db.OpUpdate} {
+		g, err := c.authorize(ctx, collection, op)
+		if err != nil {
+			return err
+		}
+
+		if g == nil {
+			continue
+		}
+
+		if len(g.Filter) > 0 {
+			logrus.Warnf("Denied rebuild of %s to principal %q and client %q restricted to some documents", collection, ctxutil.Principal(ctx), ctxutil.ClientID(ctx))
+
+			return db.ErrUnauthorized
+		}
+
+		if err := g.CheckFields(fields...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// authorizeSchema checks that the caller of the context may change the validator and indexes of the collection,
+// which apply to every field of every document; a Grant restricted to some fields or documents is denied.
+func (c *client) authorizeSchema(ctx context.Context, collection string) error {
+	g, err := c.authorize(ctx, collection, db.OpUpdate)
+	if err != nil {
+		return err
+	}
+
+	if g != nil && (len(g.Fields) > 0 || len(g.Filter) > 0) {
+		logrus.Warnf("Denied schema of %s to principal %q and client %q restricted to some fields or documents", collection, ctxutil.Principal(ctx), ctxutil.ClientID(ctx))
+
+		return db.ErrUnauthorized
+	}
+
+	return nil
+}
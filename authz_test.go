@@ -0,0 +1,69 @@
+package docdb_poc
+
+import (
+	"context"
+	"testing"
+
+	"gitscm.cisco.com/mcmp/utils/ctxutil"
+
+	db "docdb_poc/db"
+)
+
+func TestAuthorizeRebuild(t *testing.T) {
+	c := new(client)
+	c.policy.Store(&db.Policy{Rules: []db.Rule{
+		{Principals: []string{"admin"}, Collections: []string{"articles"}, Operations: []db.Operation{"*"}},
+		{Principals: []string{"editor"}, Collections: []string{"articles"}, Operations: []db.Operation{db.OpRead, db.OpUpdate}, Fields: []string{"title", "body"}},
+		{Principals: []string{"reader"}, Collections: []string{"articles"}, Operations: []db.Operation{db.OpRead}},
+		{Principals: []string{"owner"}, Collections: []string{"articles"}, Operations: []db.Operation{"*"}, Filter: map[string]interface{}{"owner": "${principal}"}},
+	}})
+
+	for _, tc := range []struct {
+		name      string
+		principal string
+		fields    []string
+		ok        bool
+	}{
+		{"every document", "admin", []string{"title", "body"}, true},
+		{"granted fields", "editor", []string{"title", "body"}, true},
+		{"other fields", "editor", []string{"title", "summary"}, false},
+		{"read only", "reader", []string{"title"}, false},
+		{"some documents", "owner", []string{"title"}, false},
+		{"no rule", "other", []string{"title"}, false},
+	} {
+		err := c.authorizeRebuild(ctxutil.WithPrincipal(context.Background(), tc.principal), "articles", tc.fields...)
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("%s: authorizeRebuild() = %v, want authorized %t", tc.name, err, tc.ok)
+		}
+	}
+
+	if err := new(client).authorizeRebuild(context.Background(), "articles", "title"); err != nil {
+		t.Errorf("authorizeRebuild() without a policy = %v, want nil", err)
+	}
+}
+
+func TestAuthorizeSchema(t *testing.T) {
+	c := new(client)
+	c.policy.Store(&db.Policy{Rules: []db.Rule{
+		{Principals: []string{"admin"}, Collections: []string{"articles"}, Operations: []db.Operation{"*"}},
+		{Principals: []string{"editor"}, Collections: []string{"articles"}, Operations: []db.Operation{db.OpUpdate}, Fields: []string{"title"}},
+		{Principals: []string{"owner"}, Collections: []string{"articles"}, Operations: []db.Operation{db.OpUpdate}, Filter: map[string]interface{}{"owner": "${principal}"}},
+		{Principals: []string{"reader"}, Collections: []string{"articles"}, Operations: []db.Operation{db.OpRead}},
+	}})
+
+	for _, tc := range []struct {
+		name      string
+		principal string
+		ok        bool
+	}{
+		{"every field and document", "admin", true},
+		{"some fields", "editor", false},
+		{"some documents", "owner", false},
+		{"read only", "reader", false},
+	} {
+		err := c.authorizeSchema(ctxutil.WithPrincipal(context.Background(), tc.principal), "articles")
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("%s: authorizeSchema() = %v, want authorized %t", tc.name, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Command dbconfig prints the effective MongoDB configurations, resolved from the defaults, the configuration
+// file and the environment, along with the source of each value. Passwords are masked.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+func main() {
+	future := flag.Bool("future", false, "resolve using the future configurations")
+	file := flag.String("file", "", "path to the MongoDB configuration file")
+	asJSON := flag.Bool("json", false, "print the configurations as JSON")
+	flag.Parse()
+
+	if *future {
+		config.Future()
+	}
+
+	if *file != "" {
+		config.Set(config.MongoDBConfigFile, *file)
+	}
+
+	if err := config.LoadMongoConfigs(); err != nil {
+		logrus.Warnf("Unable to load MongoDB configurations from %q: %v", config.GetString(config.MongoDBConfigFile), err)
+	}
+
+	settings := config.Effective()
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(settings); err != nil {
+			logrus.Fatalf("Unable to print configurations: %v", err)
+		}
+
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+
+	for _, st := range settings {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", st.Key, st.Value, st.Source)
+	}
+
+	_ = w.Flush()
+}
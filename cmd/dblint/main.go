@@ -0,0 +1,173 @@
+// Command dblint scans a recorded log of MongoDB commands and reports the features used by the commands that are
+// not supported by Amazon DocumentDB. Each line of the log is a JSON object holding either a command, a command
+// logged by the mongo package with MONGO_DB_LOG_COMMANDS enabled, a mongod log entry or a profiler entry. Lines
+// that are not JSON are skipped. The log is read from the files given as arguments or from the standard input.
+// The exit status is 1 when an incompatibility is found.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// maxLine bounds the length of a line of the log.
+const maxLine = 16 << 20
+
+// finding is an incompatibility found within a command of the log.
+type finding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Command    string `json:"command"`
+	Collection string `json:"collection,omitempty"`
+	dbutil.Incompatibility
+}
+
+// scan counts the commands read from the logs along with the commands using unsupported features.
+type scan struct {
+	commands     int
+	incompatible int
+	findings     []finding
+}
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the incompatibilities as JSON")
+	flag.Parse()
+
+	s := &scan{}
+
+	if flag.NArg() == 0 {
+		if err := s.read("-", os.Stdin); err != nil {
+			logrus.Fatalf("Unable to read the standard input: %v", err)
+		}
+	}
+
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			logrus.Fatalf("Unable to open %q: %v", name, err)
+		}
+
+		err = s.read(name, f)
+		_ = f.Close()
+
+		if err != nil {
+			logrus.Fatalf("Unable to read %q: %v", name, err)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(s.findings); err != nil {
+			logrus.Fatalf("Unable to print incompatibilities: %v", err)
+		}
+	} else if len(s.findings) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "FILE\tLINE\tCOMMAND\tCOLLECTION\tPATH\tFEATURE")
+
+		for _, f := range s.findings {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", f.File, f.Line, f.Command, f.Collection, f.Path, f.Feature)
+		}
+
+		_ = w.Flush()
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "%d of %d commands use features not supported by DocumentDB\n", s.incompatible, s.commands)
+
+	if s.incompatible > 0 {
+		os.Exit(1)
+	}
+}
+
+func (s *scan) read(name string, r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLine)
+
+	for line := 1; sc.Scan(); line++ {
+		var entry bson.D
+		if err := bson.UnmarshalExtJSON(sc.Bytes(), false, &entry); err != nil {
+			continue
+		}
+
+		cmd := command(entry)
+		if len(cmd) == 0 {
+			continue
+		}
+
+		s.commands++
+
+		found := dbutil.LintCommand(cmd)
+		if len(found) == 0 {
+			continue
+		}
+
+		s.incompatible++
+
+		coll, _ := cmd[0].Value.(string)
+
+		for _, i := range found {
+			s.findings = append(s.findings, finding{
+				File:            name,
+				Line:            line,
+				Command:         cmd[0].Key,
+				Collection:      coll,
+				Incompatibility: i,
+			})
+		}
+	}
+
+	return sc.Err()
+}
+
+// command extracts the command from an entry of the log.
+func command(entry bson.D) bson.D {
+	// commands logged by the mongo package
+	if shape, ok := lookup(entry, "mongodb.command.shape").(string); ok {
+		var cmd bson.D
+		if err := bson.UnmarshalExtJSON([]byte(shape), false, &cmd); err != nil {
+			return nil
+		}
+
+		return cmd
+	}
+
+	// mongod log entries
+	if attr, ok := lookup(entry, "attr").(bson.D); ok {
+		cmd, _ := lookup(attr, "command").(bson.D)
+
+		return cmd
+	}
+
+	// other log entries
+	if lookup(entry, "msg") != nil {
+		return nil
+	}
+
+	// profiler entries
+	if cmd, ok := lookup(entry, "command").(bson.D); ok {
+		return cmd
+	}
+
+	return entry
+}
+
+func lookup(d bson.D, key string) interface{} {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+
+	return nil
+}
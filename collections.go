@@ -0,0 +1,327 @@
+package docdb_poc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+)
+
+func (c *client) Insert(ctx context.Context, collection string, doc bson.M, opts ...db.Option) (interface{}, error) {
+	doc, _, err := c.prepareWrite(ctx, collection, db.OpInsert, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := coll.InsertOne(ctx, doc)
+	if err != nil {
+		return nil, asDomainError(err, collection, "unable to insert document")
+	}
+
+	logrus.Debugf("Inserted document into %s with ID:%v", collection, c.settings().Shape(res.InsertedID))
+
+	c.index(ctx, dbc, collection, res.InsertedID, doc, opts)
+
+	return res.InsertedID, nil
+}
+
+func (c *client) Get(ctx context.Context, collection string, id interface{}, opts ...db.Option) (bson.M, error) {
+	filter, grant, err := c.prepareRead(ctx, collection, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	if err := coll.FindOne(ctx, filter).Decode(&doc); err != nil {
+		return nil, asDomainError(err, collection, "unable to get document")
+	}
+
+	return c.readResult(collection, grant, doc)
+}
+
+func (c *client) List(ctx context.Context, collection string, q *search.Query, opts ...db.Option) ([]bson.M, error) {
+	if err := db.CheckGeoFilters(collection, q); err != nil {
+		return nil, err
+	}
+
+	if keywords, ok := db.TextFilter(q); ok {
+		return c.search(ctx, collection, keywords, q, opts)
+	}
+
+	return c.find(ctx, collection, db.Filters(collection, q), q, opts)
+}
+
+func (c *client) Replace(ctx context.Context, collection string, id interface{}, doc bson.M, opts ...db.Option) error {
+	doc, grant, err := c.prepareWrite(ctx, collection, db.OpUpdate, doc)
+	if err != nil {
+		return err
+	}
+
+	filter, err := c.encryptFilter(collection, grant.Restrict(bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return err
+	}
+
+	res, err := coll.ReplaceOne(ctx, filter, doc)
+	if err != nil {
+		return asDomainError(err, collection, "unable to replace document")
+	}
+
+	if res.MatchedCount == 0 {
+		return notFound(collection, id)
+	}
+
+	c.index(ctx, dbc, collection, id, doc, opts)
+
+	return nil
+}
+
+func (c *client) Delete(ctx context.Context, collection string, id interface{}, opts ...db.Option) error {
+	grant, err := c.authorize(ctx, collection, db.OpDelete)
+	if err != nil {
+		return err
+	}
+
+	filter, err := c.encryptFilter(collection, grant.Restrict(bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return err
+	}
+
+	res, err := coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return asDomainError(err, collection, "unable to delete document")
+	}
+
+	if res.DeletedCount == 0 {
+		return notFound(collection, id)
+	}
+
+	c.index(ctx, dbc, collection, id, nil, opts)
+
+	return nil
+}
+
+// find provides the documents of the collection matching the filter; the query, when provided, selects the
+// fields, order and page of the documents and receives the total count when the results are sorted.
+func (c *client) find(ctx context.Context, collection string, filter bson.M, q *search.Query, opts []db.Option) ([]bson.M, error) {
+	filter, grant, err := c.prepareRead(ctx, collection, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	findOpts := options.Find()
+
+	if q != nil {
+		findOpts = dbutil.FindOptions(q)
+
+		// execute the query to get total count if the results are sorted
+		if !q.EmptySortby() {
+			if q.Count, err = countDocuments(ctx, coll, filter); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cur, err := coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, asDomainError(err, collection, "unable to find documents")
+	}
+
+	var found []bson.M
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, wraperrors.Wrap(err, "unable to read documents")
+	}
+
+	for i, doc := range found {
+		if found[i], err = c.readResult(collection, grant, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+// prepareWrite authorizes the operation on the collection and provides the document, validated, with its shadow
+// fields set and with its fields encrypted, to be written.
+func (c *client) prepareWrite(ctx context.Context, collection string, op db.Operation, doc bson.M) (bson.M, *db.Grant, error) {
+	grant, err := c.authorize(ctx, collection, op)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := grant.Check(doc); err != nil {
+		return nil, nil, err
+	}
+
+	if err := db.Validate(collection, doc); err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.checkShadows(collection); err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.checkSearchIndex(collection); err != nil {
+		return nil, nil, err
+	}
+
+	if doc, err = db.Normalize(collection, doc); err != nil {
+		return nil, nil, err
+	}
+
+	if enc := c.enc.Load(); enc != nil {
+		if doc, err = enc.Encrypt(collection, doc); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return doc, grant, nil
+}
+
+// prepareRead authorizes reading the collection and provides the filter restricted to the documents granted
+// to the caller, checked against the features supported by DocumentDB, with the values compared to encrypted
+// fields encrypted.
+func (c *client) prepareRead(ctx context.Context, collection string, filter bson.M) (bson.M, *db.Grant, error) {
+	grant, err := c.authorize(ctx, collection, db.OpRead)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter = grant.Restrict(filter)
+
+	logrus.Debugf("Finding documents of %s matching %v", collection, c.settings().Shape(filter))
+
+	if err := dbutil.Compat(ctx, c.settings().Compat, collection, dbutil.LintFilter(filter)); err != nil {
+		return nil, nil, err
+	}
+
+	if filter, err = c.encryptFilter(collection, filter); err != nil {
+		return nil, nil, err
+	}
+
+	return filter, grant, nil
+}
+
+// checkShadows verifies that the fields of the collection with a shadow field are not encrypted, as their
+// shadow fields would hold their values in plain text.
+func (c *client) checkShadows(collection string) error {
+	enc := c.enc.Load()
+	if enc == nil {
+		return nil
+	}
+
+	for field := range enc.Fields(collection) {
+		for _, f := range db.ShadowFields(collection) {
+			if f.Path == field || strings.HasPrefix(f.Path, field+".") || strings.HasPrefix(field, f.Path+".") {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, "shadow field "+f.Path, "a field that is not encrypted")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *client) encryptFilter(collection string, filter bson.M) (bson.M, error) {
+	if enc := c.enc.Load(); enc != nil {
+		return enc.Filter(collection, filter)
+	}
+
+	return filter, nil
+}
+
+// readResult decrypts the document read from the collection and removes its shadow fields and the fields not
+// granted to the caller.
+func (c *client) readResult(collection string, grant *db.Grant, doc bson.M) (bson.M, error) {
+	if enc := c.enc.Load(); enc != nil {
+		var err error
+
+		if doc, err = enc.Decrypt(collection, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return grant.Project(db.RemoveShadows(doc)), nil
+}
+
+// asDomainError maps the errors of the driver to domain errors.
+func asDomainError(err error, collection, msg string) error {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return errors.NewDomainError(errors.ErrNotFound, errors.Default, "document of "+collection)
+	case mongo.IsDuplicateKeyError(err):
+		return errors.NewDomainError(errors.ErrExists, errors.Default, "document of "+collection)
+	case mongo.IsTimeout(err) || mongo.IsNetworkError(err):
+		return errUnavailable
+	}
+
+	return wraperrors.Wrap(err, msg)
+}
+
+func notFound(collection string, id interface{}) error {
+	return errors.NewDomainError(errors.ErrNotFound, errors.Default, fmt.Sprintf("document %v of %s", id, collection))
+}
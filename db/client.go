@@ -3,11 +3,95 @@ package db
 import (
 	"context"
 	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/utils/search"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 type Datastore interface {
-	SaveData(ctx context.Context, object bson.M) error
+	// SaveData inserts the object; the options select the write concern.
+	SaveData(ctx context.Context, object bson.M, opts ...Option) error
+
+	// FindData provides the objects matching the filter; the options select the read preference and read concern.
+	FindData(ctx context.Context, filter bson.M, opts ...Option) ([]bson.M, error)
+
+	// Insert inserts the document into the collection, providing the id of the document.
+	Insert(ctx context.Context, collection string, doc bson.M, opts ...Option) (interface{}, error)
+
+	// Get provides the document of the collection with the id; ErrNotFound when it does not exist.
+	Get(ctx context.Context, collection string, id interface{}, opts ...Option) (bson.M, error)
+
+	// List provides the documents of the collection matching the query; the Count of the query is set when
+	// the results are sorted. IgnoreCase and Like filters on fields with a shadow field match the shadow field.
+	// A Text filter matches the documents holding its keywords within the search index of the collection,
+	// ranked by relevance; the Count is always set and the offset applies regardless of the order. Geo filters
+	// apply to the fields registered with RegisterGeoFields; the documents are nearest first for a Near filter
+	// unless sorted.
+	List(ctx context.Context, collection string, q *search.Query, opts ...Option) ([]bson.M, error)
+
+	// Replace replaces the document of the collection with the id; ErrNotFound when it does not exist.
+	Replace(ctx context.Context, collection string, id interface{}, doc bson.M, opts ...Option) error
+
+	// Patch atomically applies a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) to the document of the
+	// collection with the id; ErrNotFound when it does not exist and ErrPreconditionNotMet when a test
+	// operation fails, a path removed or replaced does not exist or the document is modified concurrently.
+	Patch(ctx context.Context, collection string, id interface{}, patch []byte, opts ...Option) error
+
+	// Aggregate provides the results of the aggregation Pipeline over the documents of the collection.
+	Aggregate(ctx context.Context, collection string, p *Pipeline, opts ...Option) ([]bson.M, error)
+
+	// Update atomically applies the Update to the document of the collection with the id; ErrNotFound when it
+	// does not exist, unless inserted by WithUpsert, and ErrPreconditionNotMet when the document does not
+	// satisfy the Conditions of the Update.
+	Update(ctx context.Context, collection string, id interface{}, u *Update, opts ...Option) error
+
+	// FindOneAndUpdate atomically applies the Update to a document of the collection matching the filter and
+	// provides the document before the update, or after the update WithReturnDocument(ReturnAfter). When
+	// upserting, nil is returned before the update of an inserted document.
+	FindOneAndUpdate(ctx context.Context, collection string, filter bson.M, u *Update, opts ...Option) (bson.M, error)
+
+	// FindOneAndDelete atomically deletes a document of the collection matching the filter and provides it;
+	// ErrNotFound when no document matches.
+	FindOneAndDelete(ctx context.Context, collection string, filter bson.M, opts ...Option) (bson.M, error)
+
+	// Delete deletes the document of the collection with the id; ErrNotFound when it does not exist.
+	Delete(ctx context.Context, collection string, id interface{}, opts ...Option) error
+
+	// CausalSession starts a causally-consistent session used by the operations provided the returned context,
+	// allowing a request to read its own writes from a secondary. The returned func ends the session.
+	CausalSession(ctx context.Context) (context.Context, func(), error)
+
+	// ApplySchemas applies the schemas registered with ServerSide as validators of their collections, where
+	// supported by the server; documents are validated by the client regardless. The indexes of the registered
+	// shadow fields, search indexes, geo fields and vector fields are created, where supported by the server.
+	ApplySchemas(ctx context.Context) error
+
+	// KNN finds the documents of the collection nearest to the vector of the VectorQuery, nearest first. The
+	// vector index of the field is used where supported by the server, unless the documents are filtered; the
+	// documents matching the filters are scanned otherwise. Nearest evaluates a VectorQuery in process.
+	// ErrUnauthorized when the vector field is not granted to the caller.
+	KNN(ctx context.Context, collection string, vq *VectorQuery, opts ...Option) ([]Neighbor, error)
+
+	// RebuildSearchIndex replaces the postings of the search index of the collection with those of every
+	// document, indexing the documents written before the search index was registered.
+	RebuildSearchIndex(ctx context.Context, collection string) error
+
+	// RebuildShadowFields sets the shadow fields of every document of the collection from their fields. It is
+	// required after registering shadow fields for a collection holding documents, or changing them, as the
+	// documents written before lack them and IgnoreCase and Like filters on their fields would not match them.
+	RebuildShadowFields(ctx context.Context, collection string) error
+
+	// HealthCheck reports the Health of the Datastore; an error is returned along with the
+	// Health when the cluster cannot be reached.
+	HealthCheck(ctx context.Context) (*Health, error)
+
+	// Close waits for in-flight operations to complete, or the context to expire, and then disconnects
+	// from the cluster. All further operations fail with an ErrUnavailable domain error.
+	Close(ctx context.Context) error
+
+	// Switchover opens a connection using the future configurations, validates it and then moves traffic
+	// to it as described by the plan, rolling back to the current configurations when validation fails or
+	// the error rate spikes. Blocks until the switchover completes or is rolled back.
+	Switchover(ctx context.Context, plan SwitchoverPlan) error
 }
 
 // DatastoreFactory is a type for data store factory methods.
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// Operators of the search filters resolved by the Datastore in addition to those of the search package. Their
+// values are well apart from those of the search package so that operators it adds do not collide with them.
+const (
+	// Text matches the documents holding the keywords of the value, ranked by relevance; see TextKey.
+	Text search.Operator = 100 + iota
+	// Near matches the documents whose location is within the MaxDistance of a Nearby value, or of a Point, nearest
+	// first.
+	Near
+	// Within matches the documents whose location is within a Polygon, Box or CenterSphere value.
+	Within
+	// Intersects matches the documents whose location intersects a Point, Polygon or Box value.
+	Intersects
+)
+
+// TextKey is the key of the Text filter of a search; the keywords are searched for within every field of the
+// search index of the collection.
+const TextKey = "$text"
+
+// isText determines if the operator of the filter is Text.
+func isText(f search.Filter) bool {
+	return f.Op == Text
+}
+
+// isGeo determines if the operator of the filter is Near, Within or Intersects.
+func isGeo(f search.Filter) bool {
+	return f.Op == Near || f.Op == Within || f.Op == Intersects
+}
+
+// queryFilters translates the filters of the search Query like dbutil.Filters, resolving the operators of the
+// Datastore: Text filters are left to the search index and geo filters are translated by asGeoComparison.
+func queryFilters(q *search.Query) bson.M {
+	qf := dbutil.Filters(q)
+
+	for k, f := range q.Filters() {
+		switch {
+		case isText(f):
+			delete(qf, k)
+		case isGeo(f):
+			delete(qf, k)
+
+			key, cond := asGeoComparison(k, f)
+			qf[key] = cond
+		}
+	}
+
+	return qf
+}
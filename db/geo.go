@@ -0,0 +1,389 @@
+package db
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// Point is a GeoJSON point: a position of longitude and latitude, in degrees.
+type Point struct {
+	Longitude float64
+	Latitude  float64
+}
+
+// Polygon is a GeoJSON polygon: an exterior ring followed by the rings of its holes. Rings which are not closed,
+// their last position differing from their first, are closed when the filter is translated.
+type Polygon [][]Point
+
+// NewPolygon creates a Polygon without holes whose exterior ring passes through the points.
+func NewPolygon(points ...Point) Polygon {
+	return Polygon{points}
+}
+
+// Box is the rectangle between its south west and north east corners.
+type Box struct {
+	SouthWest Point
+	NorthEast Point
+}
+
+// Polygon provides the Box as a Polygon through its corners.
+func (b Box) Polygon() Polygon {
+	return NewPolygon(
+		b.SouthWest,
+		Point{Longitude: b.NorthEast.Longitude, Latitude: b.SouthWest.Latitude},
+		b.NorthEast,
+		Point{Longitude: b.SouthWest.Longitude, Latitude: b.NorthEast.Latitude},
+		b.SouthWest,
+	)
+}
+
+// CenterSphere is the area of the surface of the earth within the Radius, in meters, of the Center.
+type CenterSphere struct {
+	Center Point
+	Radius float64
+}
+
+// Nearby is the value of a Near filter: the locations nearest to the Point, within the MaxDistance in meters
+// when it is positive.
+type Nearby struct {
+	Point       Point
+	MaxDistance float64
+}
+
+var (
+	geoMu     sync.RWMutex
+	geoFields = make(map[string][]string)
+)
+
+// RegisterGeoFields declares the fields of the collection holding GeoJSON locations, which geo filters apply to.
+// Each field is indexed by a 2dsphere index; Amazon DocumentDB only indexes GeoJSON points.
+func RegisterGeoFields(collection string, paths ...string) error {
+	for _, path := range paths {
+		parent := ""
+
+		for _, name := range strings.Split(path, ".") {
+			if err := checkName(parent, name); err != nil {
+				return err
+			}
+
+			parent = join(parent, name)
+		}
+	}
+
+	geoMu.Lock()
+	defer geoMu.Unlock()
+
+	fields := append([]string(nil), geoFields[collection]...)
+
+	for _, path := range paths {
+		if !isGeoField(fields, path) {
+			fields = append(fields, path)
+		}
+	}
+
+	sort.Strings(fields)
+
+	geoFields[collection] = fields
+
+	return nil
+}
+
+// GeoFields provides the paths of the geo fields of the collection.
+func GeoFields(collection string) []string {
+	geoMu.RLock()
+	defer geoMu.RUnlock()
+
+	return append([]string(nil), geoFields[collection]...)
+}
+
+// GeoIndexes provides the 2dsphere indexes of the geo fields of each collection.
+func GeoIndexes() map[string][]mongo.IndexModel {
+	geoMu.RLock()
+	defer geoMu.RUnlock()
+
+	indexes := make(map[string][]mongo.IndexModel)
+
+	for coll, paths := range geoFields {
+		for _, path := range paths {
+			indexes[coll] = append(indexes[coll], mongo.IndexModel{Keys: bson.D{{Key: path, Value: "2dsphere"}}})
+		}
+	}
+
+	return indexes
+}
+
+// CheckGeoFilters verifies that the geo filters of the search Query apply to geo fields of the collection with
+// a value the operator accepts: a Nearby or Point for Near, a Polygon, Box or CenterSphere for Within and a Point,
+// Polygon or Box for Intersects. A query holds no more than one Near filter or Within filter of a CenterSphere,
+// as either is found by $nearSphere on Amazon DocumentDB.
+func CheckGeoFilters(collection string, q *search.Query) error {
+	if q == nil {
+		return nil
+	}
+
+	fields := GeoFields(collection)
+	nearest := 0
+
+	for k, f := range q.Filters() {
+		if !isGeo(f) {
+			continue
+		}
+
+		if !isGeoField(fields, k) {
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, "geo filter of "+k, "a geo field of "+collection)
+		}
+
+		switch f.Value.(type) {
+		case Nearby:
+			if f.Op != Near {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, "nearby value of "+k, "a near filter")
+			}
+
+			nearest++
+		case Point:
+			if f.Op == Within {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, "point value of "+k, "a near or intersects filter")
+			}
+
+			if f.Op == Near {
+				nearest++
+			}
+		case Polygon, Box:
+			if f.Op == Near {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, "area value of "+k, "a within or intersects filter")
+			}
+		case CenterSphere:
+			if f.Op != Within {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, "center sphere value of "+k, "a within filter")
+			}
+
+			nearest++
+		default:
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, "geo filter of "+k, "a point, polygon, box, center sphere or nearby value")
+		}
+	}
+
+	if nearest > 1 {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, "geo filters", "a single near or center sphere filter")
+	}
+
+	return nil
+}
+
+func isGeoField(fields []string, path string) bool {
+	for _, f := range fields {
+		if f == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GeoJSON provides the GeoJSON object of a Point, Polygon or Box; false for other values.
+func GeoJSON(v interface{}) (bson.D, bool) {
+	switch val := v.(type) {
+	case Point:
+		return bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: position(val)}}, true
+	case Polygon:
+		rings := make(bson.A, 0, len(val))
+		for _, r := range val {
+			rings = append(rings, ring(r))
+		}
+
+		return bson.D{{Key: "type", Value: "Polygon"}, {Key: "coordinates", Value: rings}}, true
+	case Box:
+		return GeoJSON(val.Polygon())
+	}
+
+	return nil, false
+}
+
+// asGeoComparison translates the geo filter into the key and condition of the filter document. Only the operators
+// supported by Amazon DocumentDB are used unless the compatibility checks are off:
+//   - a CenterSphere is found by $nearSphere, within its radius of its center, rather than by $centerSphere, so
+//     the documents are ordered by distance and the field requires a 2dsphere index;
+//   - a Point is intersected by the documents at the same coordinates rather than by $geoIntersects.
+//
+// A Box is always translated into a Polygon, so its edges are geodesics rather than lines of latitude.
+func asGeoComparison(key string, f search.Filter) (string, interface{}) {
+	native := dbutil.ConfiguredCompat() == dbutil.CompatOff
+
+	switch val := f.Value.(type) {
+	case Nearby:
+		if f.Op == Near {
+			return key, nearSphere(val.Point, val.MaxDistance)
+		}
+	case Point:
+		switch {
+		case f.Op == Near:
+			return key, nearSphere(val, 0)
+		case f.Op == Intersects && !native:
+			return key + ".coordinates", position(val)
+		case f.Op == Intersects:
+			geometry, _ := GeoJSON(val)
+
+			return key, bson.M{"$geoIntersects": bson.M{"$geometry": geometry}}
+		}
+	case Polygon, Box:
+		geometry, _ := GeoJSON(val)
+
+		switch f.Op {
+		case Within:
+			return key, bson.M{"$geoWithin": bson.M{"$geometry": geometry}}
+		case Intersects:
+			return key, bson.M{"$geoIntersects": bson.M{"$geometry": geometry}}
+		}
+	case CenterSphere:
+		switch {
+		case f.Op == Within && native:
+			return key, bson.M{"$geoWithin": bson.M{"$centerSphere": bson.A{position(val.Center), val.Radius / dbutil.EarthRadius}}}
+		case f.Op == Within:
+			return key, nearSphere(val.Center, val.Radius)
+		}
+	}
+
+	// values the operator does not apply to are compared as they are, matching no location
+	return key, bson.M{"$eq": f.Value}
+}
+
+func nearSphere(p Point, maxDistance float64) bson.M {
+	geometry, _ := GeoJSON(p)
+
+	near := bson.M{"$geometry": geometry}
+	if maxDistance > 0 {
+		near["$maxDistance"] = maxDistance
+	}
+
+	return bson.M{"$nearSphere": near}
+}
+
+func position(p Point) bson.A {
+	return bson.A{p.Longitude, p.Latitude}
+}
+
+// ring provides the positions of the ring, closed.
+func ring(points []Point) bson.A {
+	positions := make(bson.A, 0, len(points)+1)
+	for _, p := range points {
+		positions = append(positions, position(p))
+	}
+
+	if len(points) > 0 && points[0] != points[len(points)-1] {
+		positions = append(positions, position(points[0]))
+	}
+
+	return positions
+}
+
+// matchesGeo evaluates the geo filter against the value of a document in process, with the semantics of the
+// filter produced by Filters for values holding a GeoJSON point; other values never match. The edges of
+// polygons are evaluated as straight lines of longitude and latitude, which approximates the geodesics of the
+// server for small areas.
+func matchesGeo(f search.Filter, v interface{}) bool {
+	p, ok := pointOf(v)
+	if !ok {
+		return false
+	}
+
+	switch val := f.Value.(type) {
+	case Nearby:
+		return f.Op == Near && (val.MaxDistance <= 0 || distance(p, val.Point) <= val.MaxDistance)
+	case Point:
+		switch {
+		case f.Op == Near:
+			return true
+		case f.Op == Intersects:
+			return p == val
+		}
+	case Polygon:
+		return (f.Op == Within || f.Op == Intersects) && inPolygon(p, val)
+	case Box:
+		return (f.Op == Within || f.Op == Intersects) && inPolygon(p, val.Polygon())
+	case CenterSphere:
+		return f.Op == Within && distance(p, val.Center) <= val.Radius
+	}
+
+	return false
+}
+
+// pointOf provides the position of a GeoJSON point, or of a legacy pair of longitude and latitude.
+func pointOf(v interface{}) (Point, bool) {
+	if doc, ok := object(v); ok {
+		if kind, _ := str(doc["type"]); kind != "Point" {
+			return Point{}, false
+		}
+
+		v = doc["coordinates"]
+	}
+
+	coords, ok := array(v)
+	if !ok || len(coords) != 2 {
+		return Point{}, false
+	}
+
+	lng, ok := number(coords[0])
+	if !ok {
+		return Point{}, false
+	}
+
+	lat, ok := number(coords[1])
+	if !ok {
+		return Point{}, false
+	}
+
+	return Point{Longitude: lng, Latitude: lat}, true
+}
+
+// distance provides the great circle distance, in meters, between the points.
+func distance(a, b Point) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(b.Latitude - a.Latitude)
+	dLng := rad(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * dbutil.EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// inPolygon determines if the point is within the exterior ring of the polygon and outside of its holes.
+func inPolygon(p Point, polygon Polygon) bool {
+	if len(polygon) == 0 || !inRing(p, polygon[0]) {
+		return false
+	}
+
+	for _, hole := range polygon[1:] {
+		if inRing(p, hole) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inRing determines if the point is within the ring, by the number of edges a ray from the point crosses.
+func inRing(p Point, ring []Point) bool {
+	in := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+
+		if (a.Latitude > p.Latitude) != (b.Latitude > p.Latitude) &&
+			p.Longitude < (b.Longitude-a.Longitude)*(p.Latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			in = !in
+		}
+	}
+
+	return in
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Health statuses reported by a Datastore.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// probeTimeout bounds how long a probe waits on the Datastore; matches the Kubernetes default probe timeout.
+const probeTimeout = 1 * time.Second
+
+// Health describes the state of a Datastore at the time it was checked.
+type Health struct {
+	Status      string      `json:"status"`
+	Error       string      `json:"error,omitempty"`
+	Credentials string      `json:"credentials"`
+	LastPing    *time.Time  `json:"lastPing,omitempty"`
+	Topology    Topology    `json:"topology"`
+	Pools       []PoolUsage `json:"pools,omitempty"`
+}
+
+// Topology describes the members of the cluster backing a Datastore.
+type Topology struct {
+	Kind        string   `json:"kind"`
+	SetName     string   `json:"setName,omitempty"`
+	Primary     *Member  `json:"primary,omitempty"`
+	Secondaries []Member `json:"secondaries,omitempty"`
+}
+
+// Member describes a single server within the Topology.
+type Member struct {
+	Address string         `json:"address"`
+	RTT     time.Duration  `json:"rtt"`
+	Lag     *time.Duration `json:"lag,omitempty"`
+}
+
+// PoolUsage describes the utilization of the connection pool to a single server.
+type PoolUsage struct {
+	Address string `json:"address"`
+	Total   int64  `json:"total"`
+	InUse   int64  `json:"inuse"`
+	Failed  int64  `json:"failed"`
+	Limit   uint64 `json:"limit"`
+}
+
+// HealthzHandler provides a liveness probe for the Datastore. The probe only fails when the Datastore
+// is unable to produce a health report at all; a cluster outage is reported by ReadyzHandler instead
+// so pods are not restarted while the cluster recovers.
+func HealthzHandler(ds Datastore) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+		defer cancel()
+
+		h, _ := ds.HealthCheck(ctx)
+		if h == nil {
+			writeHealth(rw, http.StatusServiceUnavailable, &Health{Status: StatusUnavailable})
+
+			return
+		}
+
+		writeHealth(rw, http.StatusOK, h)
+	})
+}
+
+// ReadyzHandler provides a readiness probe for the Datastore. The probe fails whenever the cluster
+// cannot be reached.
+func ReadyzHandler(ds Datastore) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+		defer cancel()
+
+		h, err := ds.HealthCheck(ctx)
+		if h == nil {
+			h = &Health{Status: StatusUnavailable}
+		}
+
+		if err != nil {
+			writeHealth(rw, http.StatusServiceUnavailable, h)
+
+			return
+		}
+
+		writeHealth(rw, http.StatusOK, h)
+	})
+}
+
+func writeHealth(rw http.ResponseWriter, code int, h *Health) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+
+	if err := json.NewEncoder(rw).Encode(h); err != nil {
+		logrus.Warnf("Unable to write health response: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// Matches evaluates the filters of the search Query against the document in process, with the semantics of
+// the filter produced by Filters: an array field matches when any of its elements matches, strings
+// compare case-insensitively for Like and IgnoreCase, NotEqual matches missing fields and geo filters match
+// GeoJSON points. Text filters are not evaluated. A nil Query matches every document.
+func Matches(q *search.Query, doc bson.M) bool {
+	if q == nil {
+		return true
+	}
+
+	for k, f := range q.Filters() {
+		if isText(f) {
+			continue
+		}
+
+		if k == idRef {
+			k = pk
+		}
+
+		if isGeo(f) {
+			if !matchesGeo(f, lookup(doc, k)) {
+				return false
+			}
+
+			continue
+		}
+
+		if !matchesFilter(f, lookup(doc, k)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchesFilter(f search.Filter, v interface{}) bool {
+	switch val := dbutil.Value(f.Value).(type) {
+	case []string, bson.A:
+		values, _ := array(val)
+
+		return anyOf(v, func(e interface{}) bool {
+			for _, value := range values {
+				if equal(e, value) {
+					return true
+				}
+			}
+
+			return false
+		})
+	case time.Time, primitive.DateTime, int, int32, int64, float32, float64, primitive.Decimal128:
+		return anyOf(v, func(e interface{}) bool {
+			c, ok := compare(e, val)
+
+			switch {
+			case !ok:
+				return false
+			case f.LTE():
+				return c <= 0
+			case f.GTE():
+				return c >= 0
+			}
+
+			return c == 0
+		})
+	case string:
+		switch {
+		case f.Like():
+			return matchesPattern(v, "(?i)^"+regexp.QuoteMeta(val))
+		case f.IgnoreCase():
+			return matchesPattern(v, "(?i)^"+regexp.QuoteMeta(val)+"$")
+		case f.NotEqual():
+			return !anyOf(v, func(e interface{}) bool { return equal(e, val) })
+		}
+
+		return anyOf(v, func(e interface{}) bool { return equal(e, val) })
+	default:
+		return anyOf(v, func(e interface{}) bool { return equal(e, val) })
+	}
+}
+
+func matchesPattern(v interface{}, pattern string) bool {
+	re := regexp.MustCompile(pattern)
+
+	return anyOf(v, func(e interface{}) bool {
+		s, ok := dbutil.Value(e).(string)
+
+		return ok && re.MatchString(s)
+	})
+}
+
+// anyOf determines if the value, or any element of the value when it is an array, satisfies the predicate.
+func anyOf(v interface{}, predicate func(e interface{}) bool) bool {
+	if predicate(v) {
+		return true
+	}
+
+	if items, ok := array(v); ok {
+		for _, e := range items {
+			if predicate(e) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// equal compares the values as stored; numbers are compared by value regardless of their types.
+func equal(a, b interface{}) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+
+	return reflect.DeepEqual(dbutil.Value(a), dbutil.Value(b))
+}
+
+// compare orders two numbers or two dates; false when they are not both numbers or both dates.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := orderOf(a); ok {
+		if y, ok := orderOf(b); ok {
+			switch {
+			case x.number != y.number:
+				return 0, false
+			case x.value < y.value:
+				return -1, true
+			case x.value > y.value:
+				return 1, true
+			}
+
+			return 0, true
+		}
+	}
+
+	return 0, false
+}
+
+type ordered struct {
+	value  float64
+	number bool
+}
+
+// orderOf provides the value of a number, or the unix milliseconds of a date, as stored.
+func orderOf(v interface{}) (ordered, bool) {
+	switch val := dbutil.Value(v).(type) {
+	case time.Time:
+		return ordered{value: float64(val.UnixMilli())}, true
+	case primitive.DateTime:
+		return ordered{value: float64(val)}, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(val.String(), 64)
+		if err != nil {
+			return ordered{}, false
+		}
+
+		return ordered{value: f, number: true}, true
+	}
+
+	if f, ok := number(dbutil.Value(v)); ok {
+		return ordered{value: f, number: true}, true
+	}
+
+	return ordered{}, false
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+	"gitscm.cisco.com/mcmp/utils/env"
+)
+
+// Read preference modes.
+const (
+	ReadPrimary            = "primary"
+	ReadPrimaryPreferred   = "primaryPreferred"
+	ReadSecondary          = "secondary"
+	ReadSecondaryPreferred = "secondaryPreferred"
+	ReadNearest            = "nearest"
+)
+
+// Read concern levels.
+const (
+	ReadConcernLocal    = "local"
+	ReadConcernMajority = "majority"
+)
+
+// WriteMajority acknowledges writes once a majority of the members have applied them.
+const WriteMajority = "majority"
+
+// ReturnDocument selects the document returned by FindOneAndUpdate.
+type ReturnDocument int
+
+// Documents returned by FindOneAndUpdate.
+const (
+	// ReturnBefore returns the document as it was before the update.
+	ReturnBefore ReturnDocument = iota
+	// ReturnAfter returns the document as updated.
+	ReturnAfter
+)
+
+// regionTag is the name of the member tag that identifies the region of a member.
+const regionTag = "region"
+
+// ReadPreference selects the members used for reads.
+type ReadPreference struct {
+	Mode string
+	// MaxStaleness excludes secondaries that lag the primary by more than the duration; zero disables the check.
+	MaxStaleness time.Duration
+	// TagSets are tried in order until one matches at least one member.
+	TagSets []map[string]string
+}
+
+// WriteConcern describes the acknowledgement requested for writes.
+type WriteConcern struct {
+	// W is the number of members, or WriteMajority, that must acknowledge the write.
+	W interface{}
+	// Journal requests acknowledgement once the write has been written to the journal.
+	Journal bool
+	// Timeout bounds how long the write waits for acknowledgement; zero waits indefinitely.
+	Timeout time.Duration
+}
+
+// Options are the settings of a single Datastore operation; unset settings use the defaults of the Datastore.
+type Options struct {
+	ReadPreference *ReadPreference
+	ReadConcern    string
+	WriteConcern   *WriteConcern
+	// Upsert inserts a document when none matches an update.
+	Upsert bool
+	Return ReturnDocument
+}
+
+// Option modifies the Options of a single Datastore operation.
+type Option func(o *Options)
+
+// WithReadPreference reads from the members matching the mode and the first of the tag sets matching a member.
+func WithReadPreference(mode string, maxStaleness time.Duration, tagSets ...map[string]string) Option {
+	return func(o *Options) {
+		o.ReadPreference = &ReadPreference{
+			Mode:         mode,
+			MaxStaleness: maxStaleness,
+			TagSets:      tagSets,
+		}
+	}
+}
+
+// WithReadConcern reads data at the level, such as ReadConcernLocal or ReadConcernMajority.
+func WithReadConcern(level string) Option {
+	return func(o *Options) {
+		o.ReadConcern = level
+	}
+}
+
+// WithWriteConcern requests acknowledgement of writes by w members, or WriteMajority, optionally once
+// written to the journal, waiting up to the timeout.
+func WithWriteConcern(w interface{}, journal bool, timeout time.Duration) Option {
+	return func(o *Options) {
+		o.WriteConcern = &WriteConcern{
+			W:       w,
+			Journal: journal,
+			Timeout: timeout,
+		}
+	}
+}
+
+// WithUpsert inserts a document when none matches an update; the document holds the id, the fields set by the
+// update, including those of SetOnInsert, and the equality conditions of the filter.
+func WithUpsert() Option {
+	return func(o *Options) {
+		o.Upsert = true
+	}
+}
+
+// WithReturnDocument selects the document returned by FindOneAndUpdate; ReturnBefore by default.
+func WithReturnDocument(r ReturnDocument) Option {
+	return func(o *Options) {
+		o.Return = r
+	}
+}
+
+// LocalRegion provides the tag set matching members within the region of the service, falling back to
+// any member; nil when the region is not configured.
+func LocalRegion() []map[string]string {
+	region := viper.GetString(env.SvcRegion)
+	if region == "" {
+		return nil
+	}
+
+	return []map[string]string{{regionTag: region}, {}}
+}
+
+// NewOptions applies the opts to empty Options.
+func NewOptions(opts ...Option) *Options {
+	o := new(Options)
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
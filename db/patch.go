@@ -0,0 +1,556 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// operation is an operation of a JSON Patch.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ParsePatch translates a JSON Patch, when the patch is an array, or a JSON Merge Patch, when the patch is an
+// object, into an Update.
+func ParsePatch(patch []byte) (*Update, error) {
+	switch trimmed := bytes.TrimSpace(patch); {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return ParseJSONPatch(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return ParseMergePatch(trimmed)
+	}
+
+	return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "patch", "a JSON merge patch or JSON patch")
+}
+
+// ParseMergePatch translates a JSON Merge Patch (RFC 7396) into an Update: null members are unset, objects
+// are merged member by member and every other value is set. The members patched by objects are assumed to be
+// objects within the document; use ParseMergePatchOf when they may hold other values.
+func ParseMergePatch(patch []byte) (*Update, error) {
+	doc, err := decodeMergePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	u := newUpdate()
+
+	if err := u.merge("", doc, nil); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// ParseMergePatchOf translates a JSON Merge Patch (RFC 7396) into an Update of the document, which only needs
+// to hold the top level fields of the MergeTargets of the patch. A member patched by an object is merged member
+// by member where the document holds an object, and otherwise set to the patch without its null members. The
+// Update is conditioned on the members holding the same types of values, so it fails with ErrPreconditionNotMet
+// when the document is modified concurrently.
+func ParseMergePatchOf(patch []byte, doc bson.M) (*Update, error) {
+	p, err := decodeMergePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc == nil {
+		doc = bson.M{}
+	}
+
+	u := newUpdate()
+
+	if err := u.merge("", p, doc); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// MergeTargets provides the paths of the members patched by objects within the JSON Merge Patch, whose values
+// within the document determine how the patch applies.
+func MergeTargets(patch []byte) ([]string, error) {
+	p, err := decodeMergePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+
+	var collect func(prefix string, patch bson.M)
+	collect = func(prefix string, patch bson.M) {
+		for _, name := range sortedKeys(patch) {
+			if m, ok := patch[name].(bson.M); ok {
+				targets = append(targets, join(prefix, name))
+				collect(join(prefix, name), m)
+			}
+		}
+	}
+
+	collect("", p)
+
+	return targets, nil
+}
+
+func decodeMergePatch(patch []byte) (bson.M, error) {
+	v, err := decodeJSON(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, ok := v.(bson.M)
+	if !ok {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "patch", "a JSON object")
+	}
+
+	return doc, nil
+}
+
+// merge adds the members of the patch to the Update; the document holds the values of the members when known.
+func (u *Update) merge(prefix string, patch bson.M, doc bson.M) error {
+	for name, v := range patch {
+		if err := checkName(prefix, name); err != nil {
+			return err
+		}
+
+		path := join(prefix, name)
+
+		switch val := v.(type) {
+		case nil:
+			u.Unset[path] = ""
+		case bson.M:
+			if doc == nil {
+				// assumed to be an object, so an empty object leaves it unchanged
+				if err := u.merge(path, val, nil); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if target, ok := object(doc[name]); ok {
+				u.Conditions = append(u.Conditions, bson.M{path: bson.M{"$type": "object"}})
+
+				if err := u.merge(path, val, target); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// a missing member or a member that is not an object is replaced by the patch
+			if err := checkNames(path, val); err != nil {
+				return err
+			}
+
+			u.Conditions = append(u.Conditions, typeCondition(path, doc, name))
+			u.Set[path] = withoutNulls(val)
+		default:
+			u.Set[path] = val
+		}
+
+		u.paths = append(u.paths, path)
+	}
+
+	return nil
+}
+
+// checkNames verifies the names of the members of the object, at any depth, can be addressed using dot notation.
+func checkNames(parent string, m bson.M) error {
+	for name, v := range m {
+		if err := checkName(parent, name); err != nil {
+			return err
+		}
+
+		if child, ok := v.(bson.M); ok {
+			if err := checkNames(join(parent, name), child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// withoutNulls provides the result of merging the patch into an empty object: the patch without its null members.
+func withoutNulls(patch bson.M) bson.M {
+	out := make(bson.M, len(patch))
+
+	for name, v := range patch {
+		switch val := v.(type) {
+		case nil:
+		case bson.M:
+			out[name] = withoutNulls(val)
+		default:
+			out[name] = val
+		}
+	}
+
+	return out
+}
+
+// typeCondition provides the condition that the member of the document still holds a value of the same type,
+// or is still missing.
+func typeCondition(path string, doc bson.M, name string) bson.M {
+	v, ok := doc[name]
+	if !ok {
+		return bson.M{path: bson.M{"$exists": false}}
+	}
+
+	return bson.M{path: bson.M{"$type": typeAlias(v)}}
+}
+
+// typeAlias provides the alias of the BSON type of a decoded value, as used by $type.
+func typeAlias(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int32:
+		return "int"
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	case primitive.Decimal128:
+		return "decimal"
+	case primitive.ObjectID:
+		return "objectId"
+	case primitive.DateTime, time.Time:
+		return "date"
+	case primitive.Timestamp:
+		return "timestamp"
+	case primitive.Binary:
+		return "binData"
+	case primitive.Regex:
+		return "regex"
+	}
+
+	if _, ok := array(v); ok {
+		return "array"
+	}
+
+	if n, ok := number(v); ok {
+		if n == float64(int64(n)) {
+			return "long"
+		}
+
+		return "double"
+	}
+
+	return "object"
+}
+
+// ParseJSONPatch translates a JSON Patch (RFC 6902) into an Update. The operations are applied atomically, so
+// a path cannot be modified by more than one operation, other than appending several values to an array, and
+// test operations must precede the operations modifying their path.
+//
+// Operations are translated as follows:
+//   - add sets the member, or pushes the value into the array at the index or at the end for "-"
+//   - remove unsets the member; only the first element of an array can be removed
+//   - replace sets the member, which must exist
+//   - move renames the member; array elements cannot be moved
+//   - test adds a condition, failing the patch with ErrPreconditionNotMet when the value differs
+//
+// copy operations are not supported as they cannot be expressed without reading the document.
+func ParseJSONPatch(patch []byte) (*Update, error) {
+	var ops []operation
+
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "patch", "a JSON patch")
+	}
+
+	u := newUpdate()
+
+	for i, op := range ops {
+		if op.Op == "" {
+			return nil, errors.NewDomainError(errors.ErrRequired, errors.Default, fmt.Sprintf("patch[%d].op", i))
+		}
+
+		if err := u.apply(op); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+func (u *Update) apply(op operation) error {
+	parent, last, err := pointer(op.Path)
+	if err != nil {
+		return err
+	}
+
+	path := join(parent, last)
+
+	switch op.Op {
+	case "add":
+		v, err := value(op)
+		if err != nil {
+			return err
+		}
+
+		if last == "-" {
+			return u.push(parent, v, -1)
+		}
+
+		if n, ok := index(parent, last); ok {
+			if n > 0 {
+				u.require(join(parent, strconv.Itoa(n-1)))
+			}
+
+			return u.push(parent, v, n)
+		}
+
+		u.Set[path] = v
+
+		return u.modify(path)
+	case "remove":
+		if n, ok := index(parent, last); ok {
+			if n != 0 {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, op.Path, "the first element of an array")
+			}
+
+			u.require(path)
+			u.Pop[parent] = -1
+
+			return u.modify(parent)
+		}
+
+		u.require(path)
+		u.Unset[path] = ""
+
+		return u.modify(path)
+	case "replace":
+		v, err := value(op)
+		if err != nil {
+			return err
+		}
+
+		u.require(path)
+		u.Set[path] = v
+
+		return u.modify(path)
+	case "move":
+		fromParent, fromLast, err := pointer(op.From)
+		if err != nil {
+			return err
+		}
+
+		from := join(fromParent, fromLast)
+
+		if _, ok := index(fromParent, fromLast); ok || fromLast == "-" {
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, op.From, "a member of an object")
+		}
+
+		if _, ok := index(parent, last); ok || last == "-" {
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, op.Path, "a member of an object")
+		}
+
+		if from == path {
+			return nil
+		}
+
+		u.require(from)
+		u.Rename[from] = path
+
+		if err := u.modify(from); err != nil {
+			return err
+		}
+
+		return u.modify(path)
+	case "test":
+		v, err := value(op)
+		if err != nil {
+			return err
+		}
+
+		if u.modified(path) {
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, op.Path, "a path tested before it is modified")
+		}
+
+		if v == nil {
+			u.Conditions = append(u.Conditions, bson.M{path: bson.M{"$type": "null"}})
+
+			return nil
+		}
+
+		// documents are only equal when their members are in the same order
+		ordered, err := decodeOrderedJSON(op.Value)
+		if err != nil {
+			return err
+		}
+
+		u.Conditions = append(u.Conditions, bson.M{path: bson.M{"$eq": ordered}})
+
+		return nil
+	}
+
+	return errors.NewDomainError(errors.ErrInvalid, errors.Default, "op "+op.Op, "add, remove, replace, move or test")
+}
+
+// pointer translates a JSON Pointer (RFC 6901) into the dot notation path of its parent and its last token;
+// "-", the end of an array, is only allowed as the last token.
+func pointer(p string) (string, string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", "", errors.NewDomainError(errors.ErrInvalid, errors.Default, "path "+p, "a JSON pointer to a member of the document")
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	parent := ""
+
+	for i, token := range tokens {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		last := i == len(tokens)-1
+
+		if !(last && token == "-" && parent != "") {
+			if err := checkName(parent, token); err != nil {
+				return "", "", err
+			}
+		}
+
+		if last {
+			return parent, token, nil
+		}
+
+		parent = join(parent, token)
+	}
+
+	return parent, "", nil
+}
+
+// index provides the array index of the token; the document itself is never an array.
+func index(parent, token string) (int, bool) {
+	if parent == "" || token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(token)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func value(op operation) (interface{}, error) {
+	if op.Value == nil {
+		return nil, errors.NewDomainError(errors.ErrRequired, errors.Default, "value of "+op.Path)
+	}
+
+	return decodeJSON(op.Value)
+}
+
+// decodeJSON decodes JSON into documents, arrays and, where the number is integral, integers.
+func decodeJSON(data []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "patch", "valid JSON")
+	}
+
+	return fromJSON(v), nil
+}
+
+// decodeOrderedJSON decodes JSON like decodeJSON, keeping the members of objects in order as bson.D.
+func decodeOrderedJSON(data []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	v, err := decodeOrdered(d)
+	if err != nil {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "patch", "valid JSON")
+	}
+
+	return v, nil
+}
+
+func decodeOrdered(d *json.Decoder) (interface{}, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case json.Delim('{'):
+		doc := bson.D{}
+
+		for d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+
+			doc = append(doc, bson.E{Key: key.(string), Value: v})
+		}
+
+		_, err = d.Token()
+
+		return doc, err
+	case json.Delim('['):
+		a := bson.A{}
+
+		for d.More() {
+			v, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+
+			a = append(a, v)
+		}
+
+		_, err = d.Token()
+
+		return a, err
+	}
+
+	return fromJSON(t), nil
+}
+
+func fromJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		doc := make(bson.M, len(val))
+		for k, e := range val {
+			doc[k] = fromJSON(e)
+		}
+
+		return doc
+	case []interface{}:
+		a := make(bson.A, 0, len(val))
+		for _, e := range val {
+			a = append(a, fromJSON(e))
+		}
+
+		return a
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+
+		f, _ := val.Float64()
+
+		return f
+	}
+
+	return v
+}
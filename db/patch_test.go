@@ -0,0 +1,130 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseJSONPatchTestOrder(t *testing.T) {
+	u, err := ParsePatch([]byte(`[{"op": "test", "path": "/address", "value": {"street": "Main", "city": "Oslo", "zip": 1}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := bson.D{{Key: "street", Value: "Main"}, {Key: "city", Value: "Oslo"}, {Key: "zip", Value: int64(1)}}
+
+	if len(u.Conditions) != 1 {
+		t.Fatalf("Conditions = %v, want one", u.Conditions)
+	}
+
+	got := u.Conditions[0]["address"].(bson.M)["$eq"]
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("$eq = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseMergePatch(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		patch string
+		set   bson.M
+		unset bson.M
+	}{
+		{"empty", `{}`, bson.M{}, bson.M{}},
+		{"empty member", `{"address": {}}`, bson.M{}, bson.M{}},
+		{"nested", `{"address": {"city": "Oslo", "zip": null}}`, bson.M{"address.city": "Oslo"}, bson.M{"address.zip": ""}},
+	} {
+		u, err := ParseMergePatch([]byte(tc.patch))
+		if err != nil {
+			t.Errorf("%s: ParseMergePatch() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(u.Set, tc.set) || !reflect.DeepEqual(u.Unset, tc.unset) {
+			t.Errorf("%s: ParseMergePatch() = set %v unset %v, want set %v unset %v", tc.name, u.Set, u.Unset, tc.set, tc.unset)
+		}
+
+		if len(tc.set)+len(tc.unset) == 0 && len(u.Operators()) != 0 {
+			t.Errorf("%s: Operators() = %v, want none", tc.name, u.Operators())
+		}
+	}
+}
+
+func TestParseMergePatchOf(t *testing.T) {
+	patch := []byte(`{"address": {"city": "Oslo", "zip": null}, "name": "ann"}`)
+
+	for _, tc := range []struct {
+		name       string
+		doc        bson.M
+		set        bson.M
+		unset      bson.M
+		conditions []bson.M
+	}{
+		{
+			name:       "object",
+			doc:        bson.M{"address": bson.M{"city": "Bergen", "zip": "5003"}},
+			set:        bson.M{"address.city": "Oslo", "name": "ann"},
+			unset:      bson.M{"address.zip": ""},
+			conditions: []bson.M{{"address": bson.M{"$type": "object"}}},
+		},
+		{
+			name:       "string",
+			doc:        bson.M{"address": "Main Street"},
+			set:        bson.M{"address": bson.M{"city": "Oslo"}, "name": "ann"},
+			unset:      bson.M{},
+			conditions: []bson.M{{"address": bson.M{"$type": "string"}}},
+		},
+		{
+			name:       "missing",
+			doc:        bson.M{},
+			set:        bson.M{"address": bson.M{"city": "Oslo"}, "name": "ann"},
+			unset:      bson.M{},
+			conditions: []bson.M{{"address": bson.M{"$exists": false}}},
+		},
+		{
+			name:       "null",
+			doc:        bson.M{"address": nil},
+			set:        bson.M{"address": bson.M{"city": "Oslo"}, "name": "ann"},
+			unset:      bson.M{},
+			conditions: []bson.M{{"address": bson.M{"$type": "null"}}},
+		},
+	} {
+		u, err := ParseMergePatchOf(patch, tc.doc)
+		if err != nil {
+			t.Errorf("%s: ParseMergePatchOf() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(u.Set, tc.set) || !reflect.DeepEqual(u.Unset, tc.unset) {
+			t.Errorf("%s: ParseMergePatchOf() = set %v unset %v, want set %v unset %v", tc.name, u.Set, u.Unset, tc.set, tc.unset)
+		}
+
+		if !reflect.DeepEqual(u.Conditions, tc.conditions) {
+			t.Errorf("%s: Conditions = %v, want %v", tc.name, u.Conditions, tc.conditions)
+		}
+	}
+}
+
+func TestMergeTargets(t *testing.T) {
+	got, err := MergeTargets([]byte(`{"a": {"b": {"c": 1}}, "d": 2, "e": null, "f": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a", "a.b", "f"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeTargets() = %v, want %v", got, want)
+	}
+}
+
+func TestParsePatchInvalid(t *testing.T) {
+	for _, patch := range []string{`"text"`, `[{"op": "test", "path": "/a"`, `{"a.b": 1}`, `{"a": {"$set": 1}}`} {
+		if _, err := ParsePatch([]byte(patch)); err == nil {
+			t.Errorf("ParsePatch(%s) succeeded, want error", patch)
+		}
+	}
+}
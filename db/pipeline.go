@@ -0,0 +1,308 @@
+package db
+
+import (
+	"sort"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// Pipeline builds an aggregation pipeline. Each stage, along with the operators used within it, is checked
+// against those supported by Amazon DocumentDB as it is added; the first unsupported stage or operator is
+// reported by Build.
+//
+//	p := db.NewPipeline().
+//		MatchQuery(q).
+//		Group("$status", bson.M{"total": bson.M{"$sum": "$amount"}}).
+//		Sort(bson.D{{Key: "total", Value: -1}}).
+//		Limit(10)
+type Pipeline struct {
+	stages      mongo.Pipeline
+	collections []string
+	err         error
+}
+
+// NewPipeline creates an empty Pipeline.
+func NewPipeline() *Pipeline {
+	return &Pipeline{stages: mongo.Pipeline{}}
+}
+
+// Stage adds the stage, a document holding a single stage operator, to the Pipeline. The collections read by
+// $lookup, $graphLookup and $unionWith stages, including those nested within their pipelines or a $facet, are
+// recorded so access to them is authorized.
+func (p *Pipeline) Stage(stage bson.D) *Pipeline {
+	if p.err != nil {
+		return p
+	}
+
+	if p.err = dbutil.CheckStage(stage); p.err != nil {
+		return p
+	}
+
+	joined, err := joinedCollections(stage)
+	if err != nil {
+		p.err = err
+
+		return p
+	}
+
+	p.stages = append(p.stages, stage)
+	p.collections = append(p.collections, joined...)
+
+	return p
+}
+
+// Match filters the documents using the filter.
+func (p *Pipeline) Match(filter bson.M) *Pipeline {
+	return p.Stage(bson.D{{Key: "$match", Value: filter}})
+}
+
+// MatchQuery filters the documents using the filters of the search Query; the fields, order and page of the
+// query are not applied.
+func (p *Pipeline) MatchQuery(q *search.Query) *Pipeline {
+	return p.Match(queryFilters(q))
+}
+
+// Group groups the documents by the id expression, such as "$status" or bson.M{"year": bson.M{"$year": "$at"}},
+// computing the fields using accumulators such as bson.M{"total": bson.M{"$sum": "$amount"}}.
+func (p *Pipeline) Group(id interface{}, fields bson.M) *Pipeline {
+	group := bson.D{{Key: "_id", Value: id}}
+
+	for _, name := range sortedKeys(fields) {
+		group = append(group, bson.E{Key: name, Value: fields[name]})
+	}
+
+	return p.Stage(bson.D{{Key: "$group", Value: group}})
+}
+
+// Project selects, excludes or computes the fields of the documents.
+func (p *Pipeline) Project(fields bson.M) *Pipeline {
+	return p.Stage(bson.D{{Key: "$project", Value: fields}})
+}
+
+// Sort orders the documents by the keys, in order; 1 for ascending and -1 for descending.
+func (p *Pipeline) Sort(keys bson.D) *Pipeline {
+	return p.Stage(bson.D{{Key: "$sort", Value: keys}})
+}
+
+// SortQuery orders the documents using the order of the search Query.
+func (p *Pipeline) SortQuery(q *search.Query) *Pipeline {
+	if q.EmptySortby() {
+		return p
+	}
+
+	return p.Sort(dbutil.Sort(q))
+}
+
+// Lookup joins the documents of the collection whose foreign field equals the local field, as an array in the
+// field named as.
+func (p *Pipeline) Lookup(from, localField, foreignField, as string) *Pipeline {
+	return p.Stage(bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	}}})
+}
+
+// Unwind outputs a document for each element of the array at the path, such as "$items"; documents with a
+// missing, null or empty array are kept when preserveEmpty is set.
+func (p *Pipeline) Unwind(path string, preserveEmpty bool) *Pipeline {
+	return p.Stage(bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: path},
+		{Key: "preserveNullAndEmptyArrays", Value: preserveEmpty},
+	}}})
+}
+
+// Facet processes the documents by each of the pipelines, outputting a single document holding the results of
+// each pipeline in the field of its name.
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	if p.err != nil {
+		return p
+	}
+
+	names := make([]string, 0, len(facets))
+	for name := range facets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	facet := make(bson.D, 0, len(facets))
+
+	for _, name := range names {
+		stages, err := facets[name].Build()
+		if err != nil {
+			p.err = err
+
+			return p
+		}
+
+		facet = append(facet, bson.E{Key: name, Value: stages})
+	}
+
+	return p.Stage(bson.D{{Key: "$facet", Value: facet}})
+}
+
+// Skip skips the first n documents.
+func (p *Pipeline) Skip(n int64) *Pipeline {
+	return p.Stage(bson.D{{Key: "$skip", Value: n}})
+}
+
+// Limit passes the first n documents.
+func (p *Pipeline) Limit(n int64) *Pipeline {
+	if n <= 0 && p.err == nil {
+		p.err = errors.NewDomainError(errors.ErrInvalid, errors.Default, "limit", "a positive number")
+	}
+
+	return p.Stage(bson.D{{Key: "$limit", Value: n}})
+}
+
+// Count outputs a single document holding the number of documents in the field.
+func (p *Pipeline) Count(field string) *Pipeline {
+	return p.Stage(bson.D{{Key: "$count", Value: field}})
+}
+
+// Build provides the stages of the Pipeline; the error of the first stage that could not be added otherwise.
+func (p *Pipeline) Build() (mongo.Pipeline, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return p.stages, nil
+}
+
+// Collections provides the other collections read by the Pipeline.
+func (p *Pipeline) Collections() []string {
+	return p.collections
+}
+
+// joinedCollections lists the collections, other than the one aggregated, read by the stage.
+func joinedCollections(stage bson.D) ([]string, error) {
+	var joined []string
+
+	for _, e := range stage {
+		switch e.Key {
+		case "$lookup", "$graphLookup":
+			spec := stageSpec(e.Value)
+
+			from, ok := spec["from"].(string)
+			if !ok || from == "" {
+				return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, e.Key, "a stage with a from collection")
+			}
+
+			nested, err := pipelineCollections(spec["pipeline"])
+			if err != nil {
+				return nil, err
+			}
+
+			joined = append(append(joined, from), nested...)
+		case "$unionWith":
+			coll, ok := e.Value.(string)
+			spec := stageSpec(e.Value)
+
+			if !ok {
+				coll, ok = spec["coll"].(string)
+			}
+
+			if !ok || coll == "" {
+				return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, e.Key, "a stage with a coll collection")
+			}
+
+			nested, err := pipelineCollections(spec["pipeline"])
+			if err != nil {
+				return nil, err
+			}
+
+			joined = append(append(joined, coll), nested...)
+		case "$facet":
+			for _, facet := range stageSpec(e.Value) {
+				nested, err := pipelineCollections(facet)
+				if err != nil {
+					return nil, err
+				}
+
+				joined = append(joined, nested...)
+			}
+		}
+	}
+
+	return joined, nil
+}
+
+// pipelineCollections lists the collections read by the stages of a nested pipeline.
+func pipelineCollections(v interface{}) ([]string, error) {
+	var stages []interface{}
+
+	switch p := v.(type) {
+	case nil:
+		return nil, nil
+	case mongo.Pipeline:
+		for _, stage := range p {
+			stages = append(stages, stage)
+		}
+	case []bson.D:
+		for _, stage := range p {
+			stages = append(stages, stage)
+		}
+	case []bson.M:
+		for _, stage := range p {
+			stages = append(stages, stage)
+		}
+	case bson.A:
+		stages = p
+	case []interface{}:
+		stages = p
+	default:
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "pipeline", "an array of stages")
+	}
+
+	var joined []string
+
+	for _, stage := range stages {
+		var d bson.D
+
+		switch s := stage.(type) {
+		case bson.D:
+			d = s
+		case bson.M:
+			for k, v := range s {
+				d = append(d, bson.E{Key: k, Value: v})
+			}
+		default:
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "pipeline", "an array of stages")
+		}
+
+		nested, err := joinedCollections(d)
+		if err != nil {
+			return nil, err
+		}
+
+		joined = append(joined, nested...)
+	}
+
+	return joined, nil
+}
+
+// stageSpec provides the fields of the document specifying a stage; nil when the stage is not a document.
+func stageSpec(v interface{}) bson.M {
+	switch d := v.(type) {
+	case bson.M:
+		return d
+	case map[string]interface{}:
+		return d
+	case bson.D:
+		m := make(bson.M, len(d))
+		for _, e := range d {
+			m[e.Key] = e.Value
+		}
+
+		return m
+	}
+
+	return nil
+}
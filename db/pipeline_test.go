@@ -0,0 +1,44 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPipelineCollections(t *testing.T) {
+	p := NewPipeline().
+		Stage(bson.D{{Key: "$lookup", Value: bson.M{
+			"from": "orders",
+			"as":   "orders",
+			"pipeline": bson.A{
+				bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "archived"}, {Key: "as", Value: "archived"}}}},
+			},
+		}}}).
+		Lookup("returns", "_id", "order", "returns").
+		Facet(map[string]*Pipeline{
+			"users": NewPipeline().Lookup("users", "user", "_id", "user"),
+		})
+
+	if _, err := p.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"orders", "archived", "returns", "users"}
+	if got := p.Collections(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collections() = %v, want %v", got, want)
+	}
+}
+
+func TestPipelineJoinWithoutCollection(t *testing.T) {
+	for _, stage := range []bson.D{
+		{{Key: "$lookup", Value: bson.M{"as": "orders", "pipeline": bson.A{}}}},
+		{{Key: "$unionWith", Value: bson.M{"pipeline": bson.A{}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "orders", "pipeline": "orders"}}},
+	} {
+		if _, err := NewPipeline().Stage(stage).Build(); err == nil {
+			t.Errorf("Build() of %v succeeded, want error", stage)
+		}
+	}
+}
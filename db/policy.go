@@ -0,0 +1,393 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-openapi/strfmt"
+	wraperrors "github.com/pkg/errors"
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/ctxutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v2"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// Operation is a kind of access to a collection.
+type Operation string
+
+// Operations authorized by a Policy.
+const (
+	OpRead   Operation = "read"
+	OpInsert Operation = "insert"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+// wildcard matches every principal, client, collection or operation within a Rule.
+const wildcard = "*"
+
+// ErrUnauthorized is returned when the Policy does not grant the operation to the caller.
+var ErrUnauthorized = errors.NewDomainError(errors.ErrUnauthorized, errors.Default)
+
+// placeholders are replaced within the string values of row filters by the value of the caller; nil when the
+// caller has no value.
+var placeholders = map[string]func(ctx context.Context) interface{}{
+	"${principal}":    stringOf(ctxutil.Principal),
+	"${client}":       stringOf(ctxutil.ClientID),
+	"${tenant}":       uuidOf(ctxutil.TenantID),
+	"${account}":      uuidOf(ctxutil.AccountID),
+	"${servicegroup}": uuidOf(ctxutil.ServiceGroupID),
+}
+
+func stringOf(fn func(ctx context.Context) string) func(ctx context.Context) interface{} {
+	return func(ctx context.Context) interface{} {
+		if v := fn(ctx); v != "" {
+			return v
+		}
+
+		return nil
+	}
+}
+
+// uuidOf provides the UUID of the caller as it is stored, so it compares equal to the UUIDs of the documents.
+func uuidOf(fn func(ctx context.Context) strfmt.UUID) func(ctx context.Context) interface{} {
+	return func(ctx context.Context) interface{} {
+		if v := fn(ctx); v != "" {
+			return dbutil.Value(v)
+		}
+
+		return nil
+	}
+}
+
+// Rule grants operations on collections to principals and clients.
+type Rule struct {
+	// Principals granted the rule; any principal when empty.
+	Principals []string `yaml:"principals"`
+	// Clients granted the rule; any client when empty.
+	Clients []string `yaml:"clients"`
+	// Collections the rule applies to.
+	Collections []string `yaml:"collections"`
+	// Operations granted on the collections.
+	Operations []Operation `yaml:"operations"`
+	// Fields restricts the fields that can be read or written; all fields when empty.
+	Fields []string `yaml:"fields"`
+	// Filter restricts the documents that can be accessed; string values may use the placeholders
+	// ${principal}, ${client}, ${tenant}, ${account} and ${servicegroup}, the last three being replaced by
+	// UUIDs stored using the configured representation.
+	Filter map[string]interface{} `yaml:"filter"`
+}
+
+// Policy grants access to collections; the first Rule matching the caller, collection and operation applies
+// and operations not matching any Rule are denied.
+//
+// Example policy file (policy.yaml)
+//
+//	rules:
+//	  - principals: ["reporting"]
+//	    collections: ["orders"]
+//	    operations: [read]
+//	    fields: [status, total, tenant]
+//	    filter:
+//	      tenant: ${tenant}
+//	  - principals: ["*"]
+//	    clients: ["orders-api"]
+//	    collections: ["orders"]
+//	    operations: ["*"]
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadPolicy reads a Policy from a YAML file.
+func LoadPolicy(name string) (*Policy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to read policy %q", name)
+	}
+
+	p := new(Policy)
+
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to parse policy %q", name)
+	}
+
+	for i, r := range p.Rules {
+		if len(r.Collections) == 0 || len(r.Operations) == 0 {
+			return nil, wraperrors.Errorf("policy %q rule %d requires collections and operations", name, i)
+		}
+
+		// YAML decodes embedded documents as map[interface{}]interface{}
+		p.Rules[i].Filter = normalize(r.Filter).(map[string]interface{})
+	}
+
+	return p, nil
+}
+
+// Authorize provides the Grant of the first Rule matching the caller of the context for the operation on the
+// collection. Returns ErrUnauthorized when no Rule matches, or when the caller has no value for a placeholder
+// of the row filter of the matching Rule.
+func (p *Policy) Authorize(ctx context.Context, collection string, op Operation) (*Grant, error) {
+	principal, client := ctxutil.Principal(ctx), ctxutil.ClientID(ctx)
+
+	for _, r := range p.Rules {
+		if matches(r.Principals, principal, true) && matches(r.Clients, client, true) &&
+			matches(r.Collections, collection, false) && matches(operations(r.Operations), string(op), false) {
+			filter, ok := resolve(ctx, r.Filter)
+			if !ok {
+				// an empty value would match the documents of every caller missing it
+				return nil, ErrUnauthorized
+			}
+
+			return &Grant{
+				Fields: r.Fields,
+				Filter: filter.(map[string]interface{}),
+			}, nil
+		}
+	}
+
+	return nil, ErrUnauthorized
+}
+
+// Grant describes the access granted by a Rule; a nil Grant allows access to every field and document.
+type Grant struct {
+	Fields []string
+	Filter bson.M
+}
+
+// Restrict combines the filter with the row filter of the Grant.
+func (g *Grant) Restrict(filter bson.M) bson.M {
+	if g == nil || len(g.Filter) == 0 {
+		return filter
+	}
+
+	if len(filter) == 0 {
+		return g.Filter
+	}
+
+	return bson.M{"$and": bson.A{filter, g.Filter}}
+}
+
+// Check verifies that the document only holds the fields of the Grant and satisfies the equality conditions
+// of the row filter.
+func (g *Grant) Check(doc bson.M) error {
+	if g == nil {
+		return nil
+	}
+
+	if len(g.Fields) > 0 {
+		for k := range doc {
+			if k != "_id" && !g.allows(k) {
+				return ErrUnauthorized
+			}
+		}
+	}
+
+	for k, v := range g.Filter {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+
+		if _, ok := v.(map[string]interface{}); ok {
+			// conditions using operators are only enforced on reads
+			continue
+		}
+
+		if !equal(doc[k], v) {
+			return ErrUnauthorized
+		}
+	}
+
+	return nil
+}
+
+// CheckUpdate verifies that the Update only modifies and tests the fields of the Grant and does not change the
+// fields of the equality conditions of the row filter, other than setting them to the value of the condition.
+func (g *Grant) CheckUpdate(u *Update) error {
+	if g == nil {
+		return nil
+	}
+
+	paths := u.Paths()
+	for _, c := range u.Conditions {
+		for path := range c {
+			paths = append(paths, path)
+		}
+	}
+
+	for _, path := range paths {
+		field := strings.SplitN(path, ".", 2)[0]
+
+		if len(g.Fields) > 0 && field != "_id" && !g.allows(field) {
+			return ErrUnauthorized
+		}
+	}
+
+	for _, path := range u.Paths() {
+		field := strings.SplitN(path, ".", 2)[0]
+
+		v, ok := g.Filter[field]
+		if !ok {
+			continue
+		}
+
+		if set, ok := u.Set[path]; ok && path == field && equal(set, v) {
+			continue
+		}
+
+		if set, ok := u.SetOnInsert[path]; ok && path == field && equal(set, v) {
+			continue
+		}
+
+		return ErrUnauthorized
+	}
+
+	return nil
+}
+
+// CheckFields verifies that the paths, in dot notation, are within the fields of the Grant.
+func (g *Grant) CheckFields(paths ...string) error {
+	if g == nil || len(g.Fields) == 0 {
+		return nil
+	}
+
+	for _, path := range paths {
+		if field := strings.SplitN(path, ".", 2)[0]; field != "_id" && !g.allows(field) {
+			return ErrUnauthorized
+		}
+	}
+
+	return nil
+}
+
+// Project removes the fields of the document not allowed by the Grant.
+func (g *Grant) Project(doc bson.M) bson.M {
+	if g == nil || len(g.Fields) == 0 {
+		return doc
+	}
+
+	out := make(bson.M, len(g.Fields)+1)
+
+	for k, v := range doc {
+		if k == "_id" || g.allows(k) {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+func (g *Grant) allows(field string) bool {
+	for _, f := range g.Fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches determines if the value is one of the values; an empty list matches every value when optional.
+func matches(values []string, value string, optional bool) bool {
+	if len(values) == 0 {
+		return optional
+	}
+
+	for _, v := range values {
+		if v == wildcard || v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func operations(ops []Operation) []string {
+	values := make([]string, 0, len(ops))
+	for _, op := range ops {
+		values = append(values, string(op))
+	}
+
+	return values
+}
+
+// resolve replaces the placeholders within the filter by the values of the caller; false when the caller has
+// no value for one of them.
+func resolve(ctx context.Context, v interface{}) (interface{}, bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(bson.M, len(val))
+		for k, e := range val {
+			r, ok := resolve(ctx, e)
+			if !ok {
+				return nil, false
+			}
+
+			out[k] = r
+		}
+
+		return map[string]interface{}(out), true
+	case []interface{}:
+		out := make(bson.A, 0, len(val))
+		for _, e := range val {
+			r, ok := resolve(ctx, e)
+			if !ok {
+				return nil, false
+			}
+
+			out = append(out, r)
+		}
+
+		return []interface{}(out), true
+	case string:
+		if fn, ok := placeholders[val]; ok {
+			resolved := fn(ctx)
+
+			return resolved, resolved != nil
+		}
+	}
+
+	return v, true
+}
+
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return map[string]interface{}{}
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			out[fmt.Sprint(k)] = normalizeValue(e)
+		}
+
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			out[k] = normalizeValue(e)
+		}
+
+		return out
+	}
+
+	return v
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}, map[string]interface{}:
+		return normalize(val)
+	case []interface{}:
+		out := make([]interface{}, 0, len(val))
+		for _, e := range val {
+			out = append(out, normalizeValue(e))
+		}
+
+		return out
+	}
+
+	return v
+}
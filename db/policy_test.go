@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-openapi/strfmt"
+	"gitscm.cisco.com/mcmp/utils/ctxutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+const testPolicy = `
+rules:
+  - principals: ["reporting"]
+    collections: ["orders"]
+    operations: [read, insert, update]
+    fields: [status, total, tenant, region]
+    filter:
+      tenant: ${tenant}
+      region: 3
+      total: {$gte: 0}
+  - principals: ["*"]
+    clients: ["orders-api"]
+    collections: ["orders"]
+    operations: ["*"]
+`
+
+const tenant = strfmt.UUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+var tenantBytes = []byte{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+func loadTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(name, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPolicy(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestAuthorize(t *testing.T) {
+	p := loadTestPolicy(t)
+	reporting := ctxutil.WithPrincipal(context.Background(), "reporting")
+
+	g, err := p.Authorize(ctxutil.WithTenantID(reporting, tenant), "orders", OpRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := bson.M{"tenant": primitive.Binary{Subtype: 0x04, Data: tenantBytes}, "region": 3, "total": map[string]interface{}{"$gte": 0}}
+	if !reflect.DeepEqual(g.Filter, want) {
+		t.Errorf("Filter = %#v, want %#v", g.Filter, want)
+	}
+
+	if _, err := p.Authorize(reporting, "orders", OpRead); err != ErrUnauthorized {
+		t.Errorf("Authorize() without a tenant = %v, want ErrUnauthorized", err)
+	}
+
+	if _, err := p.Authorize(ctxutil.WithTenantID(reporting, tenant), "orders", OpDelete); err != ErrUnauthorized {
+		t.Errorf("Authorize() of an operation not granted = %v, want ErrUnauthorized", err)
+	}
+
+	api := ctxutil.WithClientID(ctxutil.WithPrincipal(context.Background(), "someone"), "orders-api")
+
+	g, err = p.Authorize(api, "orders", OpDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(g.Fields) != 0 || len(g.Filter) != 0 {
+		t.Errorf("Grant = %+v, want unrestricted", g)
+	}
+}
+
+func TestGrantCheck(t *testing.T) {
+	p := loadTestPolicy(t)
+
+	g, err := p.Authorize(ctxutil.WithTenantID(ctxutil.WithPrincipal(context.Background(), "reporting"), tenant), "orders", OpInsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		doc     bson.M
+		allowed bool
+	}{
+		{"int", bson.M{"tenant": tenant, "region": 3, "total": 10}, true},
+		{"int32", bson.M{"tenant": tenant, "region": int32(3)}, true},
+		{"int64", bson.M{"tenant": tenant, "region": int64(3)}, true},
+		{"float64", bson.M{"tenant": tenant, "region": 3.0}, true},
+		{"stored tenant", bson.M{"tenant": primitive.Binary{Subtype: 0x04, Data: tenantBytes}, "region": 3}, true},
+		{"tenant as a string", bson.M{"tenant": string(tenant), "region": 3}, false},
+		{"other region", bson.M{"tenant": tenant, "region": int64(4)}, false},
+		{"other tenant", bson.M{"tenant": strfmt.UUID("f47ac10b-58cc-4372-a567-0e02b2c3d479"), "region": 3}, false},
+		{"missing tenant", bson.M{"region": 3}, false},
+		{"field not granted", bson.M{"tenant": tenant, "region": 3, "owner": "me"}, false},
+	} {
+		err := g.Check(tc.doc)
+		if tc.allowed && err != nil {
+			t.Errorf("%s: Check() failed: %v", tc.name, err)
+		}
+
+		if !tc.allowed && err == nil {
+			t.Errorf("%s: Check() succeeded, want ErrUnauthorized", tc.name)
+		}
+	}
+}
+
+func TestGrantCheckUpdate(t *testing.T) {
+	p := loadTestPolicy(t)
+
+	g, err := p.Authorize(ctxutil.WithTenantID(ctxutil.WithPrincipal(context.Background(), "reporting"), tenant), "orders", OpUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		ops     []UpdateOp
+		allowed bool
+	}{
+		{"granted field", []UpdateOp{Set("status", "shipped")}, true},
+		{"same region", []UpdateOp{Set("region", int64(3))}, true},
+		{"same region on insert", []UpdateOp{SetOnInsert("region", int32(3))}, true},
+		{"other region", []UpdateOp{Set("region", int64(4))}, false},
+		{"unset tenant", []UpdateOp{Unset("tenant")}, false},
+		{"field not granted", []UpdateOp{Set("owner", "me")}, false},
+	} {
+		u, err := NewUpdate(tc.ops...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = g.CheckUpdate(u)
+		if tc.allowed && err != nil {
+			t.Errorf("%s: CheckUpdate() failed: %v", tc.name, err)
+		}
+
+		if !tc.allowed && err == nil {
+			t.Errorf("%s: CheckUpdate() succeeded, want ErrUnauthorized", tc.name)
+		}
+	}
+}
+
+func TestGrantCheckFields(t *testing.T) {
+	g := &Grant{Fields: []string{"status", "embedding"}}
+
+	for _, tc := range []struct {
+		name    string
+		paths   []string
+		allowed bool
+	}{
+		{"granted field", []string{"embedding"}, true},
+		{"child of a granted field", []string{"status.code"}, true},
+		{"id", []string{"_id"}, true},
+		{"field not granted", []string{"status", "owner.embedding"}, false},
+	} {
+		err := g.CheckFields(tc.paths...)
+		if tc.allowed && err != nil {
+			t.Errorf("%s: CheckFields() failed: %v", tc.name, err)
+		}
+
+		if !tc.allowed && err != ErrUnauthorized {
+			t.Errorf("%s: CheckFields() = %v, want ErrUnauthorized", tc.name, err)
+		}
+	}
+
+	var unrestricted *Grant
+	if err := unrestricted.CheckFields("owner"); err != nil {
+		t.Errorf("CheckFields() of a nil Grant failed: %v", err)
+	}
+}
+
+func TestAuthorizePlaceholders(t *testing.T) {
+	const policy = `
+rules:
+  - collections: ["orders"]
+    operations: [read]
+    filter:
+      owner: ${principal}
+      tenant: ${tenant}
+      account: ${account}
+      servicegroup: ${servicegroup}
+`
+
+	name := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(name, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPolicy(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := strfmt.UUID("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	group := strfmt.UUID("9b2e4c1a-3f5d-4e6b-8a7c-1d2e3f4a5b6c")
+
+	ctx := ctxutil.WithPrincipal(context.Background(), "reporting")
+	ctx = ctxutil.WithTenantID(ctx, tenant)
+	ctx = ctxutil.WithAccountID(ctx, account)
+	ctx = ctxutil.WithServiceGroupID(ctx, group)
+
+	t.Cleanup(config.Restore)
+
+	for _, tc := range []struct {
+		name           string
+		representation string
+		doc            bson.M
+		allowed        bool
+	}{
+		{"binary", "binary", bson.M{"owner": "reporting", "tenant": tenant, "account": account, "servicegroup": group}, true},
+		{"binary other account", "binary", bson.M{"owner": "reporting", "tenant": tenant, "account": tenant, "servicegroup": group}, false},
+		{"binary strings", "binary", bson.M{"owner": "reporting", "tenant": string(tenant), "account": string(account), "servicegroup": string(group)}, false},
+		{"string", "string", bson.M{"owner": "reporting", "tenant": tenant, "account": account, "servicegroup": group}, true},
+		{"string strings", "string", bson.M{"owner": "reporting", "tenant": string(tenant), "account": string(account), "servicegroup": string(group)}, true},
+		{"string other service group", "string", bson.M{"owner": "reporting", "tenant": tenant, "account": account, "servicegroup": account}, false},
+	} {
+		config.Set(config.MongoDBCodecUUID, tc.representation)
+
+		g, err := p.Authorize(ctx, "orders", OpRead)
+		if err != nil {
+			t.Errorf("%s: Authorize() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		err = g.Check(tc.doc)
+		if tc.allowed && err != nil {
+			t.Errorf("%s: Check() failed: %v", tc.name, err)
+		}
+
+		if !tc.allowed && err == nil {
+			t.Errorf("%s: Check() succeeded, want ErrUnauthorized", tc.name)
+		}
+	}
+
+	if _, err := p.Authorize(ctxutil.WithTenantID(context.Background(), tenant), "orders", OpRead); err != ErrUnauthorized {
+		t.Errorf("Authorize() without a principal, account and service group = %v, want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,373 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/strfmt"
+	wraperrors "github.com/pkg/errors"
+	"gitscm.cisco.com/ccdev/go-common/sets"
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+const (
+	pk    = "_id"
+	idRef = "id"
+)
+
+// IDStrategy determines how the ids of new documents are assigned by a Repository.
+type IDStrategy int
+
+// Supported id strategies.
+const (
+	// ObjectIDs assigns a new primitive.ObjectID to documents without an id.
+	ObjectIDs IDStrategy = iota
+	// UUIDs assigns a new random (version 4) strfmt.UUID to documents without an id.
+	UUIDs
+	// CallerIDs requires the caller to supply the id of every document.
+	CallerIDs
+)
+
+// RepositoryOption configures a Repository.
+type RepositoryOption func(r *repositoryOptions)
+
+type repositoryOptions struct {
+	ids IDStrategy
+}
+
+// WithIDs selects how the ids of new documents are assigned; ObjectIDs by default.
+func WithIDs(strategy IDStrategy) RepositoryOption {
+	return func(r *repositoryOptions) {
+		r.ids = strategy
+	}
+}
+
+// Repository stores values of the struct type T within a collection of a Datastore. Field names are taken from
+// the bson struct tags of T, which must include the "_id" field.
+type Repository[T any] struct {
+	ds         Datastore
+	collection string
+	ids        IDStrategy
+	idField    []int
+	attributes sets.String
+}
+
+// NewRepository creates a Repository of the values of type T stored within the collection.
+func NewRepository[T any](ds Datastore, collection string, opts ...RepositoryOption) (*Repository[T], error) {
+	o := new(repositoryOptions)
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, wraperrors.Errorf("repository type %v is not a struct", t)
+	}
+
+	r := &Repository[T]{
+		ds:         ds,
+		collection: collection,
+		ids:        o.ids,
+		attributes: sets.NewString(),
+	}
+
+	r.fields(t, nil)
+
+	if r.idField == nil {
+		return nil, wraperrors.Errorf("repository type %v has no %q field", t, pk)
+	}
+
+	idType := t.FieldByIndex(r.idField).Type
+
+	switch {
+	case r.ids == ObjectIDs && idType != reflect.TypeOf(primitive.ObjectID{}):
+		return nil, wraperrors.Errorf("repository type %v requires a primitive.ObjectID %q field", t, pk)
+	case r.ids == UUIDs && idType.Kind() != reflect.String:
+		return nil, wraperrors.Errorf("repository type %v requires a strfmt.UUID %q field", t, pk)
+	}
+
+	return r, nil
+}
+
+// fields collects the attributes of the struct type and locates the id field.
+func (r *Repository[T]) fields(t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, inline := fieldName(f)
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		if inline && f.Type.Kind() == reflect.Struct {
+			r.fields(f.Type, fieldIndex)
+
+			continue
+		}
+
+		if name == pk && len(index) == 0 {
+			r.idField = fieldIndex
+			r.attributes.Insert(idRef)
+
+			continue
+		}
+
+		r.attributes.Insert(name)
+	}
+}
+
+// fieldName provides the name of the field using the rules of the default bson struct codec.
+func fieldName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("bson")
+	if !ok && !strings.Contains(string(f.Tag), ":") && len(f.Tag) > 0 {
+		tag = string(f.Tag)
+	}
+
+	parts := strings.Split(tag, ",")
+	inline := f.Anonymous && parts[0] == ""
+
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			inline = true
+		}
+	}
+
+	if parts[0] != "" {
+		return parts[0], inline
+	}
+
+	return strings.ToLower(f.Name), inline
+}
+
+// Attributes provides the field names of T for validating a search.Query; the id is named "id".
+func (r *Repository[T]) Attributes() sets.String {
+	return r.attributes
+}
+
+// Get provides the value with the id; ErrNotFound when it does not exist.
+func (r *Repository[T]) Get(ctx context.Context, id interface{}, opts ...Option) (*T, error) {
+	key, err := r.key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := r.ds.Get(ctx, r.collection, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.value(doc)
+}
+
+// List provides the values matching the query, after validating the fields and sort order of the query against
+// the Attributes.
+func (r *Repository[T]) List(ctx context.Context, q *search.Query, opts ...Option) ([]*T, error) {
+	if q == nil {
+		q = search.NewQuery()
+	}
+
+	if err := q.Validate(r.attributes); err != nil {
+		return nil, err
+	}
+
+	docs, err := r.ds.List(ctx, r.collection, q, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]*T, 0, len(docs))
+
+	for _, doc := range docs {
+		v, err := r.value(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// Save inserts the value, assigning its id according to the IDStrategy when not set.
+func (r *Repository[T]) Save(ctx context.Context, v *T, opts ...Option) error {
+	id := reflect.ValueOf(v).Elem().FieldByIndex(r.idField)
+
+	if id.IsZero() {
+		switch r.ids {
+		case ObjectIDs:
+			id.Set(reflect.ValueOf(primitive.NewObjectID()))
+		case UUIDs:
+			uuid, err := newUUID()
+			if err != nil {
+				return err
+			}
+
+			id.SetString(uuid.String())
+		default:
+			return errors.NewDomainError(errors.ErrRequired, errors.Default, idRef)
+		}
+	}
+
+	doc, err := Document(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.ds.Insert(ctx, r.collection, doc, opts...)
+
+	return err
+}
+
+// Update replaces the stored value having the id of the value; ErrNotFound when it does not exist.
+func (r *Repository[T]) Update(ctx context.Context, v *T, opts ...Option) error {
+	id := reflect.ValueOf(v).Elem().FieldByIndex(r.idField)
+	if id.IsZero() {
+		return errors.NewDomainError(errors.ErrRequired, errors.Default, idRef)
+	}
+
+	doc, err := Document(v)
+	if err != nil {
+		return err
+	}
+
+	return r.ds.Replace(ctx, r.collection, id.Interface(), doc, opts...)
+}
+
+// Patch applies a JSON Merge Patch or JSON Patch to the stored value with the id; see Datastore.Patch.
+func (r *Repository[T]) Patch(ctx context.Context, id interface{}, patch []byte, opts ...Option) error {
+	key, err := r.key(id)
+	if err != nil {
+		return err
+	}
+
+	return r.ds.Patch(ctx, r.collection, key, patch, opts...)
+}
+
+// Delete deletes the value with the id; ErrNotFound when it does not exist.
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}, opts ...Option) error {
+	key, err := r.key(id)
+	if err != nil {
+		return err
+	}
+
+	return r.ds.Delete(ctx, r.collection, key, opts...)
+}
+
+// key converts the id to the type stored within the collection; ObjectIDs are accepted as hex strings.
+func (r *Repository[T]) key(id interface{}) (interface{}, error) {
+	s, ok := id.(string)
+	if !ok {
+		return id, nil
+	}
+
+	if r.ids == ObjectIDs {
+		oid, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, idRef, "an object id")
+		}
+
+		return oid, nil
+	}
+
+	// match the type of the field so the id is encoded the same way it is stored
+	t := reflect.TypeOf((*T)(nil)).Elem().FieldByIndex(r.idField).Type
+	v := reflect.New(t).Elem()
+
+	switch {
+	case t == reflect.TypeOf(primitive.ObjectID{}):
+		oid, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, idRef, "an object id")
+		}
+
+		v.Set(reflect.ValueOf(oid))
+	case t.Kind() == reflect.String:
+		v.SetString(s)
+	case v.CanInt():
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, idRef, "an integer")
+		}
+
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, idRef, "a non-negative integer")
+		}
+
+		v.SetUint(n)
+	default:
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, idRef, "an id of type "+t.String())
+	}
+
+	return v.Interface(), nil
+}
+
+func (r *Repository[T]) value(doc bson.M) (*T, error) {
+	v := new(T)
+
+	if err := Decode(doc, v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Document converts a value into a document using its bson struct tags and the codecs of the datastore.
+func Document(v interface{}) (bson.M, error) {
+	data, err := bson.MarshalWithRegistry(dbutil.Registry(), v)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to marshal %T", v)
+	}
+
+	var doc bson.M
+	if err := bson.UnmarshalWithRegistry(dbutil.Registry(), data, &doc); err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to unmarshal %T", v)
+	}
+
+	return doc, nil
+}
+
+// Decode converts a document into the value using its bson struct tags and the codecs of the datastore.
+func Decode(doc bson.M, v interface{}) error {
+	data, err := bson.MarshalWithRegistry(dbutil.Registry(), doc)
+	if err != nil {
+		return wraperrors.Wrap(err, "unable to marshal document")
+	}
+
+	if err := bson.UnmarshalWithRegistry(dbutil.Registry(), data, v); err != nil {
+		return wraperrors.Wrapf(err, "unable to unmarshal %T", v)
+	}
+
+	return nil
+}
+
+// newUUID generates a random (version 4) UUID.
+func newUUID() (strfmt.UUID, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", wraperrors.Wrap(err, "unable to generate id")
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return strfmt.UUID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])), nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/go-openapi/strfmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type intDoc struct {
+	ID int32 `bson:"_id"`
+}
+
+type uuidDoc struct {
+	ID strfmt.UUID `bson:"_id"`
+}
+
+type oidDoc struct {
+	ID primitive.ObjectID `bson:"_id"`
+}
+
+type floatDoc struct {
+	ID float64 `bson:"_id"`
+}
+
+func TestRepositoryKey(t *testing.T) {
+	oid := primitive.NewObjectID()
+
+	ints, err := NewRepository[intDoc](nil, "ints", WithIDs(CallerIDs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuids, err := NewRepository[uuidDoc](nil, "uuids", WithIDs(UUIDs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oids, err := NewRepository[oidDoc](nil, "oids", WithIDs(CallerIDs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	floats, err := NewRepository[floatDoc](nil, "floats", WithIDs(CallerIDs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		key  func(interface{}) (interface{}, error)
+		id   interface{}
+		want interface{}
+	}{
+		{"int", ints.key, "42", int32(42)},
+		{"uuid", uuids.key, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", strfmt.UUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")},
+		{"object id", oids.key, oid.Hex(), oid},
+		{"not a string", ints.key, int32(7), int32(7)},
+	} {
+		got, err := tc.key(tc.id)
+		if err != nil {
+			t.Errorf("%s: key(%v) failed: %v", tc.name, tc.id, err)
+
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("%s: key(%v) = %#v, want %#v", tc.name, tc.id, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		key  func(interface{}) (interface{}, error)
+		id   string
+	}{
+		{"int", ints.key, "forty-two"},
+		{"int out of range", ints.key, "4294967296"},
+		{"object id", oids.key, "not-an-object-id"},
+		{"unsupported type", floats.key, "1.5"},
+	} {
+		if got, err := tc.key(tc.id); err == nil {
+			t.Errorf("%s: key(%q) = %v, want error", tc.name, tc.id, got)
+		}
+	}
+}
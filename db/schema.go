@@ -0,0 +1,829 @@
+package db
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/go-openapi/strfmt"
+	wraperrors "github.com/pkg/errors"
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Schema is the subset of a JSON Schema (draft-07) used to validate documents before they are written:
+// type, properties, required, additionalProperties, items, enum, the numeric, string and array bounds,
+// pattern and format.
+type Schema struct {
+	// Type is a type name or a list of type names: object, array, string, integer, number, boolean or null.
+	Type                 interface{}        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	// Format is only checked when selected by CheckFormats: email, uuid, uri, hostname, ipv4, ipv6 or date-time.
+	Format string `json:"format,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// ParseSchema parses a JSON Schema document.
+func ParseSchema(data []byte) (*Schema, error) {
+	s := new(Schema)
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, wraperrors.Wrap(err, "unable to parse JSON schema")
+	}
+
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Schema) compile() error {
+	if s == nil {
+		return nil
+	}
+
+	if _, err := s.types(); err != nil {
+		return err
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return wraperrors.Wrapf(err, "invalid pattern %q", s.Pattern)
+		}
+
+		s.pattern = re
+	}
+
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+
+	return s.Items.compile()
+}
+
+func (s *Schema) types() ([]string, error) {
+	switch t := s.Type.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{t}, nil
+	case []string:
+		return t, nil
+	case []interface{}:
+		names := make([]string, 0, len(t))
+
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return nil, wraperrors.Errorf("invalid type %v", v)
+			}
+
+			names = append(names, name)
+		}
+
+		return names, nil
+	}
+
+	return nil, wraperrors.Errorf("invalid type %v", s.Type)
+}
+
+// SchemaOption selects how a registered Schema is applied.
+type SchemaOption func(r *registeredSchema)
+
+// CheckFormats checks the format of string values using govalidator.
+func CheckFormats() SchemaOption {
+	return func(r *registeredSchema) {
+		r.formats = true
+	}
+}
+
+// ServerSide also applies the Schema as a $jsonSchema validator of the collection, where supported by the server.
+func ServerSide() SchemaOption {
+	return func(r *registeredSchema) {
+		r.serverSide = true
+	}
+}
+
+type registeredSchema struct {
+	schema     *Schema
+	formats    bool
+	serverSide bool
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = make(map[string]*registeredSchema)
+)
+
+// RegisterSchema validates the documents written to the collection against the Schema.
+func RegisterSchema(collection string, schema *Schema, opts ...SchemaOption) error {
+	if err := schema.compile(); err != nil {
+		return err
+	}
+
+	r := &registeredSchema{schema: schema}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	schemas[collection] = r
+
+	return nil
+}
+
+// Validate checks the document against the Schema registered for the collection; the first violation is
+// reported as an ErrRequired or ErrInvalid domain error naming the path of the field.
+func Validate(collection string, doc bson.M) error {
+	schemasMu.RLock()
+	r, ok := schemas[collection]
+	schemasMu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	return r.schema.validate("", doc, r.formats)
+}
+
+// ValidateUpdate validates an Update of a document of the collection against its registered schema: the values
+// set and pushed must be valid at their paths, incremented fields must be numbers and required fields cannot be
+// removed. The bounds of incremented numbers and of the number of items of arrays are not checked as the stored
+// values are not known.
+func ValidateUpdate(collection string, u *Update) error {
+	schemasMu.RLock()
+	r, ok := schemas[collection]
+	schemasMu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	for _, set := range []bson.M{u.Set, u.SetOnInsert} {
+		for _, path := range sortedKeys(set) {
+			s, err := r.schema.at(path)
+			if err != nil {
+				return err
+			}
+
+			if err := s.validate(path, set[path], r.formats); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, path := range sortedKeys(u.Inc) {
+		s, err := r.schema.at(path)
+		if err != nil {
+			return err
+		}
+
+		// the bounds cannot be checked as the stored value is not known
+		if names, _ := s.types(); len(names) > 0 && !contains(names, "number") && !contains(names, "integer") {
+			return invalid(path, fmt.Sprintf("type %v", s.Type))
+		}
+	}
+
+	for _, push := range []bson.M{u.Push, u.AddToSet} {
+		for _, path := range sortedKeys(push) {
+			s, err := r.schema.at(path)
+			if err != nil {
+				return err
+			}
+
+			if names, _ := s.types(); len(names) > 0 && !contains(names, "array") {
+				return invalid(path, fmt.Sprintf("type %v", s.Type))
+			}
+
+			items, err := pushed(path, push[path])
+			if err != nil {
+				return err
+			}
+
+			for i, item := range items {
+				if err := s.itemSchema().validate(fmt.Sprintf("%s[%d]", path, i), item, r.formats); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, path := range append(sortedKeys(u.Unset), sortedKeys(u.Rename)...) {
+		if err := r.schema.removable(path); err != nil {
+			return err
+		}
+	}
+
+	for _, from := range sortedKeys(u.Rename) {
+		to, ok := u.Rename[from].(string)
+		if !ok {
+			return invalid("rename of "+from, "a field name")
+		}
+
+		if _, err := r.schema.at(to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushed provides the values appended to the array at the path by $push or $addToSet; the elements of $each
+// when the value is a document of modifiers, otherwise the value itself.
+func pushed(path string, v interface{}) ([]interface{}, error) {
+	m, ok := object(v)
+	if !ok {
+		return []interface{}{v}, nil
+	}
+
+	each, ok := m["$each"]
+	if !ok {
+		return []interface{}{v}, nil
+	}
+
+	items, ok := array(each)
+	if !ok {
+		return nil, invalid(path+".$each", "an array")
+	}
+
+	return items, nil
+}
+
+// at provides the schema of the value at the path in dot notation; nil when the value is not constrained.
+func (s *Schema) at(path string) (*Schema, error) {
+	cur, walked := s, ""
+
+	for _, name := range strings.Split(path, ".") {
+		if cur == nil {
+			return nil, nil
+		}
+
+		if _, err := strconv.Atoi(name); err == nil && cur.Items != nil {
+			cur, walked = cur.Items, join(walked, name)
+
+			continue
+		}
+
+		p, ok := cur.Properties[name]
+		if !ok && cur.AdditionalProperties != nil && !*cur.AdditionalProperties && !(walked == "" && name == "_id") {
+			return nil, invalid(join(walked, name), "no additional properties")
+		}
+
+		cur, walked = p, join(walked, name)
+	}
+
+	return cur, nil
+}
+
+// removable verifies that the value at the path in dot notation is not required.
+func (s *Schema) removable(path string) error {
+	parent, name := "", path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parent, name = path[:i], path[i+1:]
+	}
+
+	p := s
+	if parent != "" {
+		var err error
+		if p, err = s.at(parent); err != nil || p == nil {
+			return err
+		}
+	}
+
+	if contains(p.Required, name) {
+		return errors.NewDomainError(errors.ErrRequired, errors.Default, path)
+	}
+
+	return nil
+}
+
+func (s *Schema) itemSchema() *Schema {
+	if s == nil {
+		return nil
+	}
+
+	return s.Items
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m bson.M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// ServerSchemas provides the $jsonSchema validator of each collection registered with ServerSide.
+func ServerSchemas() map[string]bson.M {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	validators := make(map[string]bson.M)
+
+	for coll, r := range schemas {
+		if !r.serverSide {
+			continue
+		}
+
+		root := r.schema.server()
+
+		// the server validates the generated _id and the shadow fields against the additional properties
+		if ap, ok := root["additionalProperties"].(bool); ok && !ap {
+			props, _ := root["properties"].(bson.M)
+			if props == nil {
+				props = bson.M{}
+			}
+
+			props["_id"] = bson.M{}
+			if len(ShadowFields(coll)) > 0 {
+				props[shadowRoot] = bson.M{}
+			}
+
+			root["properties"] = props
+		}
+
+		validators[coll] = bson.M{"$jsonSchema": root}
+	}
+
+	return validators
+}
+
+// server provides the Schema using the keywords supported by $jsonSchema; format is not supported by the server
+// and integers are matched by their BSON types.
+func (s *Schema) server() bson.M {
+	m := bson.M{}
+
+	if names, _ := s.types(); len(names) > 0 {
+		var bsonTypes, types bson.A
+
+		integers := false
+
+		for _, name := range names {
+			switch {
+			case name == "integer":
+				integers = true
+				bsonTypes = append(bsonTypes, "int", "long")
+			case name == "string" && s.Format == "uuid":
+				// UUIDs are stored as binary or string depending on the codecs of the datastore
+				bsonTypes = append(bsonTypes, "string", "binData")
+			case name == "string" && (s.Format == "date-time" || s.Format == "date"):
+				bsonTypes = append(bsonTypes, "string", "date")
+			default:
+				types = append(types, name)
+			}
+		}
+
+		switch {
+		case len(bsonTypes) == 0:
+			m["type"] = types
+		case len(types) == 0:
+			m["bsonType"] = bsonTypes
+		default:
+			for _, t := range types {
+				switch t {
+				case "number":
+					if !integers {
+						bsonTypes = append(bsonTypes, "int", "long")
+					}
+
+					bsonTypes = append(bsonTypes, "double", "decimal")
+				case "boolean":
+					bsonTypes = append(bsonTypes, "bool")
+				default:
+					bsonTypes = append(bsonTypes, t)
+				}
+			}
+
+			m["bsonType"] = bsonTypes
+		}
+	}
+
+	if len(s.Properties) > 0 {
+		props := bson.M{}
+		for name, p := range s.Properties {
+			props[name] = p.server()
+		}
+
+		m["properties"] = props
+	}
+
+	if len(s.Required) > 0 {
+		m["required"] = s.Required
+	}
+
+	if s.AdditionalProperties != nil {
+		m["additionalProperties"] = *s.AdditionalProperties
+	}
+
+	if s.Items != nil {
+		m["items"] = s.Items.server()
+	}
+
+	if len(s.Enum) > 0 {
+		m["enum"] = s.Enum
+	}
+
+	for key, v := range map[string]*float64{"minimum": s.Minimum, "maximum": s.Maximum} {
+		if v != nil {
+			m[key] = *v
+		}
+	}
+
+	// draft-04 keywords used by $jsonSchema for exclusive bounds
+	if s.ExclusiveMinimum != nil {
+		m["minimum"], m["exclusiveMinimum"] = *s.ExclusiveMinimum, true
+	}
+
+	if s.ExclusiveMaximum != nil {
+		m["maximum"], m["exclusiveMaximum"] = *s.ExclusiveMaximum, true
+	}
+
+	for key, v := range map[string]*int{"minLength": s.MinLength, "maxLength": s.MaxLength, "minItems": s.MinItems, "maxItems": s.MaxItems} {
+		if v != nil {
+			m[key] = *v
+		}
+	}
+
+	if s.Pattern != "" {
+		m["pattern"] = s.Pattern
+	}
+
+	return m
+}
+
+func (s *Schema) validate(path string, v interface{}, formats bool) error {
+	if s == nil {
+		return nil
+	}
+
+	v = jsonValue(v)
+
+	names, _ := s.types()
+	if len(names) > 0 && !anyType(names, v) {
+		return invalid(path, fmt.Sprintf("type %v", s.Type))
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		return invalid(path, fmt.Sprintf("one of %v", s.Enum))
+	}
+
+	if n, ok := number(v); ok {
+		if err := s.validateNumber(path, n); err != nil {
+			return err
+		}
+	}
+
+	if str, ok := v.(string); ok {
+		if err := s.validateString(path, str, formats); err != nil {
+			return err
+		}
+	}
+
+	if fields, ok := object(v); ok {
+		return s.validateObject(path, fields, formats)
+	}
+
+	if items, ok := array(v); ok {
+		return s.validateArray(path, items, formats)
+	}
+
+	return nil
+}
+
+func (s *Schema) validateNumber(path string, n float64) error {
+	switch {
+	case s.Minimum != nil && n < *s.Minimum:
+		return invalid(path, fmt.Sprintf("at least %v", *s.Minimum))
+	case s.Maximum != nil && n > *s.Maximum:
+		return invalid(path, fmt.Sprintf("at most %v", *s.Maximum))
+	case s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum:
+		return invalid(path, fmt.Sprintf("greater than %v", *s.ExclusiveMinimum))
+	case s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum:
+		return invalid(path, fmt.Sprintf("less than %v", *s.ExclusiveMaximum))
+	}
+
+	return nil
+}
+
+func (s *Schema) validateString(path, str string, formats bool) error {
+	length := len([]rune(str))
+
+	switch {
+	case s.MinLength != nil && length < *s.MinLength:
+		return invalid(path, fmt.Sprintf("at least %d characters", *s.MinLength))
+	case s.MaxLength != nil && length > *s.MaxLength:
+		return invalid(path, fmt.Sprintf("at most %d characters", *s.MaxLength))
+	case s.pattern != nil && !s.pattern.MatchString(str):
+		return invalid(path, fmt.Sprintf("to match %q", s.Pattern))
+	case formats && s.Format != "" && !validFormat(s.Format, str):
+		return invalid(path, "format "+s.Format)
+	}
+
+	return nil
+}
+
+func (s *Schema) validateObject(path string, fields map[string]interface{}, formats bool) error {
+	for _, name := range s.Required {
+		if _, ok := fields[name]; !ok {
+			return errors.NewDomainError(errors.ErrRequired, errors.Default, join(path, name))
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		p, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties && !(path == "" && name == "_id") {
+				return invalid(join(path, name), "no additional properties")
+			}
+
+			continue
+		}
+
+		if err := p.validate(join(path, name), fields[name], formats); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) validateArray(path string, items []interface{}, formats bool) error {
+	switch {
+	case s.MinItems != nil && len(items) < *s.MinItems:
+		return invalid(path, fmt.Sprintf("at least %d items", *s.MinItems))
+	case s.MaxItems != nil && len(items) > *s.MaxItems:
+		return invalid(path, fmt.Sprintf("at most %d items", *s.MaxItems))
+	}
+
+	for i, item := range items {
+		if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, formats); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func invalid(path, expected string) error {
+	if path == "" {
+		path = "document"
+	}
+
+	return errors.NewDomainError(errors.ErrInvalid, errors.Default, path, expected)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func validFormat(format, str string) bool {
+	switch format {
+	case "email":
+		return govalidator.IsEmail(str)
+	case "uuid":
+		return govalidator.IsUUID(str)
+	case "uri", "url":
+		return govalidator.IsURL(str)
+	case "hostname":
+		return govalidator.IsDNSName(str)
+	case "ipv4":
+		return govalidator.IsIPv4(str)
+	case "ipv6":
+		return govalidator.IsIPv6(str)
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, str)
+
+		return err == nil
+	}
+
+	// unknown formats are annotations only
+	return true
+}
+
+// jsonValue provides the JSON representation of the scalar values stored by the codecs of the datastore, so
+// UUIDs and dates validate as strings and decimals as numbers.
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, string, bool, bson.M, bson.D, bson.A, map[string]interface{}, []interface{}:
+		return v
+	case primitive.Binary:
+		if val.Subtype == bsontype.BinaryUUID && len(val.Data) == 16 {
+			h := hex.EncodeToString(val.Data)
+
+			return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+		}
+	case primitive.DateTime:
+		return val.Time().UTC().Format(time.RFC3339Nano)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	case strfmt.DateTime:
+		return val.String()
+	case strfmt.Date:
+		return val.String()
+	case primitive.Decimal128:
+		if f, err := strconv.ParseFloat(val.String(), 64); err == nil {
+			return f
+		}
+	case *big.Float:
+		if val != nil {
+			f, _ := val.Float64()
+
+			return f
+		}
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+		// strfmt string formats such as strfmt.UUID and strfmt.Email
+		return rv.String()
+	}
+
+	return v
+}
+
+func anyType(names []string, v interface{}) bool {
+	for _, name := range names {
+		if isType(name, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isType(name string, v interface{}) bool {
+	switch name {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+
+		return ok
+	case "string":
+		_, ok := v.(string)
+
+		return ok
+	case "number":
+		_, ok := number(v)
+
+		return ok
+	case "integer":
+		n, ok := number(v)
+
+		return ok && n == math.Trunc(n)
+	case "object":
+		_, ok := object(v)
+
+		return ok
+	case "array":
+		_, ok := array(v)
+
+		return ok
+	}
+
+	return false
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	n, isNumber := number(v)
+
+	for _, e := range enum {
+		if en, ok := number(e); ok && isNumber && en == n {
+			return true
+		}
+
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+
+	return 0, false
+}
+
+func object(v interface{}) (map[string]interface{}, bool) {
+	switch o := v.(type) {
+	case bson.M:
+		return o, true
+	case map[string]interface{}:
+		return o, true
+	case bson.D:
+		m := make(map[string]interface{}, len(o))
+		for _, e := range o {
+			m[e.Key] = e.Value
+		}
+
+		return m, true
+	}
+
+	return nil, false
+}
+
+func array(v interface{}) ([]interface{}, bool) {
+	switch a := v.(type) {
+	case bson.A:
+		return a, true
+	case []interface{}:
+		return a, true
+	case primitive.Binary, primitive.ObjectID, []byte:
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	items := make([]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		items = append(items, rv.Index(i).Interface())
+	}
+
+	return items, true
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSchema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"required": ["name"],
+	"properties": {
+		"owner": {"type": "string"},
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"ratio": {"type": "number"},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 3},
+		"labels": {"type": "object"}
+	}
+}`
+
+func registerTestSchema(t *testing.T, collection string) {
+	t.Helper()
+
+	s, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterSchema(collection, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	registerTestSchema(t, "schema_validate")
+
+	for _, tc := range []struct {
+		name  string
+		doc   bson.M
+		valid bool
+	}{
+		{"valid", bson.M{"_id": primitive.NewObjectID(), "name": "a", "age": 30, "tags": bson.A{"x"}}, true},
+		{"int8 integer", bson.M{"name": "a", "age": int8(30)}, true},
+		{"int16 integer", bson.M{"name": "a", "age": int16(30)}, true},
+		{"uint8 number", bson.M{"name": "a", "ratio": uint8(3)}, true},
+		{"missing required", bson.M{"age": 30}, false},
+		{"additional property", bson.M{"name": "a", "color": "red"}, false},
+		{"fraction for integer", bson.M{"name": "a", "age": 1.5}, false},
+		{"above maximum", bson.M{"name": "a", "age": int16(200)}, false},
+		{"string for integer", bson.M{"name": "a", "age": "30"}, false},
+		{"object id for array", bson.M{"name": "a", "tags": primitive.NewObjectID()}, false},
+		{"too many items", bson.M{"name": "a", "tags": bson.A{"x", "y", "z", "w"}}, false},
+		{"item type", bson.M{"name": "a", "tags": bson.A{1}}, false},
+		{"empty name", bson.M{"name": ""}, false},
+	} {
+		err := Validate("schema_validate", tc.doc)
+		if tc.valid && err != nil {
+			t.Errorf("%s: Validate() failed: %v", tc.name, err)
+		}
+
+		if !tc.valid && err == nil {
+			t.Errorf("%s: Validate() succeeded, want error", tc.name)
+		}
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	registerTestSchema(t, "schema_update")
+
+	for _, tc := range []struct {
+		name  string
+		u     *Update
+		valid bool
+	}{
+		{"set", &Update{Set: bson.M{"age": 31}}, true},
+		{"set invalid", &Update{Set: bson.M{"age": -1}}, false},
+		{"set unknown", &Update{Set: bson.M{"color": "red"}}, false},
+		{"inc", &Update{Inc: bson.M{"age": 1}}, true},
+		{"inc string", &Update{Inc: bson.M{"name": 1}}, false},
+		{"push each", &Update{Push: bson.M{"tags": bson.M{"$each": bson.A{"y"}}}}, true},
+		{"push each invalid", &Update{Push: bson.M{"tags": bson.M{"$each": bson.A{1}}}}, false},
+		{"push each slice", &Update{Push: bson.M{"tags": bson.M{"$each": []string{"y"}}}}, true},
+		{"push value", &Update{AddToSet: bson.M{"tags": "y"}}, true},
+		{"push invalid value", &Update{Push: bson.M{"tags": 1}}, false},
+		{"push each not an array", &Update{Push: bson.M{"tags": bson.M{"$each": "y"}}}, false},
+		{"push to string", &Update{Push: bson.M{"name": bson.M{"$each": bson.A{"y"}}}}, false},
+		{"unset required", &Update{Unset: bson.M{"name": ""}}, false},
+		{"unset optional", &Update{Unset: bson.M{"age": ""}}, true},
+		{"rename", &Update{Rename: bson.M{"owner": "labels.owner"}}, true},
+		{"rename to unknown", &Update{Rename: bson.M{"owner": "color"}}, false},
+		{"rename to non-string", &Update{Rename: bson.M{"owner": 1}}, false},
+	} {
+		err := ValidateUpdate("schema_update", tc.u)
+		if tc.valid && err != nil {
+			t.Errorf("%s: ValidateUpdate() failed: %v", tc.name, err)
+		}
+
+		if !tc.valid && err == nil {
+			t.Errorf("%s: ValidateUpdate() succeeded, want error", tc.name)
+		}
+	}
+}
+
+func TestValidateUnregistered(t *testing.T) {
+	if err := Validate("schema_unregistered", bson.M{"anything": true}); err != nil {
+		t.Errorf("Validate() of an unregistered collection failed: %v", err)
+	}
+}
+
+func TestIsType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		v    interface{}
+		want bool
+	}{
+		{"array", primitive.NewObjectID(), false},
+		{"array", []string{"x"}, true},
+		{"array", []byte("x"), false},
+		{"number", int8(1), true},
+		{"number", int16(1), true},
+		{"number", uint8(1), true},
+		{"integer", uint16(1), true},
+		{"number", "1", false},
+	} {
+		if got := isType(tc.name, tc.v); got != tc.want {
+			t.Errorf("isType(%q, %#v) = %v, want %v", tc.name, tc.v, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// searchSuffix is appended to the name of a collection to name the collection of its postings.
+	searchSuffix = "_search"
+	// maxPrefix is the length of the longest prefix of a keyword that is indexed.
+	maxPrefix = 15
+)
+
+// DefaultStopWords are the English words too common to be indexed.
+var DefaultStopWords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in", "into", "is", "it", "no", "not",
+	"of", "on", "or", "such", "that", "the", "their", "then", "there", "these", "they", "this", "to", "was",
+	"will", "with",
+}
+
+// SearchIndex is an inverted index of the keywords of fields of a collection, which Text filters are resolved
+// against. The postings of each document, a keyword and the number of times it occurs within the document, are
+// maintained within a side collection as the document is written.
+//
+// Keywords are the lower cased runs of letters and digits of the fields, other than stop words. Prefixes of
+// the keywords are also indexed when Prefixes is set, so that "shoe" matches a document holding "shoes".
+type SearchIndex struct {
+	// Fields are the paths, in dot notation, of the string or array of strings fields indexed.
+	Fields []string
+	// StopWords are not indexed; DefaultStopWords when nil.
+	StopWords []string
+	// Prefixes is the length of the shortest prefix of a keyword indexed; prefixes are not indexed when zero.
+	Prefixes int
+
+	stopWords map[string]bool
+}
+
+var (
+	searchMu sync.RWMutex
+	searches = make(map[string]*SearchIndex)
+)
+
+// RegisterSearchIndex maintains the SearchIndex of the collection, replacing the one registered before. Fields
+// holding encrypted values cannot be indexed, as their postings would hold their keywords in plain text; writes
+// to the collection fail while they are.
+func RegisterSearchIndex(collection string, index SearchIndex) error {
+	if len(index.Fields) == 0 {
+		return errors.NewDomainError(errors.ErrRequired, errors.Default, "search index fields")
+	}
+
+	for _, path := range index.Fields {
+		parent := ""
+
+		for _, name := range strings.Split(path, ".") {
+			if err := checkName(parent, name); err != nil {
+				return err
+			}
+
+			parent = join(parent, name)
+		}
+	}
+
+	if index.Prefixes < 0 || index.Prefixes > maxPrefix {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, "search index prefixes", "a length up to 15")
+	}
+
+	if index.StopWords == nil {
+		index.StopWords = DefaultStopWords
+	}
+
+	index.Fields = append([]string(nil), index.Fields...)
+	index.stopWords = names(index.StopWords)
+
+	searchMu.Lock()
+	defer searchMu.Unlock()
+
+	searches[collection] = &index
+
+	return nil
+}
+
+// SearchIndexOf provides the SearchIndex registered for the collection.
+func SearchIndexOf(collection string) (*SearchIndex, bool) {
+	searchMu.RLock()
+	defer searchMu.RUnlock()
+
+	index, ok := searches[collection]
+
+	return index, ok
+}
+
+// SearchCollection provides the name of the collection holding the postings of the SearchIndex of the
+// collection.
+func SearchCollection(collection string) string {
+	return collection + searchSuffix
+}
+
+// SearchIndexes provides the indexes of the postings of the search index of each collection, by the name of the
+// collection of the postings.
+func SearchIndexes() map[string][]mongo.IndexModel {
+	searchMu.RLock()
+	defer searchMu.RUnlock()
+
+	indexes := make(map[string][]mongo.IndexModel)
+
+	for coll := range searches {
+		indexes[SearchCollection(coll)] = []mongo.IndexModel{
+			{Keys: bson.D{{Key: "term", Value: 1}, {Key: "doc", Value: 1}}},
+			{Keys: bson.D{{Key: "doc", Value: 1}}},
+		}
+	}
+
+	return indexes
+}
+
+// Postings provides the postings of the document: a document of the collection of the postings for each term
+// of the indexed fields, holding the term, the id of the document and the number of times the term occurs.
+func (s *SearchIndex) Postings(id interface{}, doc bson.M) []interface{} {
+	freq := make(map[string]int)
+
+	for _, path := range s.Fields {
+		v := lookup(doc, path)
+
+		values, ok := array(v)
+		if !ok {
+			values = []interface{}{v}
+		}
+
+		for _, value := range values {
+			text, ok := str(value)
+			if !ok {
+				continue
+			}
+
+			for _, keyword := range s.keywords(text) {
+				for _, term := range s.terms(keyword) {
+					freq[term]++
+				}
+			}
+		}
+	}
+
+	terms := make([]string, 0, len(freq))
+	for term := range freq {
+		terms = append(terms, term)
+	}
+
+	sort.Strings(terms)
+
+	postings := make([]interface{}, 0, len(terms))
+	for _, term := range terms {
+		postings = append(postings, bson.M{"term": term, "doc": id, "tf": freq[term]})
+	}
+
+	return postings
+}
+
+// Terms provides the distinct terms searched for by the keywords of a Text filter; a document matches when it
+// holds every term.
+func (s *SearchIndex) Terms(keywords string) []string {
+	seen := make(map[string]bool)
+
+	var terms []string
+
+	for _, keyword := range s.keywords(keywords) {
+		if !seen[keyword] {
+			seen[keyword] = true
+			terms = append(terms, keyword)
+		}
+	}
+
+	return terms
+}
+
+// keywords splits the value into its lower cased runs of letters and digits, dropping stop words.
+func (s *SearchIndex) keywords(value string) []string {
+	words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	keywords := words[:0]
+
+	for _, w := range words {
+		if !s.stopWords[w] {
+			keywords = append(keywords, w)
+		}
+	}
+
+	return keywords
+}
+
+// terms provides the keyword along with its indexed prefixes.
+func (s *SearchIndex) terms(keyword string) []string {
+	terms := []string{keyword}
+
+	if s.Prefixes == 0 {
+		return terms
+	}
+
+	runes := []rune(keyword)
+
+	for n := s.Prefixes; n < len(runes) && n <= maxPrefix; n++ {
+		terms = append(terms, string(runes[:n]))
+	}
+
+	return terms
+}
+
+// TextFilter provides the keywords of the Text filter of the search Query, when it has one; a value other than
+// a string has no keywords.
+func TextFilter(q *search.Query) (string, bool) {
+	if q == nil {
+		return "", false
+	}
+
+	for _, f := range q.Filters() {
+		if isText(f) {
+			keywords, _ := str(f.Value)
+
+			return keywords, true
+		}
+	}
+
+	return "", false
+}
+
+func names(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+
+	return set
+}
@@ -0,0 +1,426 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/text/unicode/norm"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// shadowRoot is the field holding the shadow fields of a document; it cannot be written by callers and is
+// removed from the documents read.
+const shadowRoot = "_shadow"
+
+// Normalization derives the value of a shadow field from the value of its field.
+type Normalization int
+
+// Supported normalizations.
+const (
+	// Lowercase maps the value to lower case.
+	Lowercase Normalization = iota
+	// Fold maps the value to lower case and removes diacritics, so that "Émile" and "EMILE" are equal.
+	Fold
+)
+
+func (n Normalization) normalize(s string) string {
+	if n != Fold {
+		return strings.ToLower(s)
+	}
+
+	var b strings.Builder
+
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			// lower casing the upper case folds characters with several lower case forms, such as 'ς' and 'σ'
+			b.WriteRune(unicode.ToLower(unicode.ToUpper(r)))
+		}
+	}
+
+	return b.String()
+}
+
+// ShadowField is a normalized copy of a string field, or of each string of an array field, maintained on every
+// write. IgnoreCase and Like filters on the field are translated by Filters into conditions on the shadow field,
+// which can use its index, rather than into case-insensitive regular expressions, which cannot.
+type ShadowField struct {
+	// Path is the path of the field in dot notation.
+	Path          string
+	Normalization Normalization
+}
+
+// Shadow provides the path of the shadow field.
+func (f ShadowField) Shadow() string {
+	return shadowRoot + "." + f.Path
+}
+
+var (
+	shadowsMu sync.RWMutex
+	shadows   = make(map[string][]ShadowField)
+)
+
+// RegisterShadowFields maintains the shadow fields within the documents written to the collection, replacing
+// the shadow fields registered before. Fields holding encrypted values cannot have a shadow field. The documents
+// written before lack the shadow fields, so filters on their fields do not match them until
+// Datastore.RebuildShadowFields sets them.
+func RegisterShadowFields(collection string, fields ...ShadowField) error {
+	for i, f := range fields {
+		parent := ""
+
+		for _, name := range strings.Split(f.Path, ".") {
+			if err := checkName(parent, name); err != nil {
+				return err
+			}
+
+			parent = join(parent, name)
+		}
+
+		if overlaps(f.Path, shadowRoot) {
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, f.Path, "a path outside "+shadowRoot)
+		}
+
+		for _, other := range fields[:i] {
+			if overlaps(f.Path, other.Path) {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, f.Path, "a path that is not a parent or child of "+other.Path)
+			}
+		}
+	}
+
+	shadowsMu.Lock()
+	defer shadowsMu.Unlock()
+
+	shadows[collection] = append([]ShadowField(nil), fields...)
+
+	return nil
+}
+
+// ShadowFields provides the shadow fields registered for the collection.
+func ShadowFields(collection string) []ShadowField {
+	shadowsMu.RLock()
+	defer shadowsMu.RUnlock()
+
+	return shadows[collection]
+}
+
+// ShadowIndexes provides the indexes of the shadow fields of each collection.
+func ShadowIndexes() map[string][]mongo.IndexModel {
+	shadowsMu.RLock()
+	defer shadowsMu.RUnlock()
+
+	indexes := make(map[string][]mongo.IndexModel)
+
+	for coll, fields := range shadows {
+		for _, f := range fields {
+			indexes[coll] = append(indexes[coll], mongo.IndexModel{Keys: bson.D{{Key: f.Shadow(), Value: 1}}})
+		}
+	}
+
+	return indexes
+}
+
+// Normalize provides the document with the shadow fields of the collection set from their fields; the shadow
+// fields of fields that are missing, or do not hold a string or an array, are omitted.
+func Normalize(collection string, doc bson.M) (bson.M, error) {
+	fields := ShadowFields(collection)
+	if len(fields) == 0 {
+		return doc, nil
+	}
+
+	if _, ok := doc[shadowRoot]; ok {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, shadowRoot, "a field other than the shadow fields")
+	}
+
+	shadow := bson.M{}
+
+	for _, f := range fields {
+		if v, ok := f.value(lookup(doc, f.Path)); ok {
+			place(shadow, f.Path, v)
+		}
+	}
+
+	out := make(bson.M, len(doc)+1)
+	for k, v := range doc {
+		out[k] = v
+	}
+
+	if len(shadow) > 0 {
+		out[shadowRoot] = shadow
+	}
+
+	return out, nil
+}
+
+// NormalizeUpdate adds the operations maintaining the shadow fields of the collection to the Update: the shadow
+// field is set along with its field, or a parent of its field, and unset when the field is unset or no longer
+// holds a string or an array. The other operators only apply to fields set as a whole, so they cannot modify
+// fields with a shadow field.
+func NormalizeUpdate(collection string, u *Update) error {
+	fields := ShadowFields(collection)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	for _, path := range u.Paths() {
+		if overlaps(path, shadowRoot) {
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, path, "a path outside "+shadowRoot)
+		}
+
+		_, set := u.Set[path]
+		_, setOnInsert := u.SetOnInsert[path]
+		_, unset := u.Unset[path]
+
+		for _, f := range fields {
+			if overlaps(path, f.Path) && !set && !setOnInsert && !unset {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, path, "a path set as a whole as it has a shadow field")
+			}
+		}
+	}
+
+	for _, f := range fields {
+		for path := range u.Unset {
+			switch {
+			case path == f.Path || strings.HasPrefix(path, f.Path+"."):
+				u.Unset[shadowRoot+"."+path] = ""
+			case strings.HasPrefix(f.Path, path+"."):
+				u.Unset[f.Shadow()] = ""
+			}
+		}
+
+		for path, v := range u.Set {
+			if shadow, v, ok := f.mirror(path, v); ok {
+				if v, ok := f.value(v); ok {
+					u.Set[shadow] = v
+				} else {
+					u.Unset[shadow] = ""
+				}
+			}
+		}
+
+		// an inserted document only has the shadow fields of the fields it holds
+		for path, v := range u.SetOnInsert {
+			if shadow, v, ok := f.mirror(path, v); ok {
+				if v, ok := f.value(v); ok {
+					u.SetOnInsert[shadow] = v
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// mirror provides the path of the shadow field set along with the value at the path, and the value of the field
+// within it, when the path is the field, a parent or a child of the field.
+func (f ShadowField) mirror(path string, v interface{}) (string, interface{}, bool) {
+	switch {
+	case path == f.Path || strings.HasPrefix(path, f.Path+"."):
+		return shadowRoot + "." + path, v, true
+	case strings.HasPrefix(f.Path, path+"."):
+		return f.Shadow(), lookup(v, strings.TrimPrefix(f.Path, path+".")), true
+	}
+
+	return "", nil, false
+}
+
+// value normalizes a string, or each string of an array; other values have no shadow.
+func (f ShadowField) value(v interface{}) (interface{}, bool) {
+	if s, ok := str(v); ok {
+		return f.Normalization.normalize(s), true
+	}
+
+	items, ok := array(v)
+	if !ok {
+		return nil, false
+	}
+
+	normalized := make(bson.A, 0, len(items))
+
+	for _, item := range items {
+		if s, ok := str(item); ok {
+			normalized = append(normalized, f.Normalization.normalize(s))
+		} else {
+			normalized = append(normalized, item)
+		}
+	}
+
+	return normalized, true
+}
+
+// ShadowBackfill provides the filter and the update setting the shadow fields of the collection within the
+// document read from it, which holds its _id and the fields with a shadow field. The filter only matches the
+// document while its fields hold the values read, as a document written since maintains its shadow fields.
+func ShadowBackfill(collection string, doc bson.M) (bson.M, bson.M) {
+	filter := bson.M{"_id": doc["_id"]}
+	shadow := bson.M{}
+
+	for _, f := range ShadowFields(collection) {
+		v, ok := find(doc, f.Path)
+
+		switch _, isObject := object(v); {
+		case !ok:
+			filter[f.Path] = bson.M{"$exists": false}
+		case isObject:
+			filter[f.Path] = bson.M{"$type": "object"}
+		default:
+			filter[f.Path] = bson.M{"$eq": v}
+		}
+
+		if v, ok := f.value(v); ok {
+			place(shadow, f.Path, v)
+		}
+	}
+
+	if len(shadow) == 0 {
+		return filter, bson.M{"$unset": bson.M{shadowRoot: ""}}
+	}
+
+	return filter, bson.M{"$set": bson.M{shadowRoot: shadow}}
+}
+
+// RemoveShadows removes the shadow fields from a document read from a collection.
+func RemoveShadows(doc bson.M) bson.M {
+	delete(doc, shadowRoot)
+
+	return doc
+}
+
+// Filters translates the filters of the search Query into a filter of the collection like dbutil.Filters, along
+// with the Text and geo filters of the Datastore, except that IgnoreCase and Like filters on fields with a shadow
+// field are translated into conditions on the shadow field: IgnoreCase into equality and Like into the range of
+// the values starting with the prefix. Both can use an index of the shadow field, unlike the case-insensitive
+// regular expressions of dbutil.Filters.
+func Filters(collection string, q *search.Query) bson.M {
+	qf := queryFilters(q)
+
+	fields := ShadowFields(collection)
+	if len(fields) == 0 {
+		return qf
+	}
+
+	for k, f := range q.Filters() {
+		if !f.IgnoreCase() && !f.Like() {
+			continue
+		}
+
+		s, ok := str(dbutil.Value(f.Value))
+		if !ok {
+			continue
+		}
+
+		for _, sf := range fields {
+			if sf.Path != k {
+				continue
+			}
+
+			v := sf.Normalization.normalize(s)
+
+			delete(qf, k)
+
+			if f.IgnoreCase() {
+				qf[sf.Shadow()] = bson.M{"$eq": v}
+			} else {
+				qf[sf.Shadow()] = prefixRange(v)
+			}
+		}
+	}
+
+	return qf
+}
+
+// prefixRange matches the strings starting with the prefix.
+func prefixRange(prefix string) bson.M {
+	r := bson.M{"$gte": prefix}
+
+	// strings are compared by their UTF-8 bytes, which order them as their code points
+	runes := []rune(prefix)
+
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == unicode.MaxRune {
+			continue
+		}
+
+		runes[i]++
+		if runes[i] >= 0xD800 && runes[i] <= 0xDFFF {
+			// surrogates cannot be encoded
+			runes[i] = 0xE000
+		}
+
+		r["$lt"] = string(runes[:i+1])
+
+		break
+	}
+
+	return r
+}
+
+// overlaps determines if the paths are equal or one is a parent of the other.
+func overlaps(path, other string) bool {
+	return path == other || strings.HasPrefix(path, other+".") || strings.HasPrefix(other, path+".")
+}
+
+// lookup provides the value at the path in dot notation within the document; nil when missing.
+func lookup(v interface{}, path string) interface{} {
+	for _, name := range strings.Split(path, ".") {
+		doc, ok := object(v)
+		if !ok {
+			return nil
+		}
+
+		v = doc[name]
+	}
+
+	return v
+}
+
+// find provides the value at the path in dot notation within the document, and whether it exists.
+func find(v interface{}, path string) (interface{}, bool) {
+	for _, name := range strings.Split(path, ".") {
+		doc, ok := object(v)
+		if !ok {
+			return nil, false
+		}
+
+		if v, ok = doc[name]; !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// place sets the value at the path in dot notation within the document, creating the parent documents.
+func place(doc bson.M, path string, v interface{}) {
+	names := strings.Split(path, ".")
+
+	for _, name := range names[:len(names)-1] {
+		child, ok := doc[name].(bson.M)
+		if !ok {
+			child = bson.M{}
+			doc[name] = child
+		}
+
+		doc = child
+	}
+
+	doc[names[len(names)-1]] = v
+}
+
+// str provides the string of a string, or of a named string type such as strfmt.Email.
+func str(v interface{}) (string, bool) {
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+		return rv.String(), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPrefixRange(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		prefix string
+		want   bson.M
+	}{
+		{"ascii", "ann", bson.M{"$gte": "ann", "$lt": "ano"}},
+		{"accented", "é", bson.M{"$gte": "é", "$lt": "ê"}},
+		{"before surrogates", "a\uD7FF", bson.M{"$gte": "a\uD7FF", "$lt": "a\uE000"}},
+		{"max rune", "a" + string(unicode.MaxRune), bson.M{"$gte": "a" + string(unicode.MaxRune), "$lt": "b"}},
+		{"only max runes", string(unicode.MaxRune), bson.M{"$gte": string(unicode.MaxRune)}},
+		{"empty", "", bson.M{"$gte": ""}},
+	} {
+		if got := prefixRange(tc.prefix); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: prefixRange(%q) = %q, want %q", tc.name, tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func TestShadowBackfill(t *testing.T) {
+	if err := RegisterShadowFields("shadow_backfill",
+		ShadowField{Path: "name", Normalization: Fold},
+		ShadowField{Path: "address.city"},
+		ShadowField{Path: "tags"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, update := ShadowBackfill("shadow_backfill", bson.M{
+		"_id":     1,
+		"name":    "Émile",
+		"address": bson.M{"city": nil},
+		"tags":    bson.A{"A", 2},
+	})
+
+	wantFilter := bson.M{
+		"_id":          1,
+		"name":         bson.M{"$eq": "Émile"},
+		"address.city": bson.M{"$eq": nil},
+		"tags":         bson.M{"$eq": bson.A{"A", 2}},
+	}
+	if !reflect.DeepEqual(filter, wantFilter) {
+		t.Errorf("ShadowBackfill() filter = %v, want %v", filter, wantFilter)
+	}
+
+	wantUpdate := bson.M{"$set": bson.M{shadowRoot: bson.M{"name": "emile", "tags": bson.A{"a", 2}}}}
+	if !reflect.DeepEqual(update, wantUpdate) {
+		t.Errorf("ShadowBackfill() update = %v, want %v", update, wantUpdate)
+	}
+
+	filter, update = ShadowBackfill("shadow_backfill", bson.M{"_id": 2, "address": "Main Street"})
+
+	wantFilter = bson.M{
+		"_id":          2,
+		"name":         bson.M{"$exists": false},
+		"address.city": bson.M{"$exists": false},
+		"tags":         bson.M{"$exists": false},
+	}
+	if !reflect.DeepEqual(filter, wantFilter) {
+		t.Errorf("ShadowBackfill() filter = %v, want %v", filter, wantFilter)
+	}
+
+	wantUpdate = bson.M{"$unset": bson.M{shadowRoot: ""}}
+	if !reflect.DeepEqual(update, wantUpdate) {
+		t.Errorf("ShadowBackfill() update = %v, want %v", update, wantUpdate)
+	}
+}
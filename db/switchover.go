@@ -0,0 +1,63 @@
+package db
+
+import (
+	"time"
+
+	"gitscm.cisco.com/mcmp/errors"
+)
+
+// Defaults applied to a SwitchoverPlan.
+const (
+	DefaultCanaryDuration = time.Minute
+	DefaultObserve        = 5 * time.Minute
+	DefaultMaxErrorRate   = 0.05
+)
+
+// SwitchoverPlan describes how a Datastore cuts over from its current configurations to its future configurations.
+type SwitchoverPlan struct {
+	// Indexes lists the names of the indexes, by collection, that must exist before traffic is moved.
+	Indexes map[string][]string
+
+	// CanaryPercent is the percentage of reads sent to the future configurations before all traffic is moved;
+	// zero moves all traffic at once.
+	CanaryPercent int
+	// CanaryDuration is how long the canary runs before all traffic is moved.
+	CanaryDuration time.Duration
+
+	// Observe is how long after all traffic is moved the current configurations remain available for a rollback.
+	Observe time.Duration
+	// MaxErrorRate is the fraction of commands failing due to the network or the servers, within the canary or
+	// observation, that triggers a rollback. Commands rejected by the servers, such as for a duplicate key, are
+	// not counted as failed.
+	MaxErrorRate float64
+}
+
+// Validate checks the values of the plan are within range.
+func (p SwitchoverPlan) Validate() error {
+	if p.CanaryPercent < 0 || p.CanaryPercent > 100 {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, "canary percent", "a percentage from 0 to 100")
+	}
+
+	if p.MaxErrorRate < 0 || p.MaxErrorRate > 1 {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, "max error rate", "a fraction from 0 to 1")
+	}
+
+	return nil
+}
+
+// WithDefaults returns a copy of the plan with the defaults applied to any unset values.
+func (p SwitchoverPlan) WithDefaults() SwitchoverPlan {
+	if p.CanaryDuration <= 0 {
+		p.CanaryDuration = DefaultCanaryDuration
+	}
+
+	if p.Observe <= 0 {
+		p.Observe = DefaultObserve
+	}
+
+	if p.MaxErrorRate <= 0 {
+		p.MaxErrorRate = DefaultMaxErrorRate
+	}
+
+	return p
+}
@@ -0,0 +1,244 @@
+package db
+
+import (
+	"sort"
+	"strings"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Update is an atomic update of a document, created from UpdateOps by NewUpdate or translated from a JSON Merge
+// Patch (RFC 7396) or a JSON Patch (RFC 6902) by ParsePatch.
+type Update struct {
+	// Set, Unset, Inc, Push, AddToSet, Pull, Pop, Rename and SetOnInsert hold the fields of the update operator
+	// of the same name.
+	Set         bson.M
+	Unset       bson.M
+	Inc         bson.M
+	Push        bson.M
+	AddToSet    bson.M
+	Pull        bson.M
+	Pop         bson.M
+	Rename      bson.M
+	SetOnInsert bson.M
+	// Conditions must be satisfied by the document for the update to apply; they come from the test
+	// operations and from the paths that must exist to be removed, replaced or moved.
+	Conditions []bson.M
+
+	paths []string
+}
+
+func newUpdate() *Update {
+	return &Update{
+		Set:         bson.M{},
+		Unset:       bson.M{},
+		Inc:         bson.M{},
+		Push:        bson.M{},
+		AddToSet:    bson.M{},
+		Pull:        bson.M{},
+		Pop:         bson.M{},
+		Rename:      bson.M{},
+		SetOnInsert: bson.M{},
+	}
+}
+
+// push adds the value to the array at the position; at the end when negative.
+func (u *Update) push(path string, v interface{}, position int) error {
+	if position < 0 {
+		if p, ok := u.Push[path].(bson.M); ok && p["$position"] == nil {
+			// consecutive appends to the same array are combined
+			p["$each"] = append(p["$each"].(bson.A), v)
+
+			return nil
+		}
+
+		u.Push[path] = bson.M{"$each": bson.A{v}}
+	} else {
+		u.Push[path] = bson.M{"$each": bson.A{v}, "$position": position}
+	}
+
+	return u.modify(path)
+}
+
+// require adds a condition for the path to exist.
+func (u *Update) require(path string) {
+	u.Conditions = append(u.Conditions, bson.M{path: bson.M{"$exists": true}})
+}
+
+// modify records the path as modified, rejecting paths already modified by another operation as the update
+// operators of a single update cannot conflict.
+func (u *Update) modify(path string) error {
+	if u.modified(path) {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, path, "a path modified by a single operation")
+	}
+
+	u.paths = append(u.paths, path)
+
+	return nil
+}
+
+// modified determines if the path, a parent or a child of the path has been modified.
+func (u *Update) modified(path string) bool {
+	for _, p := range u.paths {
+		if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Paths provides the paths modified by the Update, in dot notation.
+func (u *Update) Paths() []string {
+	paths := append([]string(nil), u.paths...)
+	sort.Strings(paths)
+
+	return paths
+}
+
+// Operators provides the update operators of the Update; empty when the Update only holds conditions.
+func (u *Update) Operators() bson.M {
+	ops := bson.M{}
+
+	for op, fields := range map[string]bson.M{
+		"$set":         u.Set,
+		"$unset":       u.Unset,
+		"$inc":         u.Inc,
+		"$push":        u.Push,
+		"$addToSet":    u.AddToSet,
+		"$pull":        u.Pull,
+		"$pop":         u.Pop,
+		"$rename":      u.Rename,
+		"$setOnInsert": u.SetOnInsert,
+	} {
+		if len(fields) > 0 {
+			ops[op] = fields
+		}
+	}
+
+	return ops
+}
+
+// Filter combines the filter with the Conditions of the Update.
+func (u *Update) Filter(filter bson.M) bson.M {
+	if len(u.Conditions) == 0 {
+		return filter
+	}
+
+	clauses := bson.A{filter}
+	for _, c := range u.Conditions {
+		clauses = append(clauses, c)
+	}
+
+	return bson.M{"$and": clauses}
+}
+
+// checkName verifies the member name can be addressed using dot notation; the id cannot be updated.
+func checkName(parent, name string) error {
+	switch {
+	case name == "" || strings.Contains(name, ".") || strings.HasPrefix(name, "$"):
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, join(parent, name), "a member name without dots or a leading $")
+	case parent == "" && name == "_id":
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, name, "a member other than the id")
+	}
+
+	return nil
+}
+
+// UpdateOp adds an operation on a field, given by its path in dot notation, to an Update.
+type UpdateOp func(u *Update) error
+
+// NewUpdate creates an Update from the operations; a path cannot be modified by more than one operation.
+func NewUpdate(ops ...UpdateOp) (*Update, error) {
+	u := newUpdate()
+
+	for _, op := range ops {
+		if err := op(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// Set sets the field to the value.
+func Set(path string, v interface{}) UpdateOp {
+	return field(path, func(u *Update) {
+		u.Set[path] = v
+	})
+}
+
+// Unset removes the field.
+func Unset(path string) UpdateOp {
+	return field(path, func(u *Update) {
+		u.Unset[path] = ""
+	})
+}
+
+// Increment adds the number, which may be negative, to the field; a missing field is set to the number.
+func Increment(path string, by interface{}) UpdateOp {
+	return func(u *Update) error {
+		switch by.(type) {
+		case int, int32, int64, float64:
+		default:
+			return errors.NewDomainError(errors.ErrInvalid, errors.Default, "increment of "+path, "an int, int32, int64 or float64")
+		}
+
+		return field(path, func(u *Update) {
+			u.Inc[path] = by
+		})(u)
+	}
+}
+
+// Push appends the values to the array of the field; a missing field is set to an array of the values.
+func Push(path string, values ...interface{}) UpdateOp {
+	return field(path, func(u *Update) {
+		u.Push[path] = bson.M{"$each": bson.A(values)}
+	})
+}
+
+// AddToSet appends the values not already present to the array of the field.
+func AddToSet(path string, values ...interface{}) UpdateOp {
+	return field(path, func(u *Update) {
+		u.AddToSet[path] = bson.M{"$each": bson.A(values)}
+	})
+}
+
+// Pull removes the elements of the array of the field equal to the value or, when the value is a document of
+// query operators such as bson.M{"$lt": 5}, matching the condition.
+func Pull(path string, condition interface{}) UpdateOp {
+	return field(path, func(u *Update) {
+		u.Pull[path] = condition
+	})
+}
+
+// SetOnInsert sets the field to the value only when the update inserts the document; see WithUpsert.
+func SetOnInsert(path string, v interface{}) UpdateOp {
+	return field(path, func(u *Update) {
+		u.SetOnInsert[path] = v
+	})
+}
+
+// field checks the path before adding the operation to the Update.
+func field(path string, add func(u *Update)) UpdateOp {
+	return func(u *Update) error {
+		parent := ""
+
+		for _, name := range strings.Split(path, ".") {
+			if err := checkName(parent, name); err != nil {
+				return err
+			}
+
+			parent = join(parent, name)
+		}
+
+		if err := u.modify(path); err != nil {
+			return err
+		}
+
+		add(u)
+
+		return nil
+	}
+}
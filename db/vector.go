@@ -0,0 +1,360 @@
+package db
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Similarity measures how near two vectors are.
+type Similarity string
+
+// Supported similarities.
+const (
+	// Cosine is the cosine of the angle between the vectors; the larger, the nearer.
+	Cosine Similarity = "cosine"
+	// Euclidean is the euclidean distance between the vectors; the smaller, the nearer.
+	Euclidean Similarity = "euclidean"
+	// DotProduct is the dot product of the vectors; the larger, the nearer.
+	DotProduct Similarity = "dotProduct"
+)
+
+// score measures the similarity of the vectors, which have the same dimensions.
+func (s Similarity) score(a, b []float64) float64 {
+	var dot, normA, normB, dist float64
+
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+		dist += (a[i] - b[i]) * (a[i] - b[i])
+	}
+
+	switch s {
+	case Euclidean:
+		return math.Sqrt(dist)
+	case DotProduct:
+		return dot
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// nearer determines if the score a is nearer than the score b.
+func (s Similarity) nearer(a, b float64) bool {
+	if s == Euclidean {
+		return a < b
+	}
+
+	return a > b
+}
+
+// VectorField is a field holding an embedding, an array of numbers of fixed dimensions, searched by KNN queries.
+type VectorField struct {
+	// Path is the path of the field in dot notation.
+	Path       string
+	Dimensions int
+	Similarity Similarity
+}
+
+// IndexSpec provides the specification of the vector index of the field, as created by the createIndexes
+// command of servers supporting vector search.
+func (f VectorField) IndexSpec() bson.D {
+	return bson.D{
+		{Key: "key", Value: bson.D{{Key: f.Path, Value: "vector"}}},
+		{Key: "name", Value: f.Path + "_vector"},
+		{Key: "vectorOptions", Value: bson.D{
+			{Key: "type", Value: "hnsw"},
+			{Key: "dimensions", Value: f.Dimensions},
+			{Key: "similarity", Value: string(f.Similarity)},
+		}},
+	}
+}
+
+// SearchStage provides the aggregation stage finding the k nearest documents to the vector using the vector
+// index of the field.
+func (f VectorField) SearchStage(vector []float64, k int) bson.D {
+	return bson.D{{Key: "$search", Value: bson.D{{Key: "vectorSearch", Value: bson.D{
+		{Key: "vector", Value: vector},
+		{Key: "path", Value: f.Path},
+		{Key: "similarity", Value: string(f.Similarity)},
+		{Key: "k", Value: k},
+	}}}}}
+}
+
+var (
+	vectorsMu sync.RWMutex
+	vectors   = make(map[string][]VectorField)
+)
+
+// RegisterVectorField declares a vector field of the collection, replacing the one declared before at its path.
+func RegisterVectorField(collection string, field VectorField) error {
+	parent := ""
+
+	for _, name := range strings.Split(field.Path, ".") {
+		if err := checkName(parent, name); err != nil {
+			return err
+		}
+
+		parent = join(parent, name)
+	}
+
+	if field.Dimensions <= 0 {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, "dimensions of "+field.Path, "a positive number")
+	}
+
+	switch field.Similarity {
+	case Cosine, Euclidean, DotProduct:
+	default:
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, "similarity of "+field.Path, "cosine, euclidean or dotProduct")
+	}
+
+	vectorsMu.Lock()
+	defer vectorsMu.Unlock()
+
+	fields := vectors[collection][:0:0]
+	for _, f := range vectors[collection] {
+		if f.Path != field.Path {
+			fields = append(fields, f)
+		}
+	}
+
+	vectors[collection] = append(fields, field)
+
+	return nil
+}
+
+// VectorFieldOf provides the vector field of the collection at the path.
+func VectorFieldOf(collection, path string) (VectorField, bool) {
+	vectorsMu.RLock()
+	defer vectorsMu.RUnlock()
+
+	for _, f := range vectors[collection] {
+		if f.Path == path {
+			return f, true
+		}
+	}
+
+	return VectorField{}, false
+}
+
+// VectorFields provides the vector fields of each collection.
+func VectorFields() map[string][]VectorField {
+	vectorsMu.RLock()
+	defer vectorsMu.RUnlock()
+
+	fields := make(map[string][]VectorField, len(vectors))
+	for coll, f := range vectors {
+		fields[coll] = append([]VectorField(nil), f...)
+	}
+
+	return fields
+}
+
+// VectorQuery finds the K documents whose vector field is nearest to the Vector.
+type VectorQuery struct {
+	// Path is the path of the vector field of the collection.
+	Path   string
+	Vector []float64
+	K      int
+	// Query filters the documents and selects their fields; its order and page are not applied and it cannot
+	// hold a Text filter.
+	Query *search.Query
+}
+
+// Field provides the vector field of the collection searched by the VectorQuery, verifying the query.
+func (vq *VectorQuery) Field(collection string) (VectorField, error) {
+	field, ok := VectorFieldOf(collection, vq.Path)
+	if !ok {
+		return VectorField{}, errors.NewDomainError(errors.ErrInvalid, errors.Default, vq.Path, "a vector field of "+collection)
+	}
+
+	if len(vq.Vector) != field.Dimensions {
+		return VectorField{}, errors.NewDomainError(errors.ErrInvalid, errors.Default, "vector", "a vector of the dimensions of "+vq.Path)
+	}
+
+	if vq.K <= 0 {
+		return VectorField{}, errors.NewDomainError(errors.ErrInvalid, errors.Default, "k", "a positive number")
+	}
+
+	if _, ok := TextFilter(vq.Query); ok {
+		return VectorField{}, errors.NewDomainError(errors.ErrInvalid, errors.Default, "text filter", "a filter of a query other than a vector query")
+	}
+
+	if err := CheckGeoFilters(collection, vq.Query); err != nil {
+		return VectorField{}, err
+	}
+
+	return field, nil
+}
+
+// Neighbor is a document found by a VectorQuery along with the score of its vector; see Similarity.
+type Neighbor struct {
+	Document bson.M
+	Score    float64
+}
+
+// KNN collects the documents nearest to a vector, holding no more than k documents at a time. Documents with an
+// equal score are ranked in the order they were added.
+type KNN struct {
+	field  VectorField
+	vector []float64
+	k      int
+	added  int
+	found  neighbors
+}
+
+// NewKNN creates a KNN of the k documents whose vector field is nearest to the vector.
+func NewKNN(field VectorField, vector []float64, k int) *KNN {
+	return &KNN{field: field, vector: vector, k: k, found: neighbors{field: field}}
+}
+
+// Add ranks the document; documents without a vector of the dimensions of the field are skipped.
+func (n *KNN) Add(doc bson.M) {
+	v, ok := embedding(lookup(doc, n.field.Path), n.field.Dimensions)
+	if !ok {
+		return
+	}
+
+	n.added++
+	heap.Push(&n.found, candidate{Neighbor: Neighbor{Document: doc, Score: n.field.Similarity.score(n.vector, v)}, order: n.added})
+
+	if n.found.Len() > n.k {
+		heap.Pop(&n.found)
+	}
+}
+
+// Neighbors provides the documents nearest to the vector, nearest first.
+func (n *KNN) Neighbors() []Neighbor {
+	ranked := append([]candidate(nil), n.found.items...)
+
+	sort.Slice(ranked, func(i, j int) bool {
+		return n.found.nearer(ranked[i], ranked[j])
+	})
+
+	out := make([]Neighbor, 0, len(ranked))
+	for _, c := range ranked {
+		out = append(out, c.Neighbor)
+	}
+
+	return out
+}
+
+// Nearest evaluates the VectorQuery over the documents in process, with the semantics of KNN queries of the
+// Datastore scanning the collection: the documents matching the filters of the query are ranked by the
+// similarity of their vector and hold the fields selected by the query.
+func Nearest(collection string, vq *VectorQuery, docs []bson.M) ([]Neighbor, error) {
+	field, err := vq.Field(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	knn := NewKNN(field, vq.Vector, vq.K)
+
+	for _, doc := range docs {
+		if Matches(vq.Query, doc) {
+			knn.Add(doc)
+		}
+	}
+
+	found := knn.Neighbors()
+
+	if vq.Query != nil {
+		for i := range found {
+			found[i].Document = SelectFields(found[i].Document, vq.Query.Fields())
+		}
+	}
+
+	return found, nil
+}
+
+// SelectFields provides the id and the fields, in dot notation, of the document; the document itself when no
+// fields are selected.
+func SelectFields(doc bson.M, fields []string) bson.M {
+	if len(fields) == 0 {
+		return doc
+	}
+
+	out := bson.M{}
+
+	if id, ok := doc[pk]; ok {
+		out[pk] = id
+	}
+
+	for _, f := range fields {
+		if f == idRef {
+			f = pk
+		}
+
+		if v := lookup(doc, f); v != nil {
+			place(out, f, v)
+		}
+	}
+
+	return out
+}
+
+// embedding provides the vector held by the value; false unless it is an array of numbers of the dimensions.
+func embedding(v interface{}, dimensions int) ([]float64, bool) {
+	items, ok := array(v)
+	if !ok || len(items) != dimensions {
+		return nil, false
+	}
+
+	vector := make([]float64, 0, dimensions)
+
+	for _, item := range items {
+		f, ok := number(item)
+		if !ok {
+			return nil, false
+		}
+
+		vector = append(vector, f)
+	}
+
+	return vector, true
+}
+
+type candidate struct {
+	Neighbor
+	order int
+}
+
+// neighbors is a heap of candidates with the farthest at the top, so that it is the first removed.
+type neighbors struct {
+	field VectorField
+	items []candidate
+}
+
+func (h neighbors) nearer(a, b candidate) bool {
+	if a.Score != b.Score {
+		return h.field.Similarity.nearer(a.Score, b.Score)
+	}
+
+	return a.order < b.order
+}
+
+func (h neighbors) Len() int           { return len(h.items) }
+func (h neighbors) Less(i, j int) bool { return h.nearer(h.items[j], h.items[i]) }
+func (h neighbors) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *neighbors) Push(x interface{}) {
+	h.items = append(h.items, x.(candidate))
+}
+
+func (h *neighbors) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+
+	return last
+}
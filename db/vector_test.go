@@ -0,0 +1,104 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNearest(t *testing.T) {
+	if err := RegisterVectorField("vector_nearest", VectorField{Path: "embedding", Dimensions: 2, Similarity: Euclidean}); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []bson.M{
+		{"_id": 1, "kind": "a", "embedding": bson.A{0.0, 0.0}},
+		{"_id": 2, "kind": "b", "embedding": bson.A{1.0, 0.0}},
+		{"_id": 3, "kind": "a", "embedding": bson.A{3.0, 4.0}},
+		{"_id": 4, "kind": "a", "embedding": []float64{1.0, 1.0}},
+		{"_id": 5, "kind": "a", "embedding": bson.A{1.0}},
+		{"_id": 6, "kind": "a"},
+	}
+
+	filtered := search.NewQuery(search.Fields("kind"))
+	filtered.AddFilter("kind", "a")
+
+	for _, tc := range []struct {
+		name   string
+		vq     *VectorQuery
+		ids    []interface{}
+		scores []float64
+	}{
+		{
+			name:   "nearest first",
+			vq:     &VectorQuery{Path: "embedding", Vector: []float64{0, 0}, K: 3},
+			ids:    []interface{}{1, 2, 4},
+			scores: []float64{0, 1, 1.4142135623730951},
+		},
+		{
+			name:   "more than the documents",
+			vq:     &VectorQuery{Path: "embedding", Vector: []float64{3, 4}, K: 10},
+			ids:    []interface{}{3, 4, 2, 1},
+			scores: []float64{0, 3.605551275463989, 4.47213595499958, 5},
+		},
+		{
+			name:   "filtered",
+			vq:     &VectorQuery{Path: "embedding", Vector: []float64{1, 0}, K: 2, Query: filtered},
+			ids:    []interface{}{1, 4},
+			scores: []float64{1, 1},
+		},
+	} {
+		found, err := Nearest("vector_nearest", tc.vq, docs)
+		if err != nil {
+			t.Errorf("%s: Nearest() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		var ids []interface{}
+
+		var scores []float64
+
+		for _, n := range found {
+			ids = append(ids, n.Document["_id"])
+			scores = append(scores, n.Score)
+		}
+
+		if !reflect.DeepEqual(ids, tc.ids) || !reflect.DeepEqual(scores, tc.scores) {
+			t.Errorf("%s: Nearest() = %v %v, want %v %v", tc.name, ids, scores, tc.ids, tc.scores)
+		}
+
+		if tc.vq.Query != nil {
+			for _, n := range found {
+				if _, ok := n.Document["embedding"]; ok {
+					t.Errorf("%s: Nearest() document %v holds fields not selected", tc.name, n.Document)
+				}
+			}
+		}
+	}
+}
+
+func TestNearestInvalid(t *testing.T) {
+	if err := RegisterVectorField("vector_invalid", VectorField{Path: "embedding", Dimensions: 2, Similarity: Cosine}); err != nil {
+		t.Fatal(err)
+	}
+
+	text := search.NewQuery()
+	text.AddFilter(TextKey, "keywords", Text)
+
+	for _, tc := range []struct {
+		name string
+		vq   *VectorQuery
+	}{
+		{"unknown field", &VectorQuery{Path: "other", Vector: []float64{1, 0}, K: 1}},
+		{"dimensions", &VectorQuery{Path: "embedding", Vector: []float64{1, 0, 0}, K: 1}},
+		{"k", &VectorQuery{Path: "embedding", Vector: []float64{1, 0}}},
+		{"text filter", &VectorQuery{Path: "embedding", Vector: []float64{1, 0}, K: 1, Query: text}},
+	} {
+		if _, err := Nearest("vector_invalid", tc.vq, nil); err == nil {
+			t.Errorf("%s: Nearest() succeeded, want error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package docdb_poc
+
+import (
+	"context"
+
+	wraperrors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// countDocuments counts the documents of the collection matching the filter. Counting does not accept the
+// $nearSphere conditions of Near filters, so the documents matching a filter holding one are counted by a
+// $geoNear stage.
+func countDocuments(ctx context.Context, coll *mongo.Collection, filter bson.M) (int64, error) {
+	stage, ok := dbutil.GeoNear(filter)
+	if !ok {
+		n, err := coll.CountDocuments(ctx, filter)
+		if err != nil {
+			return 0, asDomainError(err, coll.Name(), "unable to count documents")
+		}
+
+		return n, nil
+	}
+
+	cur, err := coll.Aggregate(ctx, mongo.Pipeline{stage, {{Key: "$count", Value: "n"}}})
+	if err != nil {
+		return 0, asDomainError(err, coll.Name(), "unable to count documents")
+	}
+
+	var counted []struct {
+		N int64 `bson:"n"`
+	}
+	if err := cur.All(ctx, &counted); err != nil {
+		return 0, wraperrors.Wrap(err, "unable to read count")
+	}
+
+	if len(counted) == 0 {
+		return 0, nil
+	}
+
+	return counted[0].N, nil
+}
@@ -3,16 +3,25 @@ module docdb_poc
 go 1.19
 
 require (
+	github.com/asaskevich/govalidator v0.0.0-20200907205600-7a23bdc65eef
+	github.com/fsnotify/fsnotify v1.4.7
+	github.com/go-openapi/strfmt v0.19.12
+	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.9.0
-	gitscm.cisco.com/mcmp/db v0.6.0
+	github.com/spf13/cast v1.3.0
+	github.com/spf13/viper v1.7.1
+	github.com/youmark/pkcs8 v0.0.0-20181117223130-1be2e3e5546d
+	gitscm.cisco.com/ccdev/go-common v1.6.0
+	gitscm.cisco.com/mcmp/errors v0.7.0
+	gitscm.cisco.com/mcmp/utils v0.10.0
 	go.mongodb.org/mongo-driver v1.11.1
+	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d
+	golang.org/x/text v0.3.7
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 require (
-	github.com/asaskevich/govalidator v0.0.0-20200907205600-7a23bdc65eef // indirect
-	github.com/fsnotify/fsnotify v1.4.7 // indirect
 	github.com/go-openapi/errors v0.19.8 // indirect
-	github.com/go-openapi/strfmt v0.19.12 // indirect
 	github.com/golang/snappy v0.0.1 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/klauspost/compress v1.13.6 // indirect
@@ -20,24 +29,14 @@ require (
 	github.com/mitchellh/mapstructure v1.3.3 // indirect
 	github.com/montanaflynn/stats v0.0.0-20171201202039-1bf9dbcd8cbe // indirect
 	github.com/pelletier/go-toml v1.7.0 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
 	github.com/spf13/afero v1.1.2 // indirect
-	github.com/spf13/cast v1.3.0 // indirect
 	github.com/spf13/jwalterweatherman v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.3 // indirect
-	github.com/spf13/viper v1.7.1 // indirect
 	github.com/subosito/gotenv v1.2.0 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
 	github.com/xdg-go/scram v1.1.1 // indirect
 	github.com/xdg-go/stringprep v1.0.3 // indirect
-	github.com/youmark/pkcs8 v0.0.0-20181117223130-1be2e3e5546d // indirect
-	gitscm.cisco.com/ccdev/go-common v1.6.0 // indirect
-	gitscm.cisco.com/mcmp/errors v0.7.0 // indirect
-	gitscm.cisco.com/mcmp/utils v0.10.0 // indirect
-	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
-	golang.org/x/text v0.3.7 // indirect
 	gopkg.in/ini.v1 v1.51.0 // indirect
-	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
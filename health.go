@@ -0,0 +1,84 @@
+package docdb_poc
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+)
+
+func (c *client) HealthCheck(ctx context.Context) (*db.Health, error) {
+	dbc, done, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	h := &db.Health{Status: db.StatusOK}
+
+	if perr := dbc.Client().Ping(ctx, readpref.PrimaryPreferred()); perr != nil {
+		h.Status = db.StatusUnavailable
+		h.Error = perr.Error()
+		err = errUnavailable
+	} else {
+		c.lastPing.Store(time.Now().UnixNano())
+	}
+
+	if last := c.lastPing.Load(); last > 0 {
+		t := time.Unix(0, last).UTC()
+		h.LastPing = &t
+	}
+
+	if status, ok := dbutil.CurrentStatus(dbc); ok {
+		h.Credentials = status.Credentials
+		h.Topology = asTopology(status)
+		h.Pools = asPoolUsage(status.Pools)
+	}
+
+	return h, err
+}
+
+func asTopology(status *dbutil.Status) db.Topology {
+	t := db.Topology{
+		Kind:    status.Topology,
+		SetName: status.SetName,
+	}
+
+	if status.Primary != nil {
+		m := asMember(*status.Primary)
+		t.Primary = &m
+	}
+
+	for _, srv := range status.Secondaries {
+		t.Secondaries = append(t.Secondaries, asMember(srv))
+	}
+
+	return t
+}
+
+func asMember(srv dbutil.ServerStatus) db.Member {
+	return db.Member{
+		Address: srv.Address,
+		RTT:     srv.RTT,
+		Lag:     srv.Lag,
+	}
+}
+
+func asPoolUsage(pools []dbutil.PoolStatus) []db.PoolUsage {
+	usage := make([]db.PoolUsage, 0, len(pools))
+
+	for _, p := range pools {
+		usage = append(usage, db.PoolUsage{
+			Address: p.Address,
+			Total:   p.Total,
+			InUse:   p.InUse,
+			Failed:  p.Failed,
+			Limit:   p.Limit,
+		})
+	}
+
+	return usage
+}
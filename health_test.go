@@ -0,0 +1,119 @@
+package docdb_poc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+)
+
+func TestHealthCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		reachable bool
+		ping      func(bson.M) bson.M
+		status    string
+		lastPing  bool
+	}{
+		{"reachable", true, nil, db.StatusOK, true},
+		{"failed ping", true, func(bson.M) bson.M { return bson.M{"ok": 0.0, "code": int32(13), "errmsg": "unauthorized"} }, db.StatusUnavailable, false},
+		{"unreachable", false, nil, db.StatusUnavailable, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s *fakeServer
+			if tc.reachable {
+				s = newFakeServer(t)
+				if tc.ping != nil {
+					s.handle("ping", tc.ping)
+				}
+			}
+
+			c := newTestClient(t, s, false)
+
+			h, err := c.HealthCheck(context.Background())
+			if h == nil {
+				t.Fatalf("HealthCheck() = nil, %v", err)
+			}
+
+			if h.Status != tc.status || (err == nil) != (tc.status == db.StatusOK) {
+				t.Errorf("HealthCheck() = %q %v, want %q", h.Status, err, tc.status)
+			}
+
+			if (h.LastPing != nil) != tc.lastPing {
+				t.Errorf("HealthCheck() last ping = %v, want reported %t", h.LastPing, tc.lastPing)
+			}
+
+			if h.Credentials != dbutil.CredentialsNone {
+				t.Errorf("HealthCheck() credentials = %q, want %q", h.Credentials, dbutil.CredentialsNone)
+			}
+
+			if tc.status == db.StatusOK && len(h.Pools) == 0 {
+				t.Errorf("HealthCheck() pools = %v, want the pool of the server", h.Pools)
+			}
+		})
+	}
+}
+
+func TestHealthCheckKeepsLastPing(t *testing.T) {
+	c := newTestClient(t, nil, false)
+
+	last := time.Now().Add(-time.Minute)
+	c.lastPing.Store(last.UnixNano())
+
+	h, err := c.HealthCheck(context.Background())
+	if err != errUnavailable {
+		t.Errorf("HealthCheck() = %v, want errUnavailable", err)
+	}
+
+	if h.LastPing == nil || !h.LastPing.Equal(last) {
+		t.Errorf("HealthCheck() last ping = %v, want %v", h.LastPing, last)
+	}
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if h, err := c.HealthCheck(context.Background()); h != nil || err != errUnavailable {
+		t.Errorf("HealthCheck() of a closed client = %v %v, want errUnavailable", h, err)
+	}
+}
+
+func TestAsTopology(t *testing.T) {
+	lag := 2 * time.Second
+
+	for _, tc := range []struct {
+		name   string
+		status *dbutil.Status
+		want   db.Topology
+	}{
+		{
+			name:   "no primary",
+			status: &dbutil.Status{Topology: "ReplicaSetNoPrimary", SetName: "rs0"},
+			want:   db.Topology{Kind: "ReplicaSetNoPrimary", SetName: "rs0"},
+		},
+		{
+			name: "replica set",
+			status: &dbutil.Status{
+				Topology:    "ReplicaSetWithPrimary",
+				SetName:     "rs0",
+				Primary:     &dbutil.ServerStatus{Address: "db1:27017", RTT: time.Millisecond},
+				Secondaries: []dbutil.ServerStatus{{Address: "db2:27017", RTT: 3 * time.Millisecond, Lag: &lag}},
+			},
+			want: db.Topology{
+				Kind:        "ReplicaSetWithPrimary",
+				SetName:     "rs0",
+				Primary:     &db.Member{Address: "db1:27017", RTT: time.Millisecond},
+				Secondaries: []db.Member{{Address: "db2:27017", RTT: 3 * time.Millisecond, Lag: &lag}},
+			},
+		},
+	} {
+		if got := asTopology(tc.status); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: asTopology() = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
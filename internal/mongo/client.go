@@ -0,0 +1,336 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"gitscm.cisco.com/mcmp/utils/env"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// Selector defines different modes the connection can be configured.
+type Selector func(s *selections)
+
+// AppName allows selecting an appName that is different from registered ServiceName.
+func AppName(name string) Selector {
+	return func(s *selections) {
+		s.appName = name
+	}
+}
+
+// ReadOnly selects a read-only connection, authenticated using the password of the read-only user.
+func ReadOnly() Selector {
+	return func(s *selections) {
+		s.readOnly = true
+	}
+}
+
+// ReadWrite selects a read-write connection, authenticated using the password of the read-write user.
+func ReadWrite() Selector {
+	return func(s *selections) {
+		s.readWrite = true
+	}
+}
+
+// ReadPreference selects the servers used for reads by default, taking precedence over the connection string.
+func ReadPreference(rp *readpref.ReadPref) Selector {
+	return func(s *selections) {
+		s.readPref = rp
+	}
+}
+
+// Verified selects a connection that must reach the cluster during New; the startup policy never falls back
+// to degraded mode, so New fails instead when the cluster cannot be reached by the deadline.
+func Verified() Selector {
+	return func(s *selections) {
+		s.verified = true
+	}
+}
+
+// Commands selects a monitor to be notified of every command executed by the client.
+func Commands(m *event.CommandMonitor) Selector {
+	return func(s *selections) {
+		s.commands = m
+	}
+}
+
+// UpgradeSchema selects a configuration appropriate for apply schema upgrades.
+func UpgradeSchema() Selector {
+	return func(s *selections) {
+		s.upgrade = true
+	}
+}
+
+type selections struct {
+	readOnly  bool
+	readWrite bool
+	upgrade   bool
+	verified  bool
+	appName   string
+	readPref  *readpref.ReadPref
+	commands  *event.CommandMonitor
+	secrets   SecretProvider
+	tunnel    *SSHDialer
+}
+
+// Credential modes reported within the Status of a client.
+const (
+	CredentialsNone      = "none"
+	CredentialsURI       = "uri"
+	CredentialsReadOnly  = "read-only"
+	CredentialsReadWrite = "read-write"
+	CredentialsX509      = "x509"
+)
+
+const (
+	// Timeout operations after N seconds
+	queryTimeout    = 30
+	clusterEndpoint = "runondocumentdbpoc.cluster-cndxm9anwsxr.us-east-1.docdb.amazonaws.com:27017"
+
+	// Which instances to read from
+	readPreference           = "secondaryPreferred"
+	connectionStringTemplate = "mongodb://%s/test?replicaSet=rs0&readpreference=%s"
+)
+
+// New uses the common configurations defined in config package to configuration a client
+// for the specified database name.
+func New(ctx context.Context, picks ...Selector) (*mongo.Database, error) {
+	// the configuration file is optional as DocumentDB is configured by the environment by default
+	if err := config.LoadMongoConfigs(); err != nil && !os.IsNotExist(err) {
+		return nil, wraperrors.Wrapf(err, "unable to load MongoDB configurations from %q", config.GetString(config.MongoDBConfigFile))
+	}
+
+	s := applySelections(picks...)
+
+	uri, err := connectionURI(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := databaseName(uri)
+	if name == "" {
+		return nil, wraperrors.Errorf("missing %q configurations", config.MongoDBName)
+	}
+
+	tlsConfig, err := newTLSConfig(ctx, s)
+	if err != nil {
+		return nil, wraperrors.Wrap(err, "unable to create TLS config")
+	}
+
+	creds, err := newCredentials(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := newSSHDialer(ctx, s)
+	if err != nil {
+		return nil, wraperrors.Wrap(err, "unable to create SSH tunnel")
+	}
+
+	m := newMonitor(ctx, appName(s), credentialsMode(s, creds, uri), uint64(config.GetInt(config.MongoDBPoolLimit)))
+	set := CurrentSettings()
+
+	c, err := newStartup(s).connect(ctx, func() *options.ClientOptions {
+		opts := clientOptions(s, uri).
+			SetPoolMonitor(m.PoolMonitor()).
+			SetServerMonitor(m.ServerMonitor()).
+			SetMonitor(commandMonitors(s.commands, commandLogger(ctx, set, m.appName)))
+
+		if opts.MaxPoolSize != nil {
+			m.setPoolLimit(*opts.MaxPoolSize)
+		}
+
+		if tlsConfig != nil {
+			opts = opts.SetTLSConfig(tlsConfig)
+		}
+
+		if dialer != nil {
+			opts = opts.SetDialer(dialer)
+		}
+
+		return withAuth(opts, creds)
+	})
+	if err != nil {
+		release(s, dialer)
+
+		return nil, err
+	}
+
+	track(s, c, m, dialer)
+
+	return c.Database(name), nil
+}
+
+// connectionURI provides the configured connection string. The DocumentDB cluster is used when the context
+// selects it and neither a connection string, a cluster nor hosts are configured.
+func connectionURI(ctx context.Context) (string, error) {
+	uri := config.GetString(config.MongoDBURI)
+
+	if uri != "" || config.GetString(config.MongoDBClusterSrv) != "" || len(config.GetStringSlice(config.MongoDBHosts)) != 0 {
+		return uri, nil
+	}
+
+	if documentDB, _ := ctx.Value("flag").(bool); documentDB {
+		return fmt.Sprintf(connectionStringTemplate, clusterEndpoint, readPreference), nil
+	}
+
+	return "", wraperrors.Errorf("missing %q, %q and %q configurations", config.MongoDBURI, config.MongoDBClusterSrv, config.MongoDBHosts)
+}
+
+// Disconnect closes all connections of the client backing the provided database. In-use connections are
+// given until the context expires to be returned to the pool before being forcibly closed.
+func Disconnect(ctx context.Context, dbc *mongo.Database) error {
+	stopVerify(dbc.Client())
+
+	defer monitors.Delete(dbc.Client())
+	defer closeTunnel(dbc.Client())
+
+	if err := dbc.Client().Disconnect(ctx); err != nil && err != mongo.ErrClientDisconnected {
+		return wraperrors.Wrap(err, "unable to disconnect mongo client")
+	}
+
+	return nil
+}
+
+// track registers the state of a client created by New. A tunnel selected by the caller remains owned by the caller.
+func track(s *selections, c *mongo.Client, m *monitorState, dialer *SSHDialer) {
+	monitors.Store(c, m)
+
+	if dialer != nil && dialer != s.tunnel {
+		tunnels.Store(c, dialer)
+	}
+}
+
+// release closes a tunnel created for a client that could not be created.
+func release(s *selections, dialer *SSHDialer) {
+	if dialer != nil && dialer != s.tunnel {
+		_ = dialer.Close()
+	}
+}
+
+func applySelections(picks ...Selector) *selections {
+	s := new(selections)
+
+	for _, pick := range picks {
+		pick(s)
+	}
+
+	return s
+}
+
+func appName(s *selections) string {
+	if s.appName != "" {
+		return s.appName
+	}
+
+	return viper.GetString(env.SvcName)
+}
+
+func credentialsMode(s *selections, creds *options.Credential, uri string) string {
+	switch {
+	case creds == nil && uriCredentials(uri):
+		return CredentialsURI
+	case creds == nil:
+		return CredentialsNone
+	case creds.AuthMechanism == authX509:
+		return CredentialsX509
+	case s.readOnly:
+		return CredentialsReadOnly
+	default:
+		return CredentialsReadWrite
+	}
+}
+
+func socketTimeout(s *selections) time.Duration {
+	if s.upgrade {
+		return config.GetDuration(config.MongoDBUpgradeTimeout)
+	}
+
+	return config.GetDuration(config.MongoDBTimeout)
+}
+
+func connectTo(opts *options.ClientOptions) *options.ClientOptions {
+	// default to DNS name for the cluster when available
+	if config.GetString(config.MongoDBClusterSrv) != "" {
+		return opts.ApplyURI("mongodb+srv://" + config.GetString(config.MongoDBClusterSrv))
+	}
+
+	return opts.SetHosts(config.GetStringSlice(config.MongoDBHosts))
+}
+
+func newCredentials(ctx context.Context, s *selections) (*options.Credential, error) {
+	username, password, err := readCredentials(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.GetString(config.MongoDBAuthMechanism) == authX509 {
+		if config.GetString(config.MongoDBTLSCertFile) == "" {
+			return nil, wraperrors.Errorf("%q authentication requires %q configurations", authX509, config.MongoDBTLSCertFile)
+		}
+
+		// the username is derived from the client certificate subject unless provided
+		return &options.Credential{
+			AuthMechanism: authX509,
+			AuthSource:    "$external",
+			Username:      username,
+		}, nil
+	}
+
+	// if the secrets are defined with actual values
+	// then configure the Credential with username and password
+	if username != "" && password != "" {
+		return &options.Credential{
+			Username:   username,
+			Password:   password,
+			AuthSource: config.GetString(config.MongoDBAuthSource),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// readCredentials reads the username and the password of the selected user from the selected SecretProvider.
+func readCredentials(ctx context.Context, s *selections) (string, string, error) {
+	p := s.secrets
+	if p == nil {
+		var err error
+
+		if p, err = configuredSecrets(); err != nil {
+			return "", "", err
+		}
+	}
+
+	username, err := p.Secret(ctx, SecretUsername)
+	if err != nil {
+		return "", "", wraperrors.Wrap(err, "unable to read database username")
+	}
+
+	name := SecretPassword
+	if s.readOnly {
+		name = SecretReadOnlyPassword
+	}
+
+	password, err := p.Secret(ctx, name)
+	if err != nil {
+		return "", "", wraperrors.Wrap(err, "unable to read database password")
+	}
+
+	// never fall back to the read-write password for a read-only connection
+	if s.readOnly && username != "" && password == "" && config.GetString(config.MongoDBAuthMechanism) != authX509 {
+		return "", "", wraperrors.Errorf("missing %q secret for read-only connection", SecretReadOnlyPassword)
+	}
+
+	remember(name, password)
+
+	return username, password, nil
+}
@@ -0,0 +1,467 @@
+package mongo
+
+import (
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	wraperrors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// UUIDRepresentation determines how UUIDs are stored.
+type UUIDRepresentation string
+
+// Supported UUID representations.
+const (
+	// UUIDBinary stores UUIDs as binary values of subtype 4.
+	UUIDBinary UUIDRepresentation = "binary"
+	// UUIDString stores UUIDs as their canonical string.
+	UUIDString UUIDRepresentation = "string"
+)
+
+// decimalPrecision is the precision, in bits, of the big.Float decoded from a decimal; enough for the 34
+// significant digits of a decimal to round-trip.
+const decimalPrecision = 128
+
+var (
+	uuidTypes = []reflect.Type{
+		reflect.TypeOf(strfmt.UUID("")),
+		reflect.TypeOf(strfmt.UUID3("")),
+		reflect.TypeOf(strfmt.UUID4("")),
+		reflect.TypeOf(strfmt.UUID5("")),
+	}
+	// stringTypes are strfmt string formats stored as plain strings rather than embedded documents.
+	stringTypes = []reflect.Type{
+		reflect.TypeOf(strfmt.Email("")),
+		reflect.TypeOf(strfmt.URI("")),
+		reflect.TypeOf(strfmt.Hostname("")),
+		reflect.TypeOf(strfmt.IPv4("")),
+		reflect.TypeOf(strfmt.IPv6("")),
+		reflect.TypeOf(strfmt.CIDR("")),
+		reflect.TypeOf(strfmt.MAC("")),
+	}
+	tDateTime = reflect.TypeOf(strfmt.DateTime{})
+	tDate     = reflect.TypeOf(strfmt.Date{})
+	tDuration = reflect.TypeOf(strfmt.Duration(0))
+	tBase64   = reflect.TypeOf(strfmt.Base64(nil))
+	tBigFloat = reflect.TypeOf((*big.Float)(nil))
+
+	registries sync.Map
+)
+
+// Registry provides the codec registry for the UUID representation of the configurations.
+func Registry() *bsoncodec.Registry {
+	return NewRegistry(UUIDRepresentation(config.GetString(config.MongoDBCodecUUID)))
+}
+
+// NewRegistry provides a codec registry, extending the default registry, that stores the go-openapi strfmt
+// types consistently:
+//   - UUIDs as binary values of subtype 4 or as strings, according to the representation
+//   - DateTime and Date as dates in UTC with millisecond precision
+//   - Duration as an int64 of nanoseconds, like time.Duration
+//   - Base64 as binary values
+//   - other string formats, such as Email and Hostname, as strings
+//
+// Decimals decode into *big.Float without loss, and a *big.Float is stored as a decimal when it can be
+// represented exactly by its 34 significant digits.
+func NewRegistry(uuids UUIDRepresentation) *bsoncodec.Registry {
+	if uuids != UUIDString {
+		uuids = UUIDBinary
+	}
+
+	if r, ok := registries.Load(uuids); ok {
+		return r.(*bsoncodec.Registry)
+	}
+
+	rb := bson.NewRegistryBuilder()
+
+	uuidEncoder := bsoncodec.ValueEncoderFunc(encodeUUIDBinary)
+	if uuids == UUIDString {
+		uuidEncoder = encodeString
+	}
+
+	for _, t := range uuidTypes {
+		rb.RegisterTypeEncoder(t, uuidEncoder).RegisterTypeDecoder(t, bsoncodec.ValueDecoderFunc(decodeUUID))
+	}
+
+	for _, t := range stringTypes {
+		rb.RegisterTypeEncoder(t, bsoncodec.ValueEncoderFunc(encodeString)).
+			RegisterTypeDecoder(t, bsoncodec.ValueDecoderFunc(decodeString))
+	}
+
+	rb.RegisterTypeEncoder(tDateTime, bsoncodec.ValueEncoderFunc(encodeDateTime)).
+		RegisterTypeDecoder(tDateTime, bsoncodec.ValueDecoderFunc(decodeDateTime)).
+		RegisterTypeEncoder(tDate, bsoncodec.ValueEncoderFunc(encodeDate)).
+		RegisterTypeDecoder(tDate, bsoncodec.ValueDecoderFunc(decodeDate)).
+		RegisterTypeEncoder(tDuration, bsoncodec.ValueEncoderFunc(encodeDuration)).
+		RegisterTypeDecoder(tDuration, bsoncodec.ValueDecoderFunc(decodeDuration)).
+		RegisterTypeEncoder(tBase64, bsoncodec.ValueEncoderFunc(encodeBase64)).
+		RegisterTypeDecoder(tBase64, bsoncodec.ValueDecoderFunc(decodeBase64)).
+		RegisterTypeEncoder(tBigFloat, bsoncodec.ValueEncoderFunc(encodeDecimal)).
+		RegisterTypeDecoder(tBigFloat, bsoncodec.ValueDecoderFunc(decodeDecimal))
+
+	r, _ := registries.LoadOrStore(uuids, rb.Build())
+
+	return r.(*bsoncodec.Registry)
+}
+
+// Value converts values of the types handled by the Registry, and slices of them, into the primitive values
+// they are stored as, so they can be compared within filters. Other values, and values that cannot be
+// converted, are returned as they are.
+func Value(v interface{}) interface{} {
+	if v == nil || !converted(reflect.TypeOf(v)) {
+		return v
+	}
+
+	t, data, err := MarshalValue(v)
+	if err != nil {
+		return v
+	}
+
+	var out interface{}
+	if err := (bson.RawValue{Type: t, Value: data}).Unmarshal(&out); err != nil {
+		return v
+	}
+
+	return out
+}
+
+// MarshalValue provides the BSON encoding of the value using the Registry. Unlike bson.MarshalValueWithRegistry,
+// the codecs of the Registry take precedence over the BSON marshalers implemented by the strfmt types.
+func MarshalValue(v interface{}) (bsontype.Type, []byte, error) {
+	doc, err := bson.MarshalWithRegistry(Registry(), bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	raw := bson.Raw(doc).Lookup("v")
+
+	return raw.Type, raw.Value, nil
+}
+
+func converted(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice && t != tBase64 {
+		t = t.Elem()
+	}
+
+	switch t {
+	case tDateTime, tDate, tDuration, tBase64, tBigFloat:
+		return true
+	}
+
+	for _, u := range uuidTypes {
+		if t == u {
+			return true
+		}
+	}
+
+	for _, s := range stringTypes {
+		if t == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func encodeUUIDBinary(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	b, err := hex.DecodeString(strings.ReplaceAll(val.String(), "-", ""))
+	if err != nil || len(b) != 16 {
+		return wraperrors.Errorf("unable to encode %q as a UUID", val.String())
+	}
+
+	return vw.WriteBinaryWithSubtype(b, bsontype.BinaryUUID)
+}
+
+func decodeUUID(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	switch vr.Type() {
+	case bsontype.Binary:
+		b, subtype, err := vr.ReadBinary()
+		if err != nil {
+			return err
+		}
+
+		if (subtype != bsontype.BinaryUUID && subtype != bsontype.BinaryUUIDOld) || len(b) != 16 {
+			return wraperrors.Errorf("unable to decode binary subtype %d as a UUID", subtype)
+		}
+
+		h := hex.EncodeToString(b)
+		val.SetString(h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:])
+
+		return nil
+	default:
+		return decodeString(bsoncodec.DecodeContext{}, vr, val)
+	}
+}
+
+func encodeString(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	return vw.WriteString(val.String())
+}
+
+func decodeString(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	switch vr.Type() {
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+
+		val.SetString(s)
+
+		return nil
+	case bsontype.Null:
+		val.SetString("")
+
+		return vr.ReadNull()
+	case bsontype.EmbeddedDocument:
+		// documents written by the strfmt BSON marshalers
+		var legacy struct {
+			Data string `bson:"data"`
+		}
+
+		if err := decodeDocument(vr, &legacy); err != nil {
+			return err
+		}
+
+		val.SetString(legacy.Data)
+
+		return nil
+	}
+
+	return wraperrors.Errorf("unable to decode %v as %v", vr.Type(), val.Type())
+}
+
+func encodeDateTime(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	return vw.WriteDateTime(time.Time(val.Interface().(strfmt.DateTime)).UTC().UnixMilli())
+}
+
+func decodeDateTime(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	t, err := readTime(vr)
+	if err != nil {
+		return err
+	}
+
+	val.Set(reflect.ValueOf(strfmt.DateTime(t)))
+
+	return nil
+}
+
+func encodeDate(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	t := time.Time(val.Interface().(strfmt.Date))
+
+	return vw.WriteDateTime(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).UnixMilli())
+}
+
+func decodeDate(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	t, err := readTime(vr)
+	if err != nil {
+		return err
+	}
+
+	val.Set(reflect.ValueOf(strfmt.Date(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))))
+
+	return nil
+}
+
+// readTime reads a date, or a string in one of the strfmt date formats, in UTC.
+func readTime(vr bsonrw.ValueReader) (time.Time, error) {
+	switch vr.Type() {
+	case bsontype.DateTime:
+		ms, err := vr.ReadDateTime()
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return time.UnixMilli(ms).UTC(), nil
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if d, err := strfmt.ParseDateTime(s); err == nil {
+			return time.Time(d).UTC(), nil
+		}
+
+		t, err := time.Parse(strfmt.RFC3339FullDate, s)
+		if err != nil {
+			return time.Time{}, wraperrors.Wrapf(err, "unable to decode %q as a date", s)
+		}
+
+		return t, nil
+	case bsontype.Null:
+		return time.Time{}, vr.ReadNull()
+	case bsontype.EmbeddedDocument:
+		// documents written by the strfmt BSON marshalers
+		var legacy struct {
+			Data bson.RawValue `bson:"data"`
+		}
+
+		if err := decodeDocument(vr, &legacy); err != nil {
+			return time.Time{}, err
+		}
+
+		return readTime(bsonrw.NewBSONValueReader(legacy.Data.Type, legacy.Data.Value))
+	}
+
+	return time.Time{}, wraperrors.Errorf("unable to decode %v as a date", vr.Type())
+}
+
+func encodeDuration(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	return vw.WriteInt64(val.Int())
+}
+
+func decodeDuration(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	switch vr.Type() {
+	case bsontype.Int64:
+		i, err := vr.ReadInt64()
+		if err != nil {
+			return err
+		}
+
+		val.SetInt(i)
+
+		return nil
+	case bsontype.Int32:
+		i, err := vr.ReadInt32()
+		if err != nil {
+			return err
+		}
+
+		val.SetInt(int64(i))
+
+		return nil
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+
+		d, err := strfmt.ParseDuration(s)
+		if err != nil {
+			return wraperrors.Wrapf(err, "unable to decode %q as a duration", s)
+		}
+
+		val.SetInt(int64(d))
+
+		return nil
+	case bsontype.Null:
+		val.SetInt(0)
+
+		return vr.ReadNull()
+	}
+
+	return wraperrors.Errorf("unable to decode %v as a duration", vr.Type())
+}
+
+func encodeBase64(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+
+	return vw.WriteBinary(val.Bytes())
+}
+
+func decodeBase64(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	switch vr.Type() {
+	case bsontype.Binary:
+		b, _, err := vr.ReadBinary()
+		if err != nil {
+			return err
+		}
+
+		val.SetBytes(append([]byte(nil), b...))
+
+		return nil
+	case bsontype.Null:
+		val.SetBytes(nil)
+
+		return vr.ReadNull()
+	}
+
+	return wraperrors.Errorf("unable to decode %v as binary", vr.Type())
+}
+
+func encodeDecimal(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+
+	f := val.Interface().(*big.Float)
+	s := f.Text('g', 34)
+
+	// reject values that lose precision as a decimal rather than silently rounding them
+	if back, _, err := big.ParseFloat(s, 10, f.Prec(), f.Mode()); err != nil || back.Cmp(f) != 0 {
+		return wraperrors.Errorf("unable to encode %v as a decimal without loss", f)
+	}
+
+	d, err := primitive.ParseDecimal128(s)
+	if err != nil {
+		return wraperrors.Wrapf(err, "unable to encode %v as a decimal", f)
+	}
+
+	return vw.WriteDecimal128(d)
+}
+
+func decodeDecimal(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	var s string
+
+	switch vr.Type() {
+	case bsontype.Decimal128:
+		d, err := vr.ReadDecimal128()
+		if err != nil {
+			return err
+		}
+
+		s = d.String()
+	case bsontype.Double:
+		f, err := vr.ReadDouble()
+		if err != nil {
+			return err
+		}
+
+		val.Set(reflect.ValueOf(big.NewFloat(f)))
+
+		return nil
+	case bsontype.String:
+		var err error
+		if s, err = vr.ReadString(); err != nil {
+			return err
+		}
+	case bsontype.Null:
+		val.Set(reflect.Zero(val.Type()))
+
+		return vr.ReadNull()
+	default:
+		return wraperrors.Errorf("unable to decode %v as a decimal", vr.Type())
+	}
+
+	f, _, err := big.ParseFloat(s, 10, decimalPrecision, big.ToNearestEven)
+	if err != nil {
+		return wraperrors.Wrapf(err, "unable to decode %q as a decimal", s)
+	}
+
+	val.Set(reflect.ValueOf(f))
+
+	return nil
+}
+
+func decodeDocument(vr bsonrw.ValueReader, v interface{}) error {
+	raw, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(raw, v)
+}
@@ -0,0 +1,477 @@
+package mongo
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CompatMode determines how the features of commands not supported by Amazon DocumentDB are handled.
+type CompatMode string
+
+// Supported compatibility modes.
+const (
+	// CompatStrict rejects commands using unsupported features.
+	CompatStrict CompatMode = "strict"
+	// CompatWarn logs the unsupported features used by commands.
+	CompatWarn CompatMode = "warn"
+	// CompatOff disables the checks.
+	CompatOff CompatMode = "off"
+)
+
+// supportedStages are the aggregation stages supported by Amazon DocumentDB.
+var supportedStages = names(
+	"$addFields", "$bucket", "$count", "$facet", "$geoNear", "$group", "$limit", "$lookup", "$match", "$out",
+	"$project", "$redact", "$replaceRoot", "$replaceWith", "$sample", "$search", "$set", "$skip", "$sort",
+	"$unset", "$unwind",
+)
+
+// supportedOperators are the query, expression and accumulator operators supported by Amazon DocumentDB.
+var supportedOperators = names(
+	// query
+	"$eq", "$gt", "$gte", "$in", "$lt", "$lte", "$ne", "$nin", "$and", "$not", "$nor", "$or", "$exists",
+	"$type", "$mod", "$regex", "$options", "$all", "$elemMatch", "$size", "$expr", "$text", "$search",
+	"$geoIntersects", "$geoWithin", "$nearSphere", "$geometry", "$maxDistance", "$minDistance",
+	// arithmetic
+	"$abs", "$add", "$ceil", "$divide", "$floor", "$mod", "$multiply", "$subtract", "$trunc", "$round",
+	// array
+	"$arrayElemAt", "$arrayToObject", "$concatArrays", "$filter", "$in", "$indexOfArray", "$isArray",
+	"$map", "$objectToArray", "$range", "$reduce", "$reverseArray", "$size", "$slice",
+	// boolean and comparison
+	"$cmp",
+	// conditional
+	"$cond", "$ifNull", "$switch",
+	// date
+	"$dateFromString", "$dateToString", "$dayOfMonth", "$dayOfWeek", "$dayOfYear", "$hour", "$isoDayOfWeek",
+	"$isoWeek", "$isoWeekYear", "$millisecond", "$minute", "$month", "$second", "$week", "$year",
+	// literal, object and variable
+	"$literal", "$mergeObjects", "$let",
+	// set
+	"$allElementsTrue", "$anyElementTrue", "$setDifference", "$setEquals", "$setIntersection",
+	"$setIsSubset", "$setUnion",
+	// string
+	"$concat", "$indexOfBytes", "$indexOfCP", "$ltrim", "$rtrim", "$split", "$strLenBytes", "$strLenCP",
+	"$strcasecmp", "$substr", "$substrBytes", "$substrCP", "$toLower", "$toUpper", "$trim",
+	// type conversion
+	"$convert", "$toBool", "$toDate", "$toDecimal", "$toDouble", "$toInt", "$toLong", "$toObjectId",
+	"$toString",
+	// accumulators
+	"$addToSet", "$avg", "$first", "$last", "$max", "$min", "$push", "$sum",
+	// text search
+	"$meta",
+)
+
+// supportedUpdateOperators are the update operators, and the modifiers of $push, supported by Amazon DocumentDB;
+// updates expressed as aggregation pipelines are not supported.
+var supportedUpdateOperators = names(
+	"$set", "$unset", "$inc", "$mul", "$min", "$max", "$rename", "$setOnInsert", "$currentDate", "$push",
+	"$addToSet", "$pull", "$pullAll", "$pop", "$bit", "$each", "$position", "$slice", "$sort",
+)
+
+// supportedRegexOptions are the $regex options supported by Amazon DocumentDB.
+const supportedRegexOptions = "imx"
+
+// unsupportedIndexTypes are the index types, the values of the index keys, not supported by Amazon DocumentDB.
+var unsupportedIndexTypes = names("hashed", "2d", "geoHaystack")
+
+// unsupportedIndexOptions are the index options not supported by Amazon DocumentDB.
+var unsupportedIndexOptions = names("collation", "hidden", "wildcardProjection", "storageEngine")
+
+// unsupportedCommands are the commands not supported by Amazon DocumentDB.
+var unsupportedCommands = names("mapReduce", "geoSearch", "eval", "group")
+
+func names(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
+
+// Incompatibility is a feature, used by a command, that is not supported by Amazon DocumentDB.
+type Incompatibility struct {
+	// Path locates the feature within the command, such as "filter.name"; empty for the command itself.
+	Path string `json:"path"`
+	// Feature names the feature, such as "$where", "$regex option s" or "collation".
+	Feature string `json:"feature"`
+}
+
+func (i Incompatibility) String() string {
+	if i.Path == "" {
+		return i.Feature
+	}
+
+	return i.Path + " " + i.Feature
+}
+
+// Err provides the Incompatibility as an ErrInvalid domain error.
+func (i Incompatibility) Err() error {
+	return errors.NewDomainError(errors.ErrInvalid, errors.Default, i.String(), "a feature supported by DocumentDB")
+}
+
+// ConfiguredCompat provides the CompatMode of the active configurations.
+func ConfiguredCompat() CompatMode {
+	return CurrentSettings().Compat
+}
+
+// Compat handles the incompatibilities found within a command on the collection according to the CompatMode:
+// the first is returned as an error when strict, and each is logged as a warning otherwise.
+func Compat(ctx context.Context, mode CompatMode, collection string, found []Incompatibility) error {
+	if len(found) == 0 {
+		return nil
+	}
+
+	switch mode {
+	case CompatOff:
+		return nil
+	case CompatStrict:
+		return found[0].Err()
+	}
+
+	for _, i := range found {
+		log(ctx).WithFields(logrus.Fields{
+			"mongodb.compat.collection": collection,
+			"mongodb.compat.path":       i.Path,
+			"mongodb.compat.feature":    i.Feature,
+		}).Warn("MongoDB command uses a feature not supported by DocumentDB")
+	}
+
+	return nil
+}
+
+// CheckStage verifies that the aggregation stage, and every operator used within it, is supported by Amazon
+// DocumentDB; the stage is a document holding a single stage operator.
+func CheckStage(stage bson.D) error {
+	if len(stage) != 1 {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, "stage", "a document holding a single stage")
+	}
+
+	l := &linter{}
+	l.stage("", stage)
+
+	return l.err()
+}
+
+// CheckFilter verifies that every operator used within the filter is supported by Amazon DocumentDB.
+func CheckFilter(filter interface{}) error {
+	return firstErr(LintFilter(filter))
+}
+
+// LintFilter provides the incompatibilities found within the filter, such as one produced by Filters.
+func LintFilter(filter interface{}) []Incompatibility {
+	l := &linter{}
+	l.operators("", filter)
+
+	return l.found
+}
+
+// LintUpdate provides the incompatibilities found within the update document.
+func LintUpdate(update interface{}) []Incompatibility {
+	l := &linter{}
+	l.update("", update)
+
+	return l.found
+}
+
+// LintPipeline provides the incompatibilities found within the stages of the aggregation pipeline.
+func LintPipeline(pipeline interface{}) []Incompatibility {
+	l := &linter{}
+	l.pipeline("", pipeline)
+
+	return l.found
+}
+
+// LintIndex provides the incompatibilities found within the definition of the index.
+func LintIndex(model mongo.IndexModel) []Incompatibility {
+	spec := bson.D{{Key: "key", Value: model.Keys}}
+
+	if o := model.Options; o != nil {
+		if o.Collation != nil {
+			spec = append(spec, bson.E{Key: "collation", Value: o.Collation.ToDocument()})
+		}
+
+		if o.Hidden != nil {
+			spec = append(spec, bson.E{Key: "hidden", Value: *o.Hidden})
+		}
+
+		if o.WildcardProjection != nil {
+			spec = append(spec, bson.E{Key: "wildcardProjection", Value: o.WildcardProjection})
+		}
+
+		if o.StorageEngine != nil {
+			spec = append(spec, bson.E{Key: "storageEngine", Value: o.StorageEngine})
+		}
+
+		if o.PartialFilterExpression != nil {
+			spec = append(spec, bson.E{Key: "partialFilterExpression", Value: o.PartialFilterExpression})
+		}
+	}
+
+	l := &linter{}
+	l.index("", spec)
+
+	return l.found
+}
+
+// LintCommand provides the incompatibilities found within the command document, as sent to the server: the
+// filters, updates, pipelines, collations and index definitions of find, count, distinct, aggregate, update,
+// delete, findAndModify and createIndexes commands are inspected.
+func LintCommand(cmd bson.D) []Incompatibility {
+	if len(cmd) == 0 {
+		return nil
+	}
+
+	l := &linter{}
+
+	if name := cmd[0].Key; unsupportedCommands[name] {
+		l.report("", name)
+
+		return l.found
+	}
+
+	// the first element names the command and its collection
+	l.command("", cmd[1:])
+
+	return l.found
+}
+
+func firstErr(found []Incompatibility) error {
+	if len(found) == 0 {
+		return nil
+	}
+
+	return found[0].Err()
+}
+
+// linter collects the incompatibilities found within the parts of a command.
+type linter struct {
+	found []Incompatibility
+}
+
+func (l *linter) report(path, feature string) {
+	l.found = append(l.found, Incompatibility{Path: path, Feature: feature})
+}
+
+func (l *linter) err() error {
+	return firstErr(l.found)
+}
+
+func (l *linter) command(path string, cmd bson.D) {
+	for _, e := range cmd {
+		p := subpath(path, e.Key)
+
+		switch e.Key {
+		case "filter", "query", "q", "arrayFilters":
+			l.operators(p, e.Value)
+		case "update", "u":
+			l.update(p, e.Value)
+		case "pipeline":
+			l.pipeline(p, e.Value)
+		case "collation":
+			l.report(path, e.Key)
+		case "updates", "deletes":
+			for i, stmt := range elements(e.Value) {
+				l.command(subpath(p, strconv.Itoa(i)), asDocument(stmt))
+			}
+		case "indexes":
+			for i, spec := range elements(e.Value) {
+				l.index(subpath(p, strconv.Itoa(i)), asDocument(spec))
+			}
+		}
+	}
+}
+
+func (l *linter) pipeline(path string, v interface{}) {
+	for i, s := range elements(v) {
+		if stage := asDocument(s); len(stage) == 1 {
+			l.stage(subpath(path, strconv.Itoa(i)), stage)
+		}
+	}
+}
+
+func (l *linter) stage(path string, stage bson.D) {
+	name := stage[0].Key
+	if !supportedStages[name] {
+		l.report(path, name)
+
+		return
+	}
+
+	path = subpath(path, name)
+
+	switch name {
+	case "$facet":
+		// each facet is a pipeline
+		for _, facet := range asDocument(stage[0].Value) {
+			l.pipeline(subpath(path, facet.Key), facet.Value)
+		}
+	case "$lookup":
+		for _, e := range asDocument(stage[0].Value) {
+			if e.Key == "pipeline" {
+				l.pipeline(subpath(path, e.Key), e.Value)
+			}
+		}
+	default:
+		l.operators(path, stage[0].Value)
+	}
+}
+
+func (l *linter) update(path string, v interface{}) {
+	// an update is either a document of update operators or an aggregation pipeline
+	if elements(v) != nil {
+		l.report(path, "pipeline update")
+
+		return
+	}
+
+	for _, e := range asDocument(v) {
+		if !supportedUpdateOperators[e.Key] {
+			l.report(path, e.Key)
+
+			continue
+		}
+
+		switch e.Key {
+		case "$pull":
+			// the values of $pull are conditions on the elements to remove
+			l.operators(subpath(path, e.Key), e.Value)
+		case "$push", "$addToSet":
+			for _, field := range asDocument(e.Value) {
+				for _, m := range asDocument(field.Value) {
+					if strings.HasPrefix(m.Key, "$") && !supportedUpdateOperators[m.Key] {
+						l.report(subpath(path, e.Key+"."+field.Key), m.Key)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (l *linter) index(path string, spec bson.D) {
+	for _, e := range spec {
+		switch {
+		case e.Key == "key":
+			for _, k := range asDocument(e.Value) {
+				if k.Key == "$**" || strings.HasSuffix(k.Key, ".$**") {
+					l.report(subpath(path, "key."+k.Key), "wildcard index")
+				}
+
+				if t, ok := k.Value.(string); ok && unsupportedIndexTypes[t] {
+					l.report(subpath(path, "key."+k.Key), t+" index")
+				}
+			}
+		case e.Key == "partialFilterExpression":
+			l.operators(subpath(path, e.Key), e.Value)
+		case unsupportedIndexOptions[e.Key]:
+			l.report(path, e.Key)
+		}
+	}
+}
+
+// operators verifies the keys of the documents within v that name operators, along with the options of regular
+// expressions; field paths and variables, such as "$amount" and "$$ROOT", only appear as values and are not
+// checked.
+func (l *linter) operators(path string, v interface{}) {
+	if re, ok := v.(primitive.Regex); ok {
+		l.regexOptions(path, re.Options)
+
+		return
+	}
+
+	if items := elements(v); items != nil {
+		for _, e := range items {
+			l.operators(path, e)
+		}
+
+		return
+	}
+
+	for _, e := range asDocument(v) {
+		switch {
+		case e.Key == "$options":
+			if opts, ok := e.Value.(string); ok {
+				l.regexOptions(path, opts)
+			}
+		case strings.HasPrefix(e.Key, "$") && !supportedOperators[e.Key]:
+			l.report(path, e.Key)
+		case strings.HasPrefix(e.Key, "$"):
+			l.operators(path, e.Value)
+		default:
+			l.operators(subpath(path, e.Key), e.Value)
+		}
+	}
+}
+
+func (l *linter) regexOptions(path, opts string) {
+	for _, o := range opts {
+		if !strings.ContainsRune(supportedRegexOptions, o) {
+			l.report(path, "$regex option "+string(o))
+		}
+	}
+}
+
+// elements provides the elements of the array; nil when v is not an array.
+func elements(v interface{}) []interface{} {
+	var items []interface{}
+
+	switch val := v.(type) {
+	case bson.A:
+		items = val
+	case []interface{}:
+		items = val
+	case []bson.D:
+		for _, e := range val {
+			items = append(items, e)
+		}
+	case []bson.M:
+		for _, e := range val {
+			items = append(items, e)
+		}
+	case mongo.Pipeline:
+		for _, e := range val {
+			items = append(items, e)
+		}
+	default:
+		return nil
+	}
+
+	if items == nil {
+		items = []interface{}{}
+	}
+
+	return items
+}
+
+// asDocument provides the document as a bson.D; nil when v is not a document.
+func asDocument(v interface{}) bson.D {
+	switch val := v.(type) {
+	case bson.D:
+		return val
+	case bson.M:
+		d := make(bson.D, 0, len(val))
+		for k, e := range val {
+			d = append(d, bson.E{Key: k, Value: e})
+		}
+
+		return d
+	case map[string]interface{}:
+		return asDocument(bson.M(val))
+	}
+
+	return nil
+}
+
+func subpath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
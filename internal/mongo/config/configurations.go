@@ -0,0 +1,324 @@
+/*
+Package config defines the supported configuration options for databases.
+
+Example Configuration file (config.yaml)
+
+	db.mongo:
+		name: mytestdb
+		username: mcmp_svc_rw
+		tls:
+			certfile: /etc/mcmp/db/mongo/tls/client.crt
+			keyfile: /etc/mcmp/db/mongo/tls/client.key
+			minversion: "1.2"
+		ssh:
+			host: bastion.example.com:22
+			user: ec2-user
+			agent: true
+		secrets:
+			provider: file
+			path: /etc/mcmp/db/mongo/secrets
+		startup:
+			deadline: 2m
+			degraded: true
+		encryption:
+			keyring: /etc/mcmp/db/mongo/encryption/keyring.yaml
+			schema: /etc/mcmp/db/mongo/encryption/schema.yaml
+		codec:
+			uuid: string
+		compat: strict
+*/
+package config
+
+import (
+	"os"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// all configuration keys.
+const (
+	// Environment Variable: "MONGO_DB_URI"; mongodb:// or mongodb+srv:// connection string merged with the other configurations.
+	MongoDBURI = "db.mongo.uri"
+	// Environment Variable: "MONGO_DB_HOSTS".
+	MongoDBHosts = "db.mongo.hosts"
+	// Environment Variable: "MONGO_DB_CLUSTER_SRV".
+	MongoDBClusterSrv = "db.mongo.clustersrv"
+	// Environment Variable: "MONGO_DB_NAME".
+	MongoDBName = "db.mongo.name"
+	// Environment Variable: "MONGO_DB_USERNAME".
+	MongoDBUsername = "db.mongo.username"
+	// Environment Variable: "MONGO_DB_PASSWORD".
+	MongoDBPassword = "db.mongo.password.default"
+	// Password of the read-write user; takes precedence over MongoDBPassword.
+	MongoDBReadWritePassword = "db.mongo.password.read_write"
+	// Password of the read-only user used by read-only connections.
+	MongoDBReadOnlyPassword = "db.mongo.password.read_only"
+	// Environment Variable: "MONGO_DB_AUTH_SOURCE".
+	MongoDBAuthSource = "db.mongo.authsource"
+	// Environment Variable: "MONGO_DB_REPLICASET".
+	MongoDBReplicaSet = "db.mongo.replicaset"
+	// Environment Variable: "MONGO_DB_AUTH_MECHANISM"; "MONGODB-X509" authenticates using the client certificate.
+	MongoDBAuthMechanism = "db.mongo.authmechanism"
+	// Environment Variable: "MONGO_DB_CACERT".
+	MongoDBCACert = "db.mongo.cacert"
+
+	// Environment Variable: "MONGO_DB_TLS_CERTFILE".
+	MongoDBTLSCertFile = "db.mongo.tls.certfile"
+	// Environment Variable: "MONGO_DB_TLS_KEYFILE"; PEM encoded PKCS#1, SEC 1 or (encrypted) PKCS#8 key.
+	MongoDBTLSKeyFile = "db.mongo.tls.keyfile"
+	// Environment Variable: "MONGO_DB_TLS_KEYPASSWORD".
+	MongoDBTLSKeyPassword = "db.mongo.tls.keypassword"
+	// Environment Variable: "MONGO_DB_TLS_SERVERNAME".
+	MongoDBTLSServerName = "db.mongo.tls.servername"
+	// Default: "1.2".
+	MongoDBTLSMinVersion = "db.mongo.tls.minversion"
+	// Default: Go defaults; only applies to TLS 1.2 and below.
+	MongoDBTLSCiphers = "db.mongo.tls.ciphers"
+	// Environment Variable: "MONGO_DB_TLS_INSECURE"; Default: false. For development ONLY!
+	MongoDBTLSInsecure = "db.mongo.tls.insecure"
+
+	// Environment Variable: "MONGO_DB_SSH_HOST"; SSH bastion (host:port) used to reach the cluster.
+	MongoDBSSHHost = "db.mongo.ssh.host"
+	// Environment Variable: "MONGO_DB_SSH_USER".
+	MongoDBSSHUser = "db.mongo.ssh.user"
+	// Environment Variable: "MONGO_DB_SSH_KEYFILE".
+	MongoDBSSHKeyFile = "db.mongo.ssh.keyfile"
+	// Environment Variable: "MONGO_DB_SSH_PASSPHRASE".
+	MongoDBSSHPassphrase = "db.mongo.ssh.passphrase"
+	// Environment Variable: "MONGO_DB_SSH_AGENT"; Default: false.
+	MongoDBSSHAgent = "db.mongo.ssh.agent"
+	// Environment Variable: "MONGO_DB_SSH_KNOWN_HOSTS"; Default: "~/.ssh/known_hosts".
+	MongoDBSSHKnownHosts = "db.mongo.ssh.knownhosts"
+	// Default: "10s".
+	MongoDBSSHTimeout = "db.mongo.ssh.timeout"
+
+	// Environment Variable: "MONGO_DB_SECRETS_PROVIDER"; one of "env", "file" or "aws"; Default: "env".
+	MongoDBSecretsProvider = "db.mongo.secrets.provider"
+	// Environment Variable: "MONGO_DB_SECRETS_PATH"; directory of secret files or an AWS Secrets Manager JSON file.
+	MongoDBSecretsPath = "db.mongo.secrets.path"
+	// Default: "5m".
+	MongoDBSecretsRefresh = "db.mongo.secrets.refresh"
+
+	// Environment Variable: "MONGO_DB_ENCRYPTION_KEYRING"; YAML file of the keys used for client-side field encryption.
+	MongoDBEncryptionKeyRing = "db.mongo.encryption.keyring"
+	// Environment Variable: "MONGO_DB_ENCRYPTION_SCHEMA"; YAML file of the encrypted fields of each collection.
+	MongoDBEncryptionSchema = "db.mongo.encryption.schema"
+
+	// Environment Variable: "MONGO_DB_POLICY"; YAML file of the collections each principal and client may access.
+	MongoDBPolicy = "db.mongo.policy"
+
+	// Environment Variable: "MONGO_DB_LOG_DENY"; comma separated field names whose values are never logged.
+	MongoDBLogDeny = "db.mongo.log.deny"
+	// Environment Variable: "MONGO_DB_LOG_COMMANDS"; Default: false. Logs the shape of every command at debug level.
+	MongoDBLogCommands = "db.mongo.log.commands"
+
+	// Environment Variable: "MONGO_DB_CODEC_UUID"; Default: "binary". Stores UUIDs as "binary" (subtype 4) or "string".
+	MongoDBCodecUUID = "db.mongo.codec.uuid"
+
+	// Environment Variable: "MONGO_DB_COMPAT"; Default: "warn". Handling of the features of commands not supported by
+	// Amazon DocumentDB: "strict" rejects the command, "warn" logs the features and "off" disables the checks, geo
+	// filters then using the MongoDB operators DocumentDB does not support.
+	MongoDBCompat = "db.mongo.compat"
+
+	// Environment Variable: "MONGO_DB_CONFIG_FILE".
+	MongoDBConfigFile = "db.mongo.configfile"
+	// Environment Variable: "MONGO_DB_WATCH"; Default: true.
+	MongoDBWatch = "db.mongo.watch"
+
+	// Default: "3s".
+	MongoDBTimeout = "db.mongo.timeout.default"
+	// Default: "3s".
+	MongoDBConnectTimeout = "db.mongo.timeout.connect"
+	// Default: "3s".
+	MongoDBSelectTimeout = "db.mongo.timeout.select"
+	// Default: "5m".
+	MongoDBUpgradeTimeout = "db.mongo.timeout.upgrade"
+	// Default: "2s".
+	MongoDBIndexTimeout = "db.mongo.timeout.index"
+
+	// Environment Variable: "MONGO_DB_STARTUP_DEADLINE"; Default: "30s"; "0s" makes a single attempt.
+	MongoDBStartupDeadline = "db.mongo.startup.deadline"
+	// Default: "500ms".
+	MongoDBStartupBackoff = "db.mongo.startup.backoff.initial"
+	// Default: "30s".
+	MongoDBStartupMaxBackoff = "db.mongo.startup.backoff.max"
+	// Environment Variable: "MONGO_DB_STARTUP_DEGRADED"; Default: true (start unverified once the deadline passes).
+	MongoDBStartupDegraded = "db.mongo.startup.degraded"
+
+	// Default: 10.
+	MongoDBPoolLimit = "db.mongo.pool.limit"
+	// Default: "5m".
+	MongoDBPoolMaxIdleTime = "db.mongo.pool.maxidle"
+)
+
+const (
+	// default path to current configurations.
+	currentCfgFile = "/opt/mcmp/db/mongo/current.yaml"
+	// default path to future configurations.
+	futureCfgFile = "/opt/mcmp/db/mongo/future.yaml"
+)
+
+func init() {
+	initialize()
+}
+
+// Current sets configuration file to use the current configurations.
+// This is useful when needing to switch from testing a future configurations back to current.
+func Current() {
+	override(MongoDBConfigFile, currentCfgFile, SourceOverride)
+}
+
+// Future sets configuration file to use the future configurations.
+// This is useful when needing to switch to using a future configuration file.
+func Future() {
+	override(MongoDBConfigFile, futureCfgFile, SourceOverride)
+}
+
+// ReadOnly selects the read only password.
+//
+// Deprecated: the password is selected for each client by the ReadOnly and ReadWrite selectors of New without
+// changing the configurations shared by every client.
+func ReadOnly() {
+	override(MongoDBPassword, GetString(MongoDBReadOnlyPassword), Source(MongoDBReadOnlyPassword))
+}
+
+// ReadWrite selects the read write password. Default configuration.
+//
+// Deprecated: the password is selected for each client by the ReadOnly and ReadWrite selectors of New without
+// changing the configurations shared by every client.
+func ReadWrite() {
+	override(MongoDBPassword, GetString(MongoDBReadWritePassword), Source(MongoDBReadWritePassword))
+}
+
+// LoadMongoConfigs loads a specified MongoDB configuration file and merges the content into existing sets of configurations.
+func LoadMongoConfigs() error {
+	name := viper.GetString(MongoDBConfigFile)
+	if name == "" {
+		return wraperrors.New("no MongoDB configuration file found")
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var cfg map[string]interface{}
+	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
+		return err
+	}
+
+	file := make(map[string]interface{})
+	for key, value := range Active().file {
+		file[key] = value
+	}
+
+	flatten("", cfg, file)
+	activate(file)
+
+	return nil
+}
+
+// Restore will reset viper and re-initialize back to the default configurations
+// For Testing ONLY!
+func Restore() {
+	viper.Reset()
+	resetSources()
+	initialize()
+}
+
+// LoadFixture will load test fixture configuration; for testing only!
+func LoadFixture(dir string) error {
+	viper.SetConfigName("config")
+	viper.AddConfigPath(dir)
+
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+
+	activate(Active().file)
+
+	return nil
+}
+
+// defaults holds the default value of each configuration key.
+var defaults = map[string]interface{}{
+	MongoDBConfigFile:        currentCfgFile,
+	MongoDBTLSMinVersion:     "1.2",
+	MongoDBTLSInsecure:       false,
+	MongoDBSSHAgent:          false,
+	MongoDBSSHTimeout:        "10s",
+	MongoDBSecretsProvider:   "env",
+	MongoDBSecretsRefresh:    "5m",
+	MongoDBWatch:             true,
+	MongoDBLogDeny:           "password,secret,token,ssn,email,phone",
+	MongoDBLogCommands:       false,
+	MongoDBCodecUUID:         "binary",
+	MongoDBCompat:            "warn",
+	MongoDBTimeout:           "30s",
+	MongoDBConnectTimeout:    "30s",
+	MongoDBSelectTimeout:     "30s",
+	MongoDBUpgradeTimeout:    "5m",
+	MongoDBIndexTimeout:      "2s",
+	MongoDBStartupDeadline:   "30s",
+	MongoDBStartupBackoff:    "500ms",
+	MongoDBStartupMaxBackoff: "30s",
+	MongoDBStartupDegraded:   true,
+	MongoDBPoolLimit:         10,
+	MongoDBPoolMaxIdleTime:   "15m",
+}
+
+// envVars holds the environment variable bound to each configuration key.
+var envVars = map[string]string{
+	MongoDBURI:               "MONGO_DB_URI",
+	MongoDBHosts:             "MONGO_DB_HOSTS",
+	MongoDBClusterSrv:        "MONGO_DB_CLUSTER_SRV",
+	MongoDBName:              "MONGO_DB_NAME",
+	MongoDBUsername:          "MONGO_DB_USERNAME",
+	MongoDBPassword:          "MONGO_DB_PASSWORD",
+	MongoDBAuthSource:        "MONGO_DB_AUTH_SOURCE",
+	MongoDBReplicaSet:        "MONGO_DB_REPLICASET",
+	MongoDBAuthMechanism:     "MONGO_DB_AUTH_MECHANISM",
+	MongoDBCACert:            "MONGO_DB_CACERT",
+	MongoDBTLSCertFile:       "MONGO_DB_TLS_CERTFILE",
+	MongoDBTLSKeyFile:        "MONGO_DB_TLS_KEYFILE",
+	MongoDBTLSKeyPassword:    "MONGO_DB_TLS_KEYPASSWORD",
+	MongoDBTLSServerName:     "MONGO_DB_TLS_SERVERNAME",
+	MongoDBTLSInsecure:       "MONGO_DB_TLS_INSECURE",
+	MongoDBSSHHost:           "MONGO_DB_SSH_HOST",
+	MongoDBSSHUser:           "MONGO_DB_SSH_USER",
+	MongoDBSSHKeyFile:        "MONGO_DB_SSH_KEYFILE",
+	MongoDBSSHPassphrase:     "MONGO_DB_SSH_PASSPHRASE",
+	MongoDBSSHAgent:          "MONGO_DB_SSH_AGENT",
+	MongoDBSSHKnownHosts:     "MONGO_DB_SSH_KNOWN_HOSTS",
+	MongoDBSecretsProvider:   "MONGO_DB_SECRETS_PROVIDER",
+	MongoDBSecretsPath:       "MONGO_DB_SECRETS_PATH",
+	MongoDBEncryptionKeyRing: "MONGO_DB_ENCRYPTION_KEYRING",
+	MongoDBEncryptionSchema:  "MONGO_DB_ENCRYPTION_SCHEMA",
+	MongoDBPolicy:            "MONGO_DB_POLICY",
+	MongoDBLogDeny:           "MONGO_DB_LOG_DENY",
+	MongoDBLogCommands:       "MONGO_DB_LOG_COMMANDS",
+	MongoDBCodecUUID:         "MONGO_DB_CODEC_UUID",
+	MongoDBCompat:            "MONGO_DB_COMPAT",
+	MongoDBConfigFile:        "MONGO_DB_CONFIG_FILE",
+	MongoDBWatch:             "MONGO_DB_WATCH",
+	MongoDBStartupDeadline:   "MONGO_DB_STARTUP_DEADLINE",
+	MongoDBStartupDegraded:   "MONGO_DB_STARTUP_DEGRADED",
+}
+
+func initialize() {
+	for key, value := range defaults {
+		viper.SetDefault(key, value)
+	}
+
+	for key, env := range envVars {
+		_ = viper.BindEnv(key, env)
+	}
+
+	activate(make(map[string]interface{}))
+}
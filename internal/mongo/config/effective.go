@@ -0,0 +1,232 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Sources of a configuration value.
+const (
+	SourceUnset    = "unset"
+	SourceDefault  = "default"
+	SourceFile     = "file"
+	SourceEnv      = "env"
+	SourceURI      = "uri"
+	SourceOverride = "override"
+)
+
+// masked replaces sensitive values within the effective configurations.
+const masked = "******"
+
+// sensitive configuration keys have their values masked.
+var sensitive = map[string]bool{
+	MongoDBPassword:          true,
+	MongoDBReadWritePassword: true,
+	MongoDBReadOnlyPassword:  true,
+	MongoDBTLSKeyPassword:    true,
+	MongoDBSSHPassphrase:     true,
+}
+
+var (
+	sourcesMu sync.Mutex
+	// keys set programmatically along with where their value came from
+	overrides = make(map[string]string)
+)
+
+// Setting is a single resolved configuration value.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Source reports where the value of a configuration key comes from.
+func Source(key string) string {
+	s := Active()
+
+	if src, ok := s.overrides[key]; ok {
+		return src
+	}
+
+	if env, ok := envVars[key]; ok {
+		if _, set := os.LookupEnv(env); set {
+			return SourceEnv
+		}
+	}
+
+	if _, file := s.file[key]; file || viper.InConfig(key) {
+		return SourceFile
+	}
+
+	if _, ok := defaults[key]; ok {
+		return SourceDefault
+	}
+
+	return SourceUnset
+}
+
+// Explicit reports if the value of a configuration key was explicitly configured rather than defaulted.
+func Explicit(key string) bool {
+	switch Source(key) {
+	case SourceUnset, SourceDefault:
+		return false
+	}
+
+	return true
+}
+
+// Effective lists every MongoDB configuration with its resolved value and source. Sensitive values,
+// including the password of the connection string, are masked.
+func Effective() []Setting {
+	s := Active()
+
+	uri := uriValues(s.GetString(MongoDBURI))
+
+	settings := make([]Setting, 0, len(s.values))
+
+	for key, value := range s.values {
+		st := Setting{Key: key, Value: format(value), Source: Source(key)}
+
+		if v, ok := uri[key]; ok && !Explicit(key) {
+			st.Value, st.Source = v, SourceURI
+		}
+
+		switch {
+		case key == MongoDBURI:
+			st.Value = maskURI(st.Value)
+		case sensitive[key] && st.Value != "":
+			st.Value = masked
+		}
+
+		settings = append(settings, st)
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+
+	return settings
+}
+
+func format(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(val, ",")
+	case []interface{}:
+		parts := make([]string, 0, len(val))
+		for _, p := range val {
+			parts = append(parts, fmt.Sprint(p))
+		}
+
+		return strings.Join(parts, ",")
+	}
+
+	return fmt.Sprint(v)
+}
+
+// uriValues extracts the configurations specified by a connection string.
+func uriValues(uri string) map[string]string {
+	values := make(map[string]string)
+
+	u, err := url.Parse(uri)
+	if err != nil || uri == "" {
+		return values
+	}
+
+	if u.Scheme == "mongodb+srv" {
+		values[MongoDBClusterSrv] = u.Host
+	} else {
+		values[MongoDBHosts] = u.Host
+	}
+
+	if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+		values[MongoDBName] = name
+	}
+
+	if u.User != nil {
+		values[MongoDBUsername] = u.User.Username()
+
+		if p, ok := u.User.Password(); ok {
+			values[MongoDBPassword] = p
+		}
+	}
+
+	q := u.Query()
+
+	for param, key := range map[string]string{
+		"authsource": MongoDBAuthSource,
+		"replicaset": MongoDBReplicaSet,
+		"tlscafile":  MongoDBCACert,
+	} {
+		for name, v := range q {
+			if strings.EqualFold(name, param) && len(v) > 0 {
+				values[key] = v[0]
+			}
+		}
+	}
+
+	return values
+}
+
+func maskURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return masked
+	}
+
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), masked)
+		}
+	}
+
+	return u.String()
+}
+
+func override(key string, value interface{}, source string) {
+	viper.Set(key, value)
+
+	sourcesMu.Lock()
+	overrides[key] = source
+	sourcesMu.Unlock()
+
+	activate(Active().file)
+}
+
+// flatten adds the values of a configuration file to values, keyed by configuration key.
+func flatten(prefix string, v interface{}, values map[string]interface{}) {
+	join := func(k interface{}) string {
+		name := strings.ToLower(fmt.Sprint(k))
+		if prefix == "" {
+			return name
+		}
+
+		return prefix + "." + name
+	}
+
+	switch m := v.(type) {
+	case map[string]interface{}:
+		for k, val := range m {
+			flatten(join(k), val, values)
+		}
+	case map[interface{}]interface{}:
+		for k, val := range m {
+			flatten(join(k), val, values)
+		}
+	default:
+		values[prefix] = v
+	}
+}
+
+func resetSources() {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	overrides = make(map[string]string)
+}
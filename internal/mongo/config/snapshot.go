@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// Snapshot holds the resolved configurations at a point in time. A snapshot is never modified once taken:
+// the active snapshot is replaced each time the configurations change, so readers never observe a partially
+// loaded configuration file, and configurations are restored by activating an earlier snapshot.
+type Snapshot struct {
+	// resolved value of each configuration key
+	values map[string]interface{}
+	// values of the keys loaded from MongoDB configuration files
+	file map[string]interface{}
+	// keys set programmatically along with where their value came from
+	overrides map[string]string
+}
+
+// active holds the snapshot of the configurations in use.
+var active atomic.Pointer[Snapshot]
+
+// Active provides the configurations in use.
+func Active() *Snapshot {
+	return active.Load()
+}
+
+// TakeSnapshot provides the configurations in use so they can be restored, such as after trying the future
+// configurations.
+func TakeSnapshot() *Snapshot {
+	return Active()
+}
+
+// Restore activates the configurations of the snapshot. Unlike loading a configuration file, keys set after
+// the snapshot was taken, such as those only within another configuration file, are removed. Defaults and
+// environment variables remain bound.
+func (s *Snapshot) Restore() {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	// an override without a value falls back to the other sources of the key
+	for key := range overrides {
+		if _, ok := s.overrides[key]; !ok {
+			viper.Set(key, nil)
+		}
+	}
+
+	for key := range s.overrides {
+		viper.Set(key, s.values[key])
+	}
+
+	overrides = make(map[string]string, len(s.overrides))
+	for key, src := range s.overrides {
+		overrides[key] = src
+	}
+
+	active.Store(s)
+}
+
+// Get provides the value of a configuration key.
+func (s *Snapshot) Get(key string) interface{} {
+	return s.values[key]
+}
+
+// GetString provides the value of a configuration key as a string.
+func (s *Snapshot) GetString(key string) string {
+	return cast.ToString(s.values[key])
+}
+
+// GetBool provides the value of a configuration key as a bool.
+func (s *Snapshot) GetBool(key string) bool {
+	return cast.ToBool(s.values[key])
+}
+
+// GetInt provides the value of a configuration key as an int.
+func (s *Snapshot) GetInt(key string) int {
+	return cast.ToInt(s.values[key])
+}
+
+// GetDuration provides the value of a configuration key as a duration.
+func (s *Snapshot) GetDuration(key string) time.Duration {
+	return cast.ToDuration(s.values[key])
+}
+
+// GetStringSlice provides the value of a configuration key as a slice of strings.
+func (s *Snapshot) GetStringSlice(key string) []string {
+	return cast.ToStringSlice(s.values[key])
+}
+
+// GetString provides the active value of a configuration key as a string.
+func GetString(key string) string {
+	return Active().GetString(key)
+}
+
+// GetBool provides the active value of a configuration key as a bool.
+func GetBool(key string) bool {
+	return Active().GetBool(key)
+}
+
+// GetInt provides the active value of a configuration key as an int.
+func GetInt(key string) int {
+	return Active().GetInt(key)
+}
+
+// GetDuration provides the active value of a configuration key as a duration.
+func GetDuration(key string) time.Duration {
+	return Active().GetDuration(key)
+}
+
+// GetStringSlice provides the active value of a configuration key as a slice of strings.
+func GetStringSlice(key string) []string {
+	return Active().GetStringSlice(key)
+}
+
+// Set overrides the value of a configuration key.
+func Set(key string, value interface{}) {
+	override(key, value, SourceOverride)
+}
+
+// activate resolves every configuration key, with the values of the configuration files taken from file, and
+// makes the result the active snapshot.
+func activate(file map[string]interface{}) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	s := &Snapshot{
+		values:    make(map[string]interface{}),
+		file:      file,
+		overrides: make(map[string]string, len(overrides)),
+	}
+
+	for key, src := range overrides {
+		s.overrides[key] = src
+	}
+
+	keys := make(map[string]bool)
+
+	for _, m := range []map[string]interface{}{defaults, file} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+
+	for _, m := range []map[string]string{envVars, overrides} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+
+	for key := range sensitive {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		s.values[key] = resolve(key, s)
+	}
+
+	active.Store(s)
+}
+
+// resolve provides the value of a key; overrides and environment variables take precedence over configuration
+// files, which take precedence over the defaults.
+func resolve(key string, s *Snapshot) interface{} {
+	if _, ok := s.overrides[key]; ok {
+		return viper.Get(key)
+	}
+
+	if env, ok := envVars[key]; ok {
+		if _, set := os.LookupEnv(env); set {
+			return viper.Get(key)
+		}
+	}
+
+	if value, ok := s.file[key]; ok {
+		return value
+	}
+
+	return viper.Get(key)
+}
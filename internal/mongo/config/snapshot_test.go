@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	defer Restore()
+
+	t.Setenv("MONGO_DB_STARTUP_DEGRADED", "false")
+
+	dir := t.TempDir()
+	current := filepath.Join(dir, "current.yaml")
+	future := filepath.Join(dir, "future.yaml")
+
+	write(t, current, "db.mongo:\n  name: current\n  compat: strict\n")
+	write(t, future, "db.mongo:\n  name: future\n  secrets:\n    provider: file\n")
+
+	override(MongoDBConfigFile, current, SourceOverride)
+
+	if err := LoadMongoConfigs(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := TakeSnapshot()
+
+	override(MongoDBConfigFile, future, SourceOverride)
+	Set(MongoDBPolicy, filepath.Join(dir, "policy.yaml"))
+
+	if err := LoadMongoConfigs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := GetString(MongoDBName); got != "future" {
+		t.Fatalf("name = %q before restore, want future", got)
+	}
+
+	if got := s.GetString(MongoDBName); got != "current" {
+		t.Errorf("name of the snapshot = %q after loading the future configurations, want current", got)
+	}
+
+	s.Restore()
+
+	for key, want := range map[string]string{
+		MongoDBName:            "current",
+		MongoDBCompat:          "strict",
+		MongoDBSecretsProvider: "env",
+		MongoDBConfigFile:      current,
+		MongoDBStartupDeadline: "30s",
+		MongoDBStartupDegraded: "false",
+		MongoDBPolicy:          "",
+	} {
+		if got := GetString(key); got != want {
+			t.Errorf("%s = %q after restore, want %q", key, got, want)
+		}
+	}
+
+	if got := Source(MongoDBSecretsProvider); got != SourceDefault {
+		t.Errorf("source of %s = %q after restore, want %q", MongoDBSecretsProvider, got, SourceDefault)
+	}
+
+	if got := Source(MongoDBConfigFile); got != SourceOverride {
+		t.Errorf("source of %s = %q after restore, want %q", MongoDBConfigFile, got, SourceOverride)
+	}
+
+	if got := Source(MongoDBStartupDegraded); got != SourceEnv {
+		t.Errorf("source of %s = %q after restore, want %q", MongoDBStartupDegraded, got, SourceEnv)
+	}
+
+	if got := Source(MongoDBPolicy); got != SourceUnset {
+		t.Errorf("source of %s = %q after restore, want %q", MongoDBPolicy, got, SourceUnset)
+	}
+}
+
+func write(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,9 @@
 /*
 Package mongo provides common functionality for using the official MongoDB driver (SDK).
 
+The package is forked from gitscm.cisco.com/mcmp/db/mongo v0.6.0 and is maintained within this module, along with
+its subpackages, as the datastore extends its connection, configuration and command handling.
+
 Constructor for creation of a configured MongoDB database connection using the standard configurations used within across MCMP.
 
 Example Constructor usage within a service (read-write)
@@ -0,0 +1,240 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+
+	wraperrors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// Subtype is the BSON binary subtype of encrypted values; within the user defined range so encrypted values
+// are not mistaken for those of the driver's own field level encryption.
+const Subtype byte = 0x80
+
+const (
+	version   byte = 1
+	nonceSize      = 12
+)
+
+// derivation labels the data keys derived for deterministic encryption.
+const derivation = "mcmp/db/mongo/encrypt deterministic"
+
+// ciphertext layout:
+//
+//	version | mode | len(key id) | key id | [len(wrapped key) | wrapped key] | nonce | sealed value
+//
+// The wrapped data key is only present for random encryption; deterministic data keys are derived from the
+// key and the field. The header and the field path are authenticated so values cannot be moved between fields.
+
+// seal encrypts the value of the field using the key.
+func seal(r *KeyRing, id string, mode Mode, path string, v interface{}) (primitive.Binary, error) {
+	key, err := r.key(id)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+
+	t, data, err := dbutil.MarshalValue(v)
+	if err != nil {
+		return primitive.Binary{}, wraperrors.Wrapf(err, "unable to marshal %q for encryption", path)
+	}
+
+	plaintext := append([]byte{byte(t)}, data...)
+
+	header := append([]byte{version, byte(mode), byte(len(id))}, id...)
+
+	var dataKey, nonce []byte
+
+	switch mode {
+	case Deterministic:
+		dataKey = derive(key, path)
+		nonce = mac(dataKey, append(append([]byte(path), 0), plaintext...))[:nonceSize]
+	default:
+		dataKey = make([]byte, keySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return primitive.Binary{}, wraperrors.Wrap(err, "unable to generate data key")
+		}
+
+		nonce = make([]byte, nonceSize)
+		if _, err := rand.Read(nonce); err != nil {
+			return primitive.Binary{}, wraperrors.Wrap(err, "unable to generate nonce")
+		}
+
+		wrapped, err := wrap(key, dataKey, header)
+		if err != nil {
+			return primitive.Binary{}, err
+		}
+
+		header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+		header = append(header, wrapped...)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+
+	out := append(header, nonce...)
+	out = gcm.Seal(out, nonce, plaintext, aad(header, path))
+
+	return primitive.Binary{Subtype: Subtype, Data: out}, nil
+}
+
+// open decrypts the value of the field.
+func open(r *KeyRing, path string, b primitive.Binary) (interface{}, error) {
+	p, err := parse(b)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to decrypt %q", path)
+	}
+
+	key, err := r.key(p.id)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to decrypt %q", path)
+	}
+
+	var dataKey []byte
+
+	if p.mode == Deterministic {
+		dataKey = derive(key, path)
+	} else if dataKey, err = unwrap(key, p.wrapped, p.header[:3+len(p.id)]); err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to decrypt %q", path)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, p.nonce, p.sealed, aad(p.header, path))
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to decrypt %q", path)
+	}
+
+	if len(plaintext) == 0 {
+		return nil, wraperrors.Errorf("unable to decrypt %q: empty value", path)
+	}
+
+	var v interface{}
+
+	raw := bson.RawValue{Type: bsontype.Type(plaintext[0]), Value: plaintext[1:]}
+	if err := raw.Unmarshal(&v); err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to unmarshal decrypted %q", path)
+	}
+
+	return v, nil
+}
+
+// parsed holds the parts of a ciphertext.
+type parsed struct {
+	mode    Mode
+	id      string
+	header  []byte
+	wrapped []byte
+	nonce   []byte
+	sealed  []byte
+}
+
+func parse(b primitive.Binary) (*parsed, error) {
+	data := b.Data
+
+	if b.Subtype != Subtype || len(data) < 3 || data[0] != version {
+		return nil, wraperrors.New("not an encrypted value")
+	}
+
+	p := &parsed{mode: Mode(data[1])}
+
+	n := 3 + int(data[2])
+	if len(data) < n {
+		return nil, wraperrors.New("truncated key id")
+	}
+
+	p.id = string(data[3:n])
+
+	if p.mode == Random {
+		if len(data) < n+2 {
+			return nil, wraperrors.New("truncated data key")
+		}
+
+		size := int(binary.BigEndian.Uint16(data[n:]))
+		if len(data) < n+2+size {
+			return nil, wraperrors.New("truncated data key")
+		}
+
+		p.wrapped = data[n+2 : n+2+size]
+		n += 2 + size
+	} else if p.mode != Deterministic {
+		return nil, wraperrors.Errorf("unknown encryption mode %d", p.mode)
+	}
+
+	if len(data) < n+nonceSize {
+		return nil, wraperrors.New("truncated nonce")
+	}
+
+	p.header = data[:n]
+	p.nonce = data[n : n+nonceSize]
+	p.sealed = data[n+nonceSize:]
+
+	return p, nil
+}
+
+// wrap encrypts the data key using the key.
+func wrap(key, dataKey, header []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, wraperrors.Wrap(err, "unable to generate nonce")
+	}
+
+	return gcm.Seal(nonce, nonce, dataKey, header), nil
+}
+
+// unwrap decrypts the data key using the key.
+func unwrap(key, wrapped, header []byte) ([]byte, error) {
+	if len(wrapped) < nonceSize {
+		return nil, wraperrors.New("truncated data key")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], header)
+}
+
+// derive provides the data key used for deterministic encryption of the field.
+func derive(key []byte, path string) []byte {
+	return mac(key, []byte(derivation+"\x00"+path))
+}
+
+func mac(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write(data)
+
+	return h.Sum(nil)
+}
+
+func aad(header []byte, path string) []byte {
+	return append(append([]byte(nil), header...), path...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, wraperrors.Wrap(err, "unable to create cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
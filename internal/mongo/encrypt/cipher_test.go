@@ -0,0 +1,139 @@
+package encrypt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testKeyRing(t *testing.T, primary string, ids ...string) *KeyRing {
+	t.Helper()
+
+	keys := make(map[string][]byte, len(ids))
+	for i, id := range ids {
+		keys[id] = bytes.Repeat([]byte{byte(i + 1)}, keySize)
+	}
+
+	r, err := NewKeyRing(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestSealOpen(t *testing.T) {
+	r := testKeyRing(t, "k1", "k1")
+
+	for _, tc := range []struct {
+		name  string
+		mode  Mode
+		value interface{}
+	}{
+		{"random string", Random, "123-45-6789"},
+		{"random int32", Random, int32(42)},
+		{"deterministic string", Deterministic, "alice@example.com"},
+		{"deterministic int64", Deterministic, int64(1) << 40},
+		{"deterministic empty", Deterministic, ""},
+	} {
+		b, err := seal(r, "k1", tc.mode, "field", tc.value)
+		if err != nil {
+			t.Errorf("%s: seal() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		if b.Subtype != Subtype {
+			t.Errorf("%s: seal() subtype = %#x, want %#x", tc.name, b.Subtype, Subtype)
+		}
+
+		v, err := open(r, "field", b)
+		if err != nil {
+			t.Errorf("%s: open() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(v, tc.value) {
+			t.Errorf("%s: open() = %#v, want %#v", tc.name, v, tc.value)
+		}
+
+		again, err := seal(r, "k1", tc.mode, "field", tc.value)
+		if err != nil {
+			t.Errorf("%s: seal() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		if same := bytes.Equal(b.Data, again.Data); same != (tc.mode == Deterministic) {
+			t.Errorf("%s: seal() of an equal value produced the same ciphertext %t, want %t", tc.name, same, tc.mode == Deterministic)
+		}
+	}
+
+	a, _ := seal(r, "k1", Deterministic, "email", "alice@example.com")
+	b, _ := seal(r, "k1", Deterministic, "backup", "alice@example.com")
+
+	if bytes.Equal(a.Data, b.Data) {
+		t.Errorf("seal() of equal values of different fields produced the same ciphertext")
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	r := testKeyRing(t, "k1", "k1", "k2")
+
+	for _, mode := range []Mode{Random, Deterministic} {
+		b, err := seal(r, "k1", mode, "ssn", "123-45-6789")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := parse(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header, nonce := len(p.header), len(p.header)+nonceSize
+
+		for _, tc := range []struct {
+			name   string
+			path   string
+			tamper func(data []byte) []byte
+		}{
+			{"version", "ssn", flip(0)},
+			{"mode", "ssn", flip(1)},
+			{"key id", "ssn", func(data []byte) []byte { data[4] = '2'; return data }},
+			{"nonce", "ssn", flip(header)},
+			{"sealed value", "ssn", flip(nonce)},
+			{"tag", "ssn", flip(len(b.Data) - 1)},
+			{"truncated", "ssn", func(data []byte) []byte { return data[:nonce] }},
+			{"other field", "email", func(data []byte) []byte { return data }},
+		} {
+			data := tc.tamper(append([]byte(nil), b.Data...))
+
+			if _, err := open(r, tc.path, primitive.Binary{Subtype: Subtype, Data: data}); err == nil {
+				t.Errorf("%s %s: open() succeeded, want error", mode, tc.name)
+			}
+		}
+
+		if mode == Random {
+			if _, err := open(r, "ssn", primitive.Binary{Subtype: Subtype, Data: flip(header - 1)(append([]byte(nil), b.Data...))}); err == nil {
+				t.Errorf("%s wrapped key: open() succeeded, want error", mode)
+			}
+		}
+
+		if _, err := open(r, "ssn", primitive.Binary{Subtype: 0x00, Data: b.Data}); err == nil {
+			t.Errorf("%s subtype: open() succeeded, want error", mode)
+		}
+	}
+}
+
+// flip inverts the bits of the byte at i.
+func flip(i int) func(data []byte) []byte {
+	return func(data []byte) []byte {
+		data[i] ^= 0xff
+
+		return data
+	}
+}
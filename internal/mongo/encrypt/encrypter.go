@@ -0,0 +1,418 @@
+package encrypt
+
+import (
+	"strings"
+
+	wraperrors "github.com/pkg/errors"
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	dbutil "docdb_poc/internal/mongo"
+	"docdb_poc/internal/mongo/config"
+)
+
+// Encrypter encrypts and decrypts the fields of documents as described by a Schema.
+type Encrypter struct {
+	ring   *KeyRing
+	schema Schema
+}
+
+// New creates an Encrypter for the Schema using the keys of the KeyRing.
+func New(ring *KeyRing, schema Schema) *Encrypter {
+	return &Encrypter{
+		ring:   ring,
+		schema: schema,
+	}
+}
+
+// Configured creates an Encrypter from the configured key ring and schema files; nil when encryption is not configured.
+func Configured() (*Encrypter, error) {
+	ringFile, schemaFile := config.GetString(config.MongoDBEncryptionKeyRing), config.GetString(config.MongoDBEncryptionSchema)
+
+	if ringFile == "" {
+		if schemaFile != "" {
+			return nil, wraperrors.Errorf("%q requires %q configurations", config.MongoDBEncryptionSchema, config.MongoDBEncryptionKeyRing)
+		}
+
+		return nil, nil
+	}
+
+	ring, err := LoadKeyRing(ringFile)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(Schema)
+
+	if schemaFile != "" {
+		if schema, err = LoadSchema(schemaFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return New(ring, schema), nil
+}
+
+// Fields provides the encrypted fields of the collection.
+func (e *Encrypter) Fields(collection string) Fields {
+	return e.schema[collection]
+}
+
+// Encrypt provides a copy of the document with the encrypted fields of the collection encrypted using the
+// primary key; the document is not modified.
+func (e *Encrypter) Encrypt(collection string, doc bson.M) (bson.M, error) {
+	return e.apply(collection, doc, func(path string, mode Mode, v interface{}) (interface{}, error) {
+		if isEncrypted(v) {
+			return v, nil
+		}
+
+		return seal(e.ring, e.ring.primary, mode, path, v)
+	})
+}
+
+// Decrypt provides a copy of the document with the encrypted fields of the collection decrypted; the
+// document is not modified.
+func (e *Encrypter) Decrypt(collection string, doc bson.M) (bson.M, error) {
+	return e.apply(collection, doc, func(path string, _ Mode, v interface{}) (interface{}, error) {
+		b, ok := v.(primitive.Binary)
+		if !ok || b.Subtype != Subtype {
+			return v, nil
+		}
+
+		return open(e.ring, path, b)
+	})
+}
+
+// Rotate provides a copy of the document with the fields encrypted using a key other than the primary key
+// encrypted again using the primary key. Returns false when no fields required rotation.
+func (e *Encrypter) Rotate(collection string, doc bson.M) (bson.M, bool, error) {
+	rotated := false
+
+	out, err := e.apply(collection, doc, func(path string, mode Mode, v interface{}) (interface{}, error) {
+		b, ok := v.(primitive.Binary)
+		if !ok || b.Subtype != Subtype {
+			return v, nil
+		}
+
+		p, err := parse(b)
+		if err != nil {
+			return nil, wraperrors.Wrapf(err, "unable to rotate %q", path)
+		}
+
+		if p.id == e.ring.primary && p.mode == mode {
+			return v, nil
+		}
+
+		plain, err := open(e.ring, path, b)
+		if err != nil {
+			return nil, err
+		}
+
+		rotated = true
+
+		return seal(e.ring, e.ring.primary, mode, path, plain)
+	})
+
+	return out, rotated, err
+}
+
+// Filters uses the search Query to construct a mongodb Collection.Find input with the values of the
+// deterministically encrypted fields encrypted; see Filter.
+func (e *Encrypter) Filters(collection string, q *search.Query) (bson.M, error) {
+	return e.Filter(collection, dbutil.Filters(q))
+}
+
+// Filter provides a copy of the filter with the values compared to deterministically encrypted fields
+// encrypted using every key of the KeyRing, so values encrypted before a key rotation are matched.
+// Only equality comparisons ($eq, $ne, $in and $nin), along with $exists and $type, which do not reveal the
+// values, are supported on encrypted fields.
+func (e *Encrypter) Filter(collection string, filter bson.M) (bson.M, error) {
+	fields := e.schema[collection]
+	if len(fields) == 0 {
+		return filter, nil
+	}
+
+	return e.filter(fields, filter)
+}
+
+func (e *Encrypter) filter(fields Fields, filter bson.M) (bson.M, error) {
+	out := make(bson.M, len(filter))
+
+	for key, value := range filter {
+		switch key {
+		case "$and", "$or", "$nor":
+			clauses, err := e.clauses(fields, value)
+			if err != nil {
+				return nil, err
+			}
+
+			out[key] = clauses
+
+			continue
+		}
+
+		mode, ok := fields[key]
+		if !ok || presence(value) {
+			out[key] = value
+
+			continue
+		}
+
+		if mode != Deterministic {
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, key, "a deterministically encrypted field to search")
+		}
+
+		cond, err := e.condition(key, value)
+		if err != nil {
+			return nil, err
+		}
+
+		out[key] = cond
+	}
+
+	return out, nil
+}
+
+// presence determines if the condition only tests the presence of the field, using $exists or $type.
+func presence(value interface{}) bool {
+	ops, ok := asM(value)
+	if !ok || len(ops) == 0 {
+		return false
+	}
+
+	for op := range ops {
+		if op != "$exists" && op != "$type" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *Encrypter) clauses(fields Fields, value interface{}) (bson.A, error) {
+	values, ok := list(value)
+	if !ok {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "logical operator", "an array of filters")
+	}
+
+	clauses := make(bson.A, 0, len(values))
+
+	for _, v := range values {
+		clause, ok := asM(v)
+		if !ok {
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "logical operator", "an array of filters")
+		}
+
+		f, err := e.filter(fields, clause)
+		if err != nil {
+			return nil, err
+		}
+
+		clauses = append(clauses, f)
+	}
+
+	return clauses, nil
+}
+
+// condition encrypts the values of the condition on a deterministically encrypted field.
+func (e *Encrypter) condition(path string, value interface{}) (bson.M, error) {
+	ops, ok := asM(value)
+	if !ok || !operators(ops) {
+		return e.match(path, "$in", bson.A{value})
+	}
+
+	out := make(bson.M, len(ops))
+
+	for op, v := range ops {
+		var (
+			cond bson.M
+			err  error
+		)
+
+		switch op {
+		case "$eq":
+			cond, err = e.match(path, "$in", bson.A{v})
+		case "$ne":
+			cond, err = e.match(path, "$nin", bson.A{v})
+		case "$in", "$nin":
+			values, ok := list(v)
+			if !ok {
+				return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, op, "an array of values")
+			}
+
+			cond, err = e.match(path, op, values)
+		default:
+			return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, path, "an equality comparison on an encrypted field")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for k, c := range cond {
+			if _, ok := out[k]; ok {
+				return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, path, "a single equality comparison on an encrypted field")
+			}
+
+			out[k] = c
+		}
+	}
+
+	return out, nil
+}
+
+// match encrypts each of the values with every key of the KeyRing.
+func (e *Encrypter) match(path, op string, values []interface{}) (bson.M, error) {
+	ids := e.ring.IDs()
+	encrypted := make(bson.A, 0, len(values)*len(ids))
+
+	for _, v := range values {
+		for _, id := range ids {
+			b, err := seal(e.ring, id, Deterministic, path, v)
+			if err != nil {
+				return nil, err
+			}
+
+			encrypted = append(encrypted, b)
+		}
+	}
+
+	return bson.M{op: encrypted}, nil
+}
+
+// apply replaces the value of each encrypted field of the collection present within the document.
+func (e *Encrypter) apply(collection string, doc bson.M, fn func(path string, mode Mode, v interface{}) (interface{}, error)) (bson.M, error) {
+	out := doc
+
+	for path, mode := range e.schema[collection] {
+		mode := mode
+		path := path
+
+		updated, err := update(out, strings.Split(path, "."), func(v interface{}) (interface{}, error) {
+			return fn(path, mode, v)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		out = updated.(bson.M)
+	}
+
+	return out, nil
+}
+
+// update replaces the value at the path within the document, copying the documents along the path so the
+// provided document is not modified. Values within arrays are not supported.
+func update(doc interface{}, path []string, fn func(v interface{}) (interface{}, error)) (interface{}, error) {
+	switch d := doc.(type) {
+	case bson.M:
+		v, ok := d[path[0]]
+		if !ok || v == nil {
+			return doc, nil
+		}
+
+		nv, err := replace(v, path, fn)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make(bson.M, len(d))
+		for k, v := range d {
+			out[k] = v
+		}
+
+		out[path[0]] = nv
+
+		return out, nil
+	case map[string]interface{}:
+		out, err := update(bson.M(d), path, fn)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}(out.(bson.M)), nil
+	case bson.D:
+		for i, elem := range d {
+			if elem.Key != path[0] || elem.Value == nil {
+				continue
+			}
+
+			nv, err := replace(elem.Value, path, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			out := append(bson.D(nil), d...)
+			out[i].Value = nv
+
+			return out, nil
+		}
+	}
+
+	return doc, nil
+}
+
+func replace(v interface{}, path []string, fn func(v interface{}) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(v)
+	}
+
+	return update(v, path[1:], fn)
+}
+
+func isEncrypted(v interface{}) bool {
+	b, ok := v.(primitive.Binary)
+
+	return ok && b.Subtype == Subtype
+}
+
+// operators determines if the document is a set of query operators rather than an embedded document.
+func operators(m bson.M) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+
+	return len(m) > 0
+}
+
+func asM(v interface{}) (bson.M, bool) {
+	switch d := v.(type) {
+	case bson.M:
+		return d, true
+	case map[string]interface{}:
+		return d, true
+	case bson.D:
+		return d.Map(), true
+	}
+
+	return nil, false
+}
+
+func list(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case bson.A:
+		return l, true
+	case []interface{}:
+		return l, true
+	case []string:
+		values := make([]interface{}, 0, len(l))
+		for _, s := range l {
+			values = append(values, s)
+		}
+
+		return values, true
+	case []bson.M:
+		values := make([]interface{}, 0, len(l))
+		for _, m := range l {
+			values = append(values, m)
+		}
+
+		return values, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,185 @@
+package encrypt
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testSchema = Schema{"users": {
+	"email":          Deterministic,
+	"ssn":            Random,
+	"address.street": Random,
+}}
+
+func TestEncryptDecrypt(t *testing.T) {
+	e := New(testKeyRing(t, "k1", "k1"), testSchema)
+
+	doc := bson.M{
+		"_id":     1,
+		"name":    "Alice",
+		"email":   "alice@example.com",
+		"ssn":     "123-45-6789",
+		"address": bson.M{"street": "Main Street", "city": "Springfield"},
+	}
+
+	encrypted, err := e.Encrypt("users", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"email", "ssn"} {
+		if !isEncrypted(encrypted[path]) {
+			t.Errorf("Encrypt() %s = %v, want encrypted", path, encrypted[path])
+		}
+	}
+
+	if address := encrypted["address"].(bson.M); !isEncrypted(address["street"]) || address["city"] != "Springfield" {
+		t.Errorf("Encrypt() address = %v, want the street encrypted", address)
+	}
+
+	if encrypted["name"] != "Alice" {
+		t.Errorf("Encrypt() name = %v, want Alice", encrypted["name"])
+	}
+
+	if doc["ssn"] != "123-45-6789" {
+		t.Errorf("Encrypt() modified the document: %v", doc)
+	}
+
+	again, err := e.Encrypt("users", encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(again, encrypted) {
+		t.Errorf("Encrypt() of encrypted values = %v, want them unchanged", again)
+	}
+
+	decrypted, err := e.Decrypt("users", encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decrypted, doc) {
+		t.Errorf("Decrypt() = %v, want %v", decrypted, doc)
+	}
+
+	if other, err := e.Encrypt("orders", doc); err != nil || !reflect.DeepEqual(other, doc) {
+		t.Errorf("Encrypt() of a collection without encrypted fields = %v %v, want the document", other, err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	old := New(testKeyRing(t, "k1", "k1"), testSchema)
+	rotated := New(testKeyRing(t, "k2", "k1", "k2"), testSchema)
+
+	doc := bson.M{"email": "alice@example.com", "ssn": "123-45-6789"}
+
+	encrypted, err := old.Encrypt("users", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decrypted, err := rotated.Decrypt("users", encrypted); err != nil || !reflect.DeepEqual(decrypted, doc) {
+		t.Errorf("Decrypt() with a previous key = %v %v, want %v", decrypted, err, doc)
+	}
+
+	out, ok, err := rotated.Rotate("users", encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Errorf("Rotate() of values encrypted with a previous key = false, want true")
+	}
+
+	for _, path := range []string{"email", "ssn"} {
+		p, err := parse(out[path].(primitive.Binary))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.id != "k2" {
+			t.Errorf("Rotate() %s key = %q, want k2", path, p.id)
+		}
+	}
+
+	if decrypted, err := rotated.Decrypt("users", out); err != nil || !reflect.DeepEqual(decrypted, doc) {
+		t.Errorf("Decrypt() of rotated values = %v %v, want %v", decrypted, err, doc)
+	}
+
+	if _, ok, err := rotated.Rotate("users", out); err != nil || ok {
+		t.Errorf("Rotate() of values encrypted with the primary key = %t %v, want false", ok, err)
+	}
+
+	if _, err := old.Decrypt("users", out); err == nil {
+		t.Errorf("Decrypt() without the primary key succeeded, want error")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	r := testKeyRing(t, "k2", "k1", "k2")
+	e := New(r, testSchema)
+
+	ciphertexts := func(values ...interface{}) bson.A {
+		out := bson.A{}
+
+		for _, v := range values {
+			for _, id := range []string{"k1", "k2"} {
+				b, err := seal(r, id, Deterministic, "email", v)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				out = append(out, b)
+			}
+		}
+
+		return out
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter bson.M
+		want   bson.M
+	}{
+		{"value", bson.M{"email": "a@x.com"}, bson.M{"email": bson.M{"$in": ciphertexts("a@x.com")}}},
+		{"$eq", bson.M{"email": bson.M{"$eq": "a@x.com"}}, bson.M{"email": bson.M{"$in": ciphertexts("a@x.com")}}},
+		{"$ne", bson.M{"email": bson.M{"$ne": "a@x.com"}}, bson.M{"email": bson.M{"$nin": ciphertexts("a@x.com")}}},
+		{"$in", bson.M{"email": bson.M{"$in": bson.A{"a@x.com", "b@x.com"}}}, bson.M{"email": bson.M{"$in": ciphertexts("a@x.com", "b@x.com")}}},
+		{"$exists", bson.M{"ssn": bson.M{"$exists": true}}, bson.M{"ssn": bson.M{"$exists": true}}},
+		{"other field", bson.M{"name": bson.M{"$gt": "A"}}, bson.M{"name": bson.M{"$gt": "A"}}},
+		{
+			"$or",
+			bson.M{"$or": bson.A{bson.M{"email": "a@x.com"}, bson.M{"name": "Alice"}}},
+			bson.M{"$or": bson.A{bson.M{"email": bson.M{"$in": ciphertexts("a@x.com")}}, bson.M{"name": "Alice"}}},
+		},
+	} {
+		got, err := e.Filter("users", tc.filter)
+		if err != nil {
+			t.Errorf("%s: Filter() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Filter() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter bson.M
+	}{
+		{"random field", bson.M{"ssn": "123-45-6789"}},
+		{"range", bson.M{"email": bson.M{"$gt": "a"}}},
+		{"$in not an array", bson.M{"email": bson.M{"$in": "a@x.com"}}},
+		{"$and not an array", bson.M{"$and": bson.M{"email": "a@x.com"}}},
+	} {
+		if _, err := e.Filter("users", tc.filter); err == nil {
+			t.Errorf("%s: Filter() succeeded, want error", tc.name)
+		}
+	}
+}
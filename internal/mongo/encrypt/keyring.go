@@ -0,0 +1,125 @@
+/*
+Package encrypt provides client-side encryption of document fields before they are sent to the database.
+
+Each value is encrypted with AES-256-GCM using a data key that is itself encrypted (wrapped) by a key of a
+locally configured KeyRing. Fields are encrypted either randomly, where equal values produce different
+ciphertexts, or deterministically, where equal values produce the same ciphertext for a key so the field can
+be searched for equality. Each ciphertext records the id of the key used, allowing keys to be rotated by
+adding a new primary key to the KeyRing while retaining the previous keys for decryption.
+
+Example key ring file (keyring.yaml); keys are base64 encoded 32 byte keys
+
+	primary: "2024-06"
+	keys:
+		"2023-01": 7Rz0s2Z2cM9dAAGJbU3QqgN2tmdd6X0yO9HfPkXcL1I=
+		"2024-06": bq9xU4b6gUj5wC5o8hC4Xh0fqVJHvW2y2mY+1zYAd3k=
+
+Example schema file (schema.yaml)
+
+	users:
+		email: deterministic
+		ssn: random
+		address.street: random
+*/
+package encrypt
+
+import (
+	"encoding/base64"
+	"os"
+	"sort"
+
+	wraperrors "github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// keySize is the size of the AES-256 keys.
+const keySize = 32
+
+// KeyRing holds the keys used to encrypt fields; new values are encrypted with the primary key.
+type KeyRing struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyRing creates a KeyRing of the 32 byte keys, encrypting new values with the primary key.
+func NewKeyRing(primary string, keys map[string][]byte) (*KeyRing, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, wraperrors.Errorf("primary key %q not found within the key ring", primary)
+	}
+
+	r := &KeyRing{
+		primary: primary,
+		keys:    make(map[string][]byte, len(keys)),
+	}
+
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, wraperrors.Errorf("key id %q must be between 1 and 255 characters", id)
+		}
+
+		if len(key) != keySize {
+			return nil, wraperrors.Errorf("key %q must be %d bytes", id, keySize)
+		}
+
+		r.keys[id] = append([]byte(nil), key...)
+	}
+
+	return r, nil
+}
+
+// LoadKeyRing reads a KeyRing from a YAML file.
+func LoadKeyRing(name string) (*KeyRing, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to read key ring %q", name)
+	}
+
+	var file struct {
+		Primary string            `yaml:"primary"`
+		Keys    map[string]string `yaml:"keys"`
+	}
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to parse key ring %q", name)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, wraperrors.Wrapf(err, "unable to decode key %q", id)
+		}
+
+		keys[id] = key
+	}
+
+	return NewKeyRing(file.Primary, keys)
+}
+
+// Primary provides the id of the key used to encrypt new values.
+func (r *KeyRing) Primary() string {
+	return r.primary
+}
+
+// IDs provides the ids of all keys within the KeyRing.
+func (r *KeyRing) IDs() []string {
+	ids := make([]string, 0, len(r.keys))
+
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (r *KeyRing) key(id string) ([]byte, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, wraperrors.Errorf("key %q not found within the key ring", id)
+	}
+
+	return key, nil
+}
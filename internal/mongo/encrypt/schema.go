@@ -0,0 +1,72 @@
+package encrypt
+
+import (
+	"os"
+
+	wraperrors "github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Mode determines how a field is encrypted.
+type Mode int
+
+// Supported encryption modes.
+const (
+	// Random encryption produces a different ciphertext for equal values; the field cannot be searched.
+	Random Mode = iota + 1
+	// Deterministic encryption produces the same ciphertext for equal values using the same key; the field
+	// can be searched for equality.
+	Deterministic
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Random:
+		return "random"
+	case Deterministic:
+		return "deterministic"
+	default:
+		return "unknown"
+	}
+}
+
+// UnmarshalYAML parses the name of the Mode.
+func (m *Mode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+
+	switch name {
+	case "random":
+		*m = Random
+	case "deterministic":
+		*m = Deterministic
+	default:
+		return wraperrors.Errorf("unknown encryption mode %q; expected random or deterministic", name)
+	}
+
+	return nil
+}
+
+// Fields maps the path of each encrypted field, using dot notation for embedded documents, to its Mode.
+type Fields map[string]Mode
+
+// Schema maps each collection to its encrypted Fields.
+type Schema map[string]Fields
+
+// LoadSchema reads a Schema from a YAML file.
+func LoadSchema(name string) (Schema, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to read encryption schema %q", name)
+	}
+
+	var schema Schema
+
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to parse encryption schema %q", name)
+	}
+
+	return schema, nil
+}
@@ -76,10 +76,13 @@ func Filters(q *search.Query) bson.M {
 	qf := make(bson.M)
 
 	for k, f := range q.Filters() {
-		switch mval := f.Value.(type) {
+		// strfmt values are compared to the values they are stored as by the Registry
+		switch mval := Value(f.Value).(type) {
 		case []string:
 			qf[id(k)] = bson.M{"$in": mval}
-		case time.Time, int, int32, int64, float32, float64:
+		case bson.A:
+			qf[id(k)] = bson.M{"$in": mval}
+		case time.Time, primitive.DateTime, int, int32, int64, float32, float64, primitive.Decimal128:
 			qf[id(k)] = asGenericComparison(f, mval)
 		case string:
 			qf[id(k)] = asStringComparison(f, mval)
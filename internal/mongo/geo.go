@@ -0,0 +1,97 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// EarthRadius is the radius of the earth, in meters, used to convert distances to the radians of $centerSphere.
+const EarthRadius = 6378100.0
+
+// distanceField is the field of the documents found by $geoNear receiving their distance.
+const distanceField = "_distance"
+
+// GeoNear provides the $geoNear stage finding the documents matching the filter holding a $nearSphere condition,
+// at its top level or within a top level $and, ordered by distance; false when the filter does not hold one.
+// Counting documents does not accept $nearSphere conditions, whereas the $geoNear stage is supported by Amazon
+// DocumentDB.
+func GeoNear(filter bson.M) (bson.D, bool) {
+	key, near, rest, ok := splitNear(filter)
+	if !ok {
+		return nil, false
+	}
+
+	stage := bson.D{
+		{Key: "near", Value: near["$geometry"]},
+		{Key: "distanceField", Value: distanceField},
+		{Key: "spherical", Value: true},
+		{Key: "key", Value: key},
+	}
+
+	if d, ok := near["$maxDistance"]; ok {
+		stage = append(stage, bson.E{Key: "maxDistance", Value: d})
+	}
+
+	if len(rest) > 0 {
+		stage = append(stage, bson.E{Key: "query", Value: rest})
+	}
+
+	return bson.D{{Key: "$geoNear", Value: stage}}, true
+}
+
+// splitNear separates the first $nearSphere condition of the filter from the rest of the filter. The condition
+// may be nested within $and clauses, such as those of a filter restricted by a grant; the clauses and conditions
+// may be bson.M, bson.D or map[string]interface{} documents held by any kind of array.
+func splitNear(filter bson.M) (string, bson.M, bson.M, bool) {
+	rest := make(bson.M, len(filter))
+	for k, v := range filter {
+		rest[k] = v
+	}
+
+	for k, v := range filter {
+		if cond, ok := asFilter(v); ok && len(cond) == 1 {
+			if near, ok := asFilter(cond["$nearSphere"]); ok {
+				delete(rest, k)
+
+				return k, near, rest, true
+			}
+		}
+	}
+
+	and := elements(filter["$and"])
+
+	for i, e := range and {
+		m, ok := asFilter(e)
+		if !ok {
+			continue
+		}
+
+		if key, near, r, ok := splitNear(m); ok {
+			clauses := append(bson.A(nil), and...)
+			clauses[i] = r
+			rest["$and"] = clauses
+
+			return key, near, rest, true
+		}
+	}
+
+	return "", nil, nil, false
+}
+
+// asFilter provides the document as a bson.M; false when the value is not a document.
+func asFilter(v interface{}) (bson.M, bool) {
+	if m, ok := v.(bson.M); ok {
+		return m, true
+	}
+
+	d := asDocument(v)
+	if d == nil {
+		return nil, false
+	}
+
+	m := make(bson.M, len(d))
+	for _, e := range d {
+		m[e.Key] = e.Value
+	}
+
+	return m, true
+}
@@ -0,0 +1,83 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGeoNear(t *testing.T) {
+	point := bson.M{"type": "Point", "coordinates": bson.A{-73.97, 40.77}}
+	near := bson.M{"$nearSphere": bson.M{"$geometry": point, "$maxDistance": 1000.0}}
+	grant := bson.M{"tenant": "t1"}
+
+	for _, tc := range []struct {
+		name   string
+		filter bson.M
+		query  bson.M
+	}{
+		{
+			name:   "top level",
+			filter: bson.M{"location": near, "status": "open"},
+			query:  bson.M{"status": "open"},
+		},
+		{
+			name:   "restricted by a grant",
+			filter: bson.M{"$and": bson.A{bson.M{"location": near, "status": "open"}, grant}},
+			query:  bson.M{"$and": bson.A{bson.M{"status": "open"}, grant}},
+		},
+		{
+			name:   "interface clauses",
+			filter: bson.M{"$and": []interface{}{map[string]interface{}{"location": map[string]interface{}(near)}, grant}},
+			query:  bson.M{"$and": bson.A{bson.M{}, grant}},
+		},
+		{
+			name:   "document clauses",
+			filter: bson.M{"$and": []bson.D{{{Key: "location", Value: bson.D{{Key: "$nearSphere", Value: near["$nearSphere"]}}}}, {{Key: "tenant", Value: "t1"}}}},
+			query:  bson.M{"$and": bson.A{bson.M{}, bson.D{{Key: "tenant", Value: "t1"}}}},
+		},
+		{
+			name:   "nested restrictions",
+			filter: bson.M{"$and": bson.A{bson.M{"$and": bson.A{bson.M{"location": near}, grant}}, bson.M{"owner": "me"}}},
+			query:  bson.M{"$and": bson.A{bson.M{"$and": bson.A{bson.M{}, grant}}, bson.M{"owner": "me"}}},
+		},
+	} {
+		stage, ok := GeoNear(tc.filter)
+		if !ok {
+			t.Errorf("%s: GeoNear() found no $nearSphere condition", tc.name)
+
+			continue
+		}
+
+		spec := stage[0].Value.(bson.D).Map()
+
+		if spec["key"] != "location" {
+			t.Errorf("%s: key = %v, want location", tc.name, spec["key"])
+		}
+
+		if !reflect.DeepEqual(spec["near"], point) {
+			t.Errorf("%s: near = %v, want %v", tc.name, spec["near"], point)
+		}
+
+		if spec["maxDistance"] != 1000.0 {
+			t.Errorf("%s: maxDistance = %v, want 1000", tc.name, spec["maxDistance"])
+		}
+
+		if !reflect.DeepEqual(spec["query"], tc.query) {
+			t.Errorf("%s: query = %#v, want %#v", tc.name, spec["query"], tc.query)
+		}
+	}
+}
+
+func TestGeoNearWithoutNear(t *testing.T) {
+	for _, filter := range []bson.M{
+		{"status": "open"},
+		{"location": bson.M{"$geoWithin": bson.M{"$centerSphere": bson.A{bson.A{0, 0}, 0.1}}}},
+		{"$and": bson.A{bson.M{"status": "open"}, bson.M{"tenant": "t1"}}},
+	} {
+		if _, ok := GeoNear(filter); ok {
+			t.Errorf("GeoNear(%v) found a $nearSphere condition", filter)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	logutil "gitscm.cisco.com/mcmp/utils/log"
+)
+
+// redaction adds the RedactionHook to the common logger once.
+var redaction sync.Once
+
+func log(ctx context.Context) logrus.FieldLogger {
+	l := logutil.Logger(ctx)
+
+	redaction.Do(func() {
+		if e, ok := l.(*logrus.Entry); ok {
+			e.Logger.AddHook(RedactionHook{})
+		}
+	})
+
+	return l.WithField("pkg", "mongo")
+}
@@ -0,0 +1,226 @@
+package mongo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+// monitors tracks the monitorState of every client created by New so the state can be reported on.
+var monitors sync.Map
+
+type connectionCounters struct {
+	total  int64
+	inuse  int64
+	failed int64
+}
+
+type monitorState struct {
+	mu sync.Mutex
+
+	appName     string
+	credentials string
+	poolLimit   uint64
+	ctx         context.Context
+	counters    map[string]*connectionCounters
+	topology    description.Topology
+}
+
+func newMonitor(ctx context.Context, appName, credentials string, poolLimit uint64) *monitorState {
+	return &monitorState{
+		appName:     appName,
+		credentials: credentials,
+		poolLimit:   poolLimit,
+		ctx:         ctx,
+		counters:    make(map[string]*connectionCounters),
+	}
+}
+
+func (m *monitorState) setPoolLimit(limit uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.poolLimit = limit
+}
+
+func (m *monitorState) ServerMonitor() *event.ServerMonitor {
+	return &event.ServerMonitor{
+		TopologyDescriptionChanged: m.TopologyDescriptionChanged,
+	}
+}
+
+func (m *monitorState) TopologyDescriptionChanged(ev *event.TopologyDescriptionChangedEvent) {
+	if ev == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.topology = ev.NewDescription
+}
+
+func (m *monitorState) PoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: m.Event,
+	}
+}
+
+func (m *monitorState) Event(ev *event.PoolEvent) {
+	if ev == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := log(m.ctx).WithField("mongodb.client.appname", m.appName).WithFields(formatEventFields(ev))
+
+	if _, ok := m.counters[ev.Address]; !ok {
+		m.counters[ev.Address] = new(connectionCounters)
+	}
+
+	switch ev.Type {
+	case event.ConnectionCreated:
+		m.counters[ev.Address].total++
+	case event.ConnectionClosed:
+		if m.counters[ev.Address].total > 0 {
+			m.counters[ev.Address].total--
+		}
+	case event.GetSucceeded:
+		m.counters[ev.Address].inuse++
+	case event.GetFailed:
+		m.counters[ev.Address].failed++
+	case event.ConnectionReturned:
+		if m.counters[ev.Address].inuse > 0 {
+			m.counters[ev.Address].inuse--
+		}
+	case event.PoolCleared, event.PoolClosedEvent:
+		m.counters[ev.Address] = new(connectionCounters)
+	}
+
+	l.WithFields(logrus.Fields{
+		"mongodb.connections.total":  m.counters[ev.Address].total,
+		"mongodb.connections.inuse":  m.counters[ev.Address].inuse,
+		"mongodb.connections.failed": m.counters[ev.Address].failed,
+	}).Info()
+}
+
+func formatEventFields(ev *event.PoolEvent) logrus.Fields {
+	fields := logrus.Fields{
+		"mongodb.pool.event.type":         ev.Type,
+		"mongodb.pool.event.address":      ev.Address,
+		"mongodb.pool.event.connectionId": ev.ConnectionID,
+	}
+
+	if ev.Reason != "" {
+		fields["mongodb.pool.event.reason"] = ev.Reason
+	}
+
+	if ev.PoolOptions != nil {
+		fields["mongodb.pool.event.options.max"] = ev.PoolOptions.MaxPoolSize
+		fields["mongodb.pool.event.options.min"] = ev.PoolOptions.MinPoolSize
+	}
+
+	return fields
+}
+
+// Status is a point-in-time snapshot of the cluster topology and connection pools observed by a client.
+type Status struct {
+	AppName     string
+	Credentials string
+	Topology    string
+	SetName     string
+	Primary     *ServerStatus
+	Secondaries []ServerStatus
+	Pools       []PoolStatus
+}
+
+// ServerStatus describes a single member of the cluster.
+type ServerStatus struct {
+	Address string
+	Kind    string
+	RTT     time.Duration
+	// Lag is the replication lag behind the primary; nil when the server does not report its last write.
+	Lag *time.Duration
+}
+
+// PoolStatus describes the utilization of the connection pool for a single server.
+type PoolStatus struct {
+	Address string
+	Total   int64
+	InUse   int64
+	Failed  int64
+	Limit   uint64
+}
+
+// CurrentStatus reports the Status of the client backing the provided database.
+// Returns false when the database was not created using New.
+func CurrentStatus(dbc *mongo.Database) (*Status, bool) {
+	v, ok := monitors.Load(dbc.Client())
+	if !ok {
+		return nil, false
+	}
+
+	return v.(*monitorState).Status(), true
+}
+
+func (m *monitorState) Status() *Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := &Status{
+		AppName:     m.appName,
+		Credentials: m.credentials,
+		Topology:    m.topology.Kind.String(),
+		SetName:     m.topology.SetName,
+	}
+
+	var primary *description.Server
+
+	for i := range m.topology.Servers {
+		if m.topology.Servers[i].Kind == description.RSPrimary {
+			primary = &m.topology.Servers[i]
+		}
+	}
+
+	for _, srv := range m.topology.Servers {
+		ss := ServerStatus{
+			Address: srv.Addr.String(),
+			Kind:    srv.Kind.String(),
+			RTT:     srv.AverageRTT,
+		}
+
+		switch srv.Kind {
+		case description.RSPrimary, description.Standalone, description.Mongos:
+			s.Primary = &ss
+		case description.RSSecondary:
+			if primary != nil && !primary.LastWriteTime.IsZero() && !srv.LastWriteTime.IsZero() {
+				lag := primary.LastWriteTime.Sub(srv.LastWriteTime)
+				ss.Lag = &lag
+			}
+
+			s.Secondaries = append(s.Secondaries, ss)
+		}
+	}
+
+	for addr, c := range m.counters {
+		s.Pools = append(s.Pools, PoolStatus{
+			Address: addr,
+			Total:   c.total,
+			InUse:   c.inuse,
+			Failed:  c.failed,
+			Limit:   m.poolLimit,
+		})
+	}
+
+	sort.Slice(s.Pools, func(i, j int) bool { return s.Pools[i].Address < s.Pools[j].Address })
+
+	return s
+}
@@ -0,0 +1,283 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// redacted replaces the values of deny-listed fields within the logs.
+const redacted = "<redacted>"
+
+// secretPatterns match values that look like secrets along with the replacement that masks the secret.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// credentials within connection strings
+	{regexp.MustCompile(`(mongodb(?:\+srv)?://[^:/@\s]+:)[^@\s]+@`), "${1}" + masked + "@"},
+	// key=value and "key": "value" pairs of well known secret names
+	{regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret|token|api_?key|access_?key)["']?\s*[:=]\s*["']?)[^\s"',;&]+`), "${1}" + masked},
+	{regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`), "${1}" + masked},
+	// AWS access key ids
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), masked},
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), masked},
+}
+
+// Scrub masks known secret values and values that look like secrets within s.
+func Scrub(s string) string {
+	s = MaskSecrets(s)
+
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+
+	return s
+}
+
+// Denied determines if the field name is deny-listed from the logs by the active configurations.
+func Denied(field string) bool {
+	return CurrentSettings().Denied(field)
+}
+
+// Shape provides the shape of a filter, document or value for logging: field names and operators are kept while
+// values are replaced by a placeholder of their type, such as "<string>". Values of deny-listed fields are
+// replaced by "<redacted>". Object IDs are kept as they are generated and carry no document content, as are the
+// options of regular expressions and the types of index keys, such as "2d", so logged commands can be linted.
+func Shape(v interface{}) interface{} {
+	return CurrentSettings().Shape(v)
+}
+
+// Shape provides the shape of v for logging, redacting the values of the fields deny-listed by the Settings.
+func (s *Settings) Shape(v interface{}) interface{} {
+	return s.shape("", v)
+}
+
+func (s *Settings) shape(key string, v interface{}) interface{} {
+	if key != "" && !strings.HasPrefix(key, "$") && s.Denied(key) {
+		return redacted
+	}
+
+	switch val := v.(type) {
+	case nil:
+		return "<null>"
+	case primitive.ObjectID:
+		return val
+	case bson.M:
+		out := make(bson.M, len(val))
+		for k, e := range val {
+			out[k] = s.shapeIn(key, k, e)
+		}
+
+		return out
+	case map[string]interface{}:
+		return s.shape(key, bson.M(val))
+	case bson.D:
+		out := make(bson.D, 0, len(val))
+		for _, e := range val {
+			out = append(out, bson.E{Key: e.Key, Value: s.shapeIn(key, e.Key, e.Value)})
+		}
+
+		return out
+	case bson.Raw:
+		var d bson.D
+		if err := bson.Unmarshal(val, &d); err != nil {
+			return "<document>"
+		}
+
+		return s.shape(key, d)
+	case mongo.Pipeline:
+		out := make(bson.A, 0, len(val))
+		for _, stage := range val {
+			out = append(out, s.shape("", stage))
+		}
+
+		return out
+	case bson.A:
+		return s.shapes(val)
+	case []interface{}:
+		return s.shapes(val)
+	case []string:
+		return fmt.Sprintf("[%d]<string>", len(val))
+	case string:
+		if key == "$options" {
+			return val
+		}
+
+		return "<string>"
+	case bool:
+		return "<bool>"
+	case int, int32, int64, uint, uint32, uint64:
+		return "<int>"
+	case float32, float64, primitive.Decimal128:
+		return "<number>"
+	case time.Time, primitive.DateTime, primitive.Timestamp:
+		return "<date>"
+	case primitive.Binary:
+		return "<binary>"
+	case primitive.Regex:
+		return primitive.Regex{Pattern: "<regex>", Options: val.Options}
+	default:
+		return fmt.Sprintf("<%T>", v)
+	}
+}
+
+// indexTypes are the types of index keys kept within the key of an index specification.
+var indexTypes = names("2d", "2dsphere", "geoHaystack", "hashed", "text")
+
+// shapeIn provides the shape of the value of the field within the document of the parent field.
+func (s *Settings) shapeIn(parent, key string, v interface{}) interface{} {
+	if t, ok := v.(string); ok && parent == "key" && indexTypes[t] {
+		return t
+	}
+
+	return s.shape(key, v)
+}
+
+func (s *Settings) shapes(values []interface{}) bson.A {
+	out := make(bson.A, 0, len(values))
+	for _, e := range values {
+		out = append(out, s.shape("", e))
+	}
+
+	return out
+}
+
+// RedactionHook is a logrus hook that masks the values of deny-listed fields and scrubs secret-looking values
+// from the message and fields of every log entry.
+type RedactionHook struct{}
+
+// Levels applies the hook to every level.
+func (RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the entry; the entry is a copy made for the hooks so the logger fields are not modified.
+func (RedactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Scrub(entry.Message)
+
+	s := CurrentSettings()
+
+	for k, v := range entry.Data {
+		if s.Denied(k) {
+			entry.Data[k] = redacted
+
+			continue
+		}
+
+		switch val := v.(type) {
+		case string:
+			entry.Data[k] = Scrub(val)
+		case error:
+			entry.Data[k] = Scrub(val.Error())
+		case fmt.Stringer:
+			entry.Data[k] = Scrub(val.String())
+		}
+	}
+
+	return nil
+}
+
+// commandLogger logs the shape of every command executed by a client when enabled by the Settings.
+func commandLogger(ctx context.Context, s *Settings, appName string) *event.CommandMonitor {
+	if !s.LogCommands {
+		return nil
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, ev *event.CommandStartedEvent) {
+			fields := logrus.Fields{
+				"mongodb.client.appname":   appName,
+				"mongodb.command.name":     ev.CommandName,
+				"mongodb.command.database": ev.DatabaseName,
+				"mongodb.command.request":  ev.RequestID,
+				"mongodb.command.shape":    shapeJSON(s, ev.Command),
+			}
+
+			// the value of the command name is the collection for collection level commands
+			if coll, ok := ev.Command.Lookup(ev.CommandName).StringValueOK(); ok {
+				fields["mongodb.command.collection"] = coll
+			}
+
+			log(ctx).WithFields(fields).Debug("MongoDB command started")
+		},
+		Succeeded: func(_ context.Context, ev *event.CommandSucceededEvent) {
+			log(ctx).WithFields(logrus.Fields{
+				"mongodb.client.appname":   appName,
+				"mongodb.command.name":     ev.CommandName,
+				"mongodb.command.request":  ev.RequestID,
+				"mongodb.command.duration": time.Duration(ev.DurationNanos),
+			}).Debug("MongoDB command succeeded")
+		},
+		Failed: func(_ context.Context, ev *event.CommandFailedEvent) {
+			log(ctx).WithFields(logrus.Fields{
+				"mongodb.client.appname":   appName,
+				"mongodb.command.name":     ev.CommandName,
+				"mongodb.command.request":  ev.RequestID,
+				"mongodb.command.duration": time.Duration(ev.DurationNanos),
+				"mongodb.command.failure":  Scrub(ev.Failure),
+			}).Debug("MongoDB command failed")
+		},
+	}
+}
+
+// shapeJSON provides the shape of the command as relaxed extended JSON, so that recorded commands can be
+// inspected by LintCommand.
+func shapeJSON(s *Settings, cmd bson.Raw) string {
+	out, err := bson.MarshalExtJSON(s.Shape(cmd), false, false)
+	if err != nil {
+		return fmt.Sprint(s.Shape(cmd))
+	}
+
+	return string(out)
+}
+
+// commandMonitors combines the monitors, notifying each of every event.
+func commandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	var active []*event.CommandMonitor
+
+	for _, m := range monitors {
+		if m != nil {
+			active = append(active, m)
+		}
+	}
+
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, ev *event.CommandStartedEvent) {
+			for _, m := range active {
+				if m.Started != nil {
+					m.Started(ctx, ev)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, ev *event.CommandSucceededEvent) {
+			for _, m := range active {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, ev)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, ev *event.CommandFailedEvent) {
+			for _, m := range active {
+				if m.Failed != nil {
+					m.Failed(ctx, ev)
+				}
+			}
+		},
+	}
+}
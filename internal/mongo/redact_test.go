@@ -0,0 +1,86 @@
+package mongo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShapeKeepsLintedValues(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cmd  bson.D
+		want string
+	}{
+		{
+			name: "regex options",
+			cmd: bson.D{
+				{Key: "find", Value: "users"},
+				{Key: "filter", Value: bson.D{{Key: "name", Value: primitive.Regex{Pattern: "^ann", Options: "s"}}}},
+			},
+			want: "filter.name $regex option s",
+		},
+		{
+			name: "$options",
+			cmd: bson.D{
+				{Key: "find", Value: "users"},
+				{Key: "filter", Value: bson.D{{Key: "name", Value: bson.D{{Key: "$regex", Value: "^ann"}, {Key: "$options", Value: "s"}}}}},
+			},
+			want: "filter.name $regex option s",
+		},
+		{
+			name: "index type",
+			cmd: bson.D{
+				{Key: "createIndexes", Value: "places"},
+				{Key: "indexes", Value: bson.A{bson.D{
+					{Key: "key", Value: bson.D{{Key: "location", Value: "2d"}}},
+					{Key: "name", Value: "location_2d"},
+				}}},
+			},
+			want: "indexes.0.key.location 2d index",
+		},
+	} {
+		out, err := bson.MarshalExtJSON(Shape(tc.cmd), false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var logged bson.D
+		if err := bson.UnmarshalExtJSON(out, false, &logged); err != nil {
+			t.Fatal(err)
+		}
+
+		found := LintCommand(logged)
+		if len(found) != 1 || found[0].String() != tc.want {
+			t.Errorf("%s: LintCommand(%s) = %v, want %q", tc.name, out, found, tc.want)
+		}
+	}
+}
+
+func TestShapeHidesValues(t *testing.T) {
+	shaped := Shape(bson.D{
+		{Key: "name", Value: "ann"},
+		{Key: "key", Value: bson.D{{Key: "kind", Value: "secret"}, {Key: "other", Value: "text"}}},
+		{Key: "pattern", Value: primitive.Regex{Pattern: "^ann", Options: "i"}},
+	}).(bson.D)
+
+	want := bson.D{
+		{Key: "name", Value: "<string>"},
+		{Key: "key", Value: bson.D{{Key: "kind", Value: "<string>"}, {Key: "other", Value: "text"}}},
+		{Key: "pattern", Value: primitive.Regex{Pattern: "<regex>", Options: "i"}},
+	}
+
+	for i, e := range want {
+		if got := shaped[i]; got.Key != e.Key || !equalValue(got.Value, e.Value) {
+			t.Errorf("Shape()[%d] = %v, want %v", i, got, e)
+		}
+	}
+}
+
+func equalValue(a, b interface{}) bool {
+	x, _ := bson.MarshalExtJSON(bson.D{{Key: "v", Value: a}}, false, false)
+	y, _ := bson.MarshalExtJSON(bson.D{{Key: "v", Value: b}}, false, false)
+
+	return string(x) == string(y)
+}
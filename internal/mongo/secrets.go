@@ -0,0 +1,301 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	wraperrors "github.com/pkg/errors"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// Names of the secrets used for database credentials.
+const (
+	SecretUsername = "username"
+	// SecretPassword is the password of the read-write user.
+	SecretPassword = "password"
+	// SecretReadOnlyPassword is the password used by connections selecting ReadOnly.
+	SecretReadOnlyPassword = "read_only_password"
+	SecretTLSKeyPassword   = "tls_key_password"
+	SecretSSHPassphrase    = "ssh_passphrase"
+)
+
+// Supported values of config.MongoDBSecretsProvider.
+const (
+	SecretsEnv  = "env"
+	SecretsFile = "file"
+	SecretsAWS  = "aws"
+)
+
+// masked replaces secret values within logs and configuration dumps.
+const masked = "******"
+
+// SecretProvider supplies the values of secrets by name. An empty value is returned for an unknown secret.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// Secrets selects the provider consulted for the database credentials instead of the configured provider.
+func Secrets(p SecretProvider) Selector {
+	return func(s *selections) {
+		s.secrets = p
+	}
+}
+
+// EnvSecrets provides secrets from the configurations; environment variables or configuration files.
+func EnvSecrets() SecretProvider {
+	return envSecrets{}
+}
+
+type envSecrets struct{}
+
+func (envSecrets) Secret(_ context.Context, name string) (string, error) {
+	switch name {
+	case SecretUsername:
+		return config.GetString(config.MongoDBUsername), nil
+	case SecretPassword:
+		if password := config.GetString(config.MongoDBReadWritePassword); password != "" {
+			return password, nil
+		}
+
+		return config.GetString(config.MongoDBPassword), nil
+	case SecretReadOnlyPassword:
+		return config.GetString(config.MongoDBReadOnlyPassword), nil
+	case SecretTLSKeyPassword:
+		return config.GetString(config.MongoDBTLSKeyPassword), nil
+	case SecretSSHPassphrase:
+		return config.GetString(config.MongoDBSSHPassphrase), nil
+	}
+
+	return config.GetString(name), nil
+}
+
+// FileSecrets provides secrets from a directory containing a file per secret, such as a mounted Kubernetes secret.
+func FileSecrets(dir string) SecretProvider {
+	return fileSecrets{dir: dir}
+}
+
+type fileSecrets struct {
+	dir string
+}
+
+func (p fileSecrets) Secret(_ context.Context, name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(p.dir, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", wraperrors.Wrapf(err, "unable to read secret %q", name)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// AWSSecrets provides secrets from a JSON file holding the SecretString of an AWS Secrets Manager secret,
+// such as the one generated for DocumentDB credentials: {"username": "...", "password": "...", ...}.
+// The password of the read-only user is held by the "read_only_password" key of the same secret.
+func AWSSecrets(path string) SecretProvider {
+	return awsSecrets{path: path}
+}
+
+type awsSecrets struct {
+	path string
+}
+
+func (p awsSecrets) Secret(_ context.Context, name string) (string, error) {
+	data, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return "", wraperrors.Wrapf(err, "unable to read secrets file %q", p.path)
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return "", wraperrors.Wrapf(err, "unable to parse secrets file %q", p.path)
+	}
+
+	switch v := values[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		b, _ := json.Marshal(v)
+
+		return string(b), nil
+	}
+}
+
+// CachedSecrets caches the secrets supplied by the provider, fetching them again once older than the refresh interval.
+// A cached value continues to be used when it can not be fetched again.
+func CachedSecrets(p SecretProvider, refresh time.Duration) SecretProvider {
+	return &cachedSecrets{
+		provider: p,
+		refresh:  refresh,
+		values:   make(map[string]cachedSecret),
+	}
+}
+
+type cachedSecret struct {
+	value   string
+	fetched time.Time
+}
+
+type cachedSecrets struct {
+	mu sync.Mutex
+
+	provider SecretProvider
+	refresh  time.Duration
+	values   map[string]cachedSecret
+}
+
+func (p *cachedSecrets) Secret(ctx context.Context, name string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cached, ok := p.values[name]
+	if ok && time.Since(cached.fetched) < p.refresh {
+		return cached.value, nil
+	}
+
+	value, err := p.provider.Secret(ctx, name)
+	if err != nil {
+		if ok {
+			log(ctx).Warnf("Unable to refresh secret %q; using cached value: %v", name, err)
+
+			return cached.value, nil
+		}
+
+		return "", err
+	}
+
+	p.values[name] = cachedSecret{value: value, fetched: time.Now()}
+
+	if sensitive(name) {
+		remember(name, value)
+	}
+
+	return value, nil
+}
+
+func (p *cachedSecrets) invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.values = make(map[string]cachedSecret)
+}
+
+// providers caches the configured providers so secrets are shared across clients.
+var providers sync.Map
+
+// configuredSecrets provides the SecretProvider selected by the configurations.
+func configuredSecrets() (SecretProvider, error) {
+	kind := config.GetString(config.MongoDBSecretsProvider)
+	path := config.GetString(config.MongoDBSecretsPath)
+
+	var p SecretProvider
+
+	switch kind {
+	case SecretsEnv, "":
+		// configurations are already held in memory
+		return EnvSecrets(), nil
+	case SecretsFile:
+		p = FileSecrets(path)
+	case SecretsAWS:
+		p = AWSSecrets(path)
+	default:
+		return nil, wraperrors.Errorf("unsupported %q %q", config.MongoDBSecretsProvider, kind)
+	}
+
+	if path == "" {
+		return nil, wraperrors.Errorf("missing %q configurations", config.MongoDBSecretsPath)
+	}
+
+	cached, _ := providers.LoadOrStore(kind+":"+path, CachedSecrets(p, config.GetDuration(config.MongoDBSecretsRefresh)))
+
+	return cached.(SecretProvider), nil
+}
+
+// RefreshSecrets discards all cached secrets so they are fetched again on next use.
+func RefreshSecrets() {
+	providers.Range(func(_, p interface{}) bool {
+		p.(*cachedSecrets).invalidate()
+
+		return true
+	})
+}
+
+// secretFiles lists the files holding secrets for the configured provider.
+func secretFiles() []string {
+	path := config.GetString(config.MongoDBSecretsPath)
+	if path == "" {
+		return nil
+	}
+
+	switch config.GetString(config.MongoDBSecretsProvider) {
+	case SecretsFile:
+		return []string{
+			filepath.Join(path, SecretUsername),
+			filepath.Join(path, SecretPassword),
+			filepath.Join(path, SecretReadOnlyPassword),
+			filepath.Join(path, SecretTLSKeyPassword),
+			filepath.Join(path, SecretSSHPassphrase),
+		}
+	case SecretsAWS:
+		return []string{path}
+	}
+
+	return nil
+}
+
+// secretValues holds the last value fetched of each password and key so it can be masked; a value replaced by
+// a newer one, such as after the secret is rotated, is no longer masked.
+var secretValues sync.Map
+
+// sensitive reports whether the named secret is a password or key; usernames are not masked.
+func sensitive(name string) bool {
+	switch name {
+	case SecretPassword, SecretReadOnlyPassword, SecretTLSKeyPassword, SecretSSHPassphrase:
+		return true
+	}
+
+	return false
+}
+
+// remember records the value of the named password or key so it is masked within logs, replacing its previous
+// value.
+func remember(name, value string) {
+	if value == "" {
+		secretValues.Delete(name)
+
+		return
+	}
+
+	secretValues.Store(name, value)
+}
+
+// Mask replaces a secret value with a placeholder of fixed length; empty values remain empty.
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return masked
+}
+
+// MaskSecrets replaces any known secret value contained within s.
+func MaskSecrets(s string) string {
+	secretValues.Range(func(_, value interface{}) bool {
+		s = strings.ReplaceAll(s, value.(string), masked)
+
+		return true
+	})
+
+	return s
+}
@@ -0,0 +1,55 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+)
+
+// rotatingSecrets provides the next of its values each time a secret is fetched.
+type rotatingSecrets struct {
+	values []string
+}
+
+func (p *rotatingSecrets) Secret(_ context.Context, _ string) (string, error) {
+	value := p.values[0]
+	p.values = p.values[1:]
+
+	return value, nil
+}
+
+func TestMaskSecrets(t *testing.T) {
+	t.Cleanup(func() {
+		secretValues.Delete(SecretPassword)
+		secretValues.Delete(SecretSSHPassphrase)
+	})
+
+	p := CachedSecrets(&rotatingSecrets{values: []string{"pw", "rotated-password", ""}}, 0)
+
+	for _, tc := range []struct {
+		name string
+		text string
+		want string
+	}{
+		{"short value", "auth failed for pw", "auth failed for ******"},
+		{"rotated value", "auth failed for pw with rotated-password", "auth failed for pw with ******"},
+		{"removed value", "auth failed for pw with rotated-password", "auth failed for pw with rotated-password"},
+	} {
+		if _, err := p.Secret(context.Background(), SecretPassword); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := MaskSecrets(tc.text); got != tc.want {
+			t.Errorf("%s: MaskSecrets() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	remember(SecretSSHPassphrase, "key")
+
+	if got := MaskSecrets("passphrase key"); got != "passphrase ******" {
+		t.Errorf("MaskSecrets() = %q, want the passphrase masked", got)
+	}
+
+	if got, err := CachedSecrets(&rotatingSecrets{values: []string{"ann"}}, 0).Secret(context.Background(), SecretUsername); err != nil || MaskSecrets(got) != "ann" {
+		t.Errorf("MaskSecrets() of a username = %q %v, want it unmasked", MaskSecrets(got), err)
+	}
+}
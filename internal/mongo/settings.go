@@ -0,0 +1,67 @@
+package mongo
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// Settings holds the configurations consulted by every command and log entry. They are read once each time the
+// configurations are loaded, rather than on every use, and never change afterwards.
+type Settings struct {
+	// Compat is the handling of the features of commands not supported by Amazon DocumentDB.
+	Compat CompatMode
+	// LogCommands determines if the shape of every command is logged.
+	LogCommands bool
+
+	// lower-cased names of the fields whose values are never logged
+	deny     map[string]bool
+	snapshot *config.Snapshot
+}
+
+// settings caches the Settings of the active configurations.
+var settings atomic.Pointer[Settings]
+
+// CurrentSettings provides the Settings of the active configurations.
+func CurrentSettings() *Settings {
+	snap := config.Active()
+
+	if s := settings.Load(); s != nil && s.snapshot == snap {
+		return s
+	}
+
+	s := newSettings(snap)
+	settings.Store(s)
+
+	return s
+}
+
+func newSettings(snap *config.Snapshot) *Settings {
+	s := &Settings{
+		Compat:      CompatMode(snap.GetString(config.MongoDBCompat)),
+		LogCommands: snap.GetBool(config.MongoDBLogCommands),
+		deny:        make(map[string]bool),
+		snapshot:    snap,
+	}
+
+	for _, v := range snap.GetStringSlice(config.MongoDBLogDeny) {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				s.deny[strings.ToLower(name)] = true
+			}
+		}
+	}
+
+	return s
+}
+
+// Denied determines if the field name is deny-listed from the logs; the last element of a dotted path is compared
+// ignoring case.
+func (s *Settings) Denied(field string) bool {
+	if i := strings.LastIndex(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+
+	return s.deny[strings.ToLower(field)]
+}
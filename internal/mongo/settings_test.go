@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"testing"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+func TestSettings(t *testing.T) {
+	configure(t, map[string]string{"MONGO_DB_LOG_DENY": "Password, apiKey,,", "MONGO_DB_COMPAT": "strict"}, "")
+
+	s := CurrentSettings()
+	if s.Compat != CompatStrict {
+		t.Errorf("Compat = %q, want %q", s.Compat, CompatStrict)
+	}
+
+	for _, tc := range []struct {
+		field string
+		want  bool
+	}{
+		{"password", true},
+		{"user.PASSWORD", true},
+		{"apikey", true},
+		{"email", false},
+		{"password.hint", false},
+	} {
+		if got := s.Denied(tc.field); got != tc.want {
+			t.Errorf("Denied(%q) = %v, want %v", tc.field, got, tc.want)
+		}
+	}
+
+	if again := CurrentSettings(); again != s {
+		t.Error("CurrentSettings() read the unchanged configurations again")
+	}
+
+	config.Set(config.MongoDBCompat, string(CompatOff))
+
+	if got := CurrentSettings().Compat; got != CompatOff {
+		t.Errorf("Compat = %q after the configurations changed, want %q", got, CompatOff)
+	}
+
+	if s.Compat != CompatStrict {
+		t.Errorf("Compat of the earlier Settings = %q, want %q", s.Compat, CompatStrict)
+	}
+}
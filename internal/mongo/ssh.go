@@ -0,0 +1,319 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	wraperrors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// tunnels tracks the SSHDialer of every client created by New so the tunnel is closed on Disconnect.
+var tunnels sync.Map
+
+// SSHTunnel selects a dialer that reaches the cluster through an SSH bastion instead of the configured db.mongo.ssh.* dialer.
+func SSHTunnel(d *SSHDialer) Selector {
+	return func(s *selections) {
+		s.tunnel = d
+	}
+}
+
+// SSHDialer dials connections to the cluster through an SSH bastion. The SSH connection to the bastion is
+// established on first use and re-established if it is lost.
+type SSHDialer struct {
+	mu sync.Mutex
+
+	addr   string
+	config *ssh.ClientConfig
+	client *ssh.Client
+	// connection to the SSH agent signing for the configured dialer, if any
+	agent io.Closer
+}
+
+// NewSSHDialer creates an SSHDialer connecting to the bastion at addr (host:port) using the provided configuration.
+func NewSSHDialer(addr string, cfg *ssh.ClientConfig) *SSHDialer {
+	return &SSHDialer{addr: addr, config: cfg}
+}
+
+// DialContext implements options.ContextDialer; the address is resolved and dialed by the bastion.
+func (d *SSHDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ch := make(chan result, 1)
+
+	go func() {
+		conn, err := d.dial(network, address)
+		ch <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+
+		return nil, ctx.Err()
+	case r := <-ch:
+		return r.conn, r.err
+	}
+}
+
+func (d *SSHDialer) dial(network, address string) (net.Conn, error) {
+	c, err := d.sshClient()
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := c.Dial(network, address)
+	if err != nil {
+		// the bastion connection may have been lost; reconnect on the next dial unless the bastion
+		// rejected the channel, such as when the address cannot be reached from the bastion
+		if !errors.As(err, new(*ssh.OpenChannelError)) {
+			d.reset(c)
+		}
+
+		return nil, wraperrors.Wrapf(err, "unable to reach %s through SSH bastion %s", address, d.addr)
+	}
+
+	// connections forwarded over SSH report unspecified addresses
+	raddr, err := net.ResolveTCPAddr(network, address)
+	if err != nil {
+		return pipe(remote, remote.RemoteAddr()), nil
+	}
+
+	return pipe(remote, raddr), nil
+}
+
+func (d *SSHDialer) sshClient() (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	c, err := ssh.Dial("tcp", d.addr, d.config)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to connect to SSH bastion %s", d.addr)
+	}
+
+	d.client = c
+
+	return c, nil
+}
+
+func (d *SSHDialer) reset(c *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == c {
+		_ = c.Close()
+		d.client = nil
+	}
+}
+
+// Close closes the connection to the bastion along with every connection dialed through it, and the connection
+// to the SSH agent of a configured dialer.
+func (d *SSHDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var err error
+
+	if d.client != nil {
+		err = d.client.Close()
+		d.client = nil
+	}
+
+	if d.agent != nil {
+		if aerr := d.agent.Close(); err == nil {
+			err = aerr
+		}
+
+		d.agent = nil
+	}
+
+	return err
+}
+
+// pipe wraps a connection forwarded over SSH to the address, which does not support deadlines, with an
+// in-memory connection that does as the driver relies on deadlines for timeouts.
+func pipe(remote net.Conn, raddr net.Addr) net.Conn {
+	local, forward := net.Pipe()
+
+	go func() {
+		_, _ = io.Copy(remote, forward)
+		_ = remote.Close()
+	}()
+
+	go func() {
+		_, _ = io.Copy(forward, remote)
+		_ = forward.Close()
+	}()
+
+	return &tunnelConn{Conn: local, remote: remote, raddr: raddr}
+}
+
+// tunnelConn reports the addresses of the forwarded connection rather than the in-memory pipe.
+type tunnelConn struct {
+	net.Conn
+	remote net.Conn
+	raddr  net.Addr
+}
+
+func (c *tunnelConn) LocalAddr() net.Addr {
+	return c.remote.LocalAddr()
+}
+
+func (c *tunnelConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// newSSHDialer creates the SSHDialer from the db.mongo.ssh.* configurations.
+// Returns nil when no bastion is configured.
+func newSSHDialer(ctx context.Context, s *selections) (*SSHDialer, error) {
+	if s.tunnel != nil {
+		return s.tunnel, nil
+	}
+
+	host := config.GetString(config.MongoDBSSHHost)
+	if host == "" {
+		return nil, nil
+	}
+
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+
+	user := config.GetString(config.MongoDBSSHUser)
+	if user == "" {
+		return nil, wraperrors.Errorf("missing %q configurations", config.MongoDBSSHUser)
+	}
+
+	hostKeys, err := knownHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	auth, agentConn, err := sshAuth(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewSSHDialer(host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         config.GetDuration(config.MongoDBSSHTimeout),
+	})
+	d.agent = agentConn
+
+	return d, nil
+}
+
+func knownHosts() (ssh.HostKeyCallback, error) {
+	file := config.GetString(config.MongoDBSSHKnownHosts)
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, wraperrors.Wrapf(err, "missing %q configurations", config.MongoDBSSHKnownHosts)
+		}
+
+		file = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	cb, err := knownhosts.New(file)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to load %q", config.MongoDBSSHKnownHosts)
+	}
+
+	return cb, nil
+}
+
+// sshAuth provides the methods authenticating with the bastion along with the connection to the SSH agent,
+// if used, which remains open for the methods to sign with.
+func sshAuth(ctx context.Context, s *selections) ([]ssh.AuthMethod, io.Closer, error) {
+	var methods []ssh.AuthMethod
+
+	if keyFile := config.GetString(config.MongoDBSSHKeyFile); keyFile != "" {
+		signer, err := sshSigner(ctx, s, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if !config.GetBool(config.MongoDBSSHAgent) {
+		if len(methods) == 0 {
+			return nil, nil, wraperrors.Errorf("missing both %q and %q configurations", config.MongoDBSSHKeyFile, config.MongoDBSSHAgent)
+		}
+
+		return methods, nil, nil
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, wraperrors.Errorf("%q requires SSH_AUTH_SOCK to be set", config.MongoDBSSHAgent)
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, wraperrors.Wrap(err, "unable to connect to SSH agent")
+	}
+
+	return append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers)), conn, nil
+}
+
+func sshSigner(ctx context.Context, s *selections, keyFile string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, wraperrors.Wrapf(err, "unable to read %q", config.MongoDBSSHKeyFile)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+		return signer, wraperrors.Wrapf(err, "invalid %q", config.MongoDBSSHKeyFile)
+	}
+
+	p := s.secrets
+	if p == nil {
+		if p, err = configuredSecrets(); err != nil {
+			return nil, err
+		}
+	}
+
+	passphrase, err := p.Secret(ctx, SecretSSHPassphrase)
+	if err != nil {
+		return nil, wraperrors.Wrap(err, "unable to read SSH key passphrase")
+	}
+
+	remember(SecretSSHPassphrase, passphrase)
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+
+	return signer, wraperrors.Wrapf(err, "unable to decrypt %q", config.MongoDBSSHKeyFile)
+}
+
+// closeTunnel closes the SSH tunnel used by the client, if any.
+func closeTunnel(c *mongo.Client) {
+	if d, ok := tunnels.LoadAndDelete(c); ok {
+		_ = d.(*SSHDialer).Close()
+	}
+}
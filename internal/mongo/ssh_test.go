@@ -0,0 +1,595 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// bastion is an in-process SSH server forwarding direct-tcpip channels, as an SSH bastion does.
+type bastion struct {
+	addr    string
+	hostKey ssh.Signer
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+}
+
+func startBastion(t *testing.T, authorized ssh.PublicKey) *bastion {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, errors.New("unauthorized key")
+			}
+
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	b := &bastion{addr: l.Addr().String(), hostKey: hostKey}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go b.serve(conn, cfg)
+		}
+	}()
+
+	return b
+}
+
+func (b *bastion) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	sc, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		_ = conn.Close()
+
+		return
+	}
+
+	b.mu.Lock()
+	b.conns = append(b.conns, sc)
+	b.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "direct-tcpip" {
+			_ = nc.Reject(ssh.UnknownChannelType, "only direct-tcpip channels are forwarded")
+
+			continue
+		}
+
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+
+		if err := ssh.Unmarshal(nc.ExtraData(), &target); err != nil {
+			_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+
+			continue
+		}
+
+		remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+
+			continue
+		}
+
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			_ = remote.Close()
+
+			continue
+		}
+
+		go ssh.DiscardRequests(chReqs)
+
+		go func() {
+			_, _ = io.Copy(ch, remote)
+			_ = ch.Close()
+		}()
+
+		go func() {
+			_, _ = io.Copy(remote, ch)
+			_ = remote.Close()
+		}()
+	}
+}
+
+// connections provides the number of SSH connections the bastion accepted.
+func (b *bastion) connections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.conns)
+}
+
+// drop closes the SSH connections, as when the bastion restarts.
+func (b *bastion) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.conns {
+		_ = c.Close()
+	}
+}
+
+// startEcho starts a TCP server writing back what it reads, standing in for the cluster.
+func startEcho(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func newClientKey(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func echo(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("SetDeadline() failed: %v", err)
+	}
+
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+
+	if string(got) != msg {
+		t.Errorf("Read() = %q, want %q", got, msg)
+	}
+}
+
+func TestSSHDialer(t *testing.T) {
+	key := newClientKey(t)
+	b := startBastion(t, key.PublicKey())
+	target := startEcho(t)
+
+	d := NewSSHDialer(b.addr, &ssh.ClientConfig{
+		User:            "tunnel",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.FixedHostKey(b.hostKey.PublicKey()),
+	})
+	defer d.Close()
+
+	conn, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	echo(t, conn, "ping")
+
+	if got := conn.RemoteAddr().String(); got != target {
+		t.Errorf("RemoteAddr() = %s, want %s", got, target)
+	}
+
+	// the driver relies on deadlines for its timeouts
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	var ne net.Error
+	if _, err := conn.Read(make([]byte, 1)); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("Read() past the deadline = %v, want a timeout", err)
+	}
+
+	other, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	echo(t, other, "pong")
+
+	if n := b.connections(); n != 1 {
+		t.Errorf("bastion accepted %d connections, want 1 shared by the dialed connections", n)
+	}
+}
+
+func TestSSHDialerReconnects(t *testing.T) {
+	key := newClientKey(t)
+	b := startBastion(t, key.PublicKey())
+	target := startEcho(t)
+
+	d := NewSSHDialer(b.addr, &ssh.ClientConfig{
+		User:            "tunnel",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.FixedHostKey(b.hostKey.PublicKey()),
+	})
+	defer d.Close()
+
+	conn, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.Close()
+
+	b.drop()
+
+	// the first dial after the connection is lost may fail, the next reconnects
+	for attempt := 0; ; attempt++ {
+		conn, err = d.DialContext(context.Background(), "tcp", target)
+		if err == nil {
+			break
+		}
+
+		if attempt == 1 {
+			t.Fatalf("DialContext() after the bastion connection was lost failed: %v", err)
+		}
+	}
+	defer conn.Close()
+
+	echo(t, conn, "again")
+
+	if n := b.connections(); n != 2 {
+		t.Errorf("bastion accepted %d connections, want 2", n)
+	}
+}
+
+func TestSSHDialerRejects(t *testing.T) {
+	key := newClientKey(t)
+	b := startBastion(t, key.PublicKey())
+	target := startEcho(t)
+	other := newClientKey(t)
+
+	for _, tc := range []struct {
+		name string
+		cfg  *ssh.ClientConfig
+	}{
+		{
+			name: "unknown host key",
+			cfg: &ssh.ClientConfig{
+				User:            "tunnel",
+				Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+				HostKeyCallback: ssh.FixedHostKey(other.PublicKey()),
+			},
+		},
+		{
+			name: "unauthorized key",
+			cfg: &ssh.ClientConfig{
+				User:            "tunnel",
+				Auth:            []ssh.AuthMethod{ssh.PublicKeys(other)},
+				HostKeyCallback: ssh.FixedHostKey(b.hostKey.PublicKey()),
+			},
+		},
+	} {
+		d := NewSSHDialer(b.addr, tc.cfg)
+
+		if conn, err := d.DialContext(context.Background(), "tcp", target); err == nil {
+			_ = conn.Close()
+
+			t.Errorf("%s: DialContext() succeeded, want error", tc.name)
+		}
+	}
+}
+
+func TestSSHDialerKeepsBastionOnRejectedChannel(t *testing.T) {
+	key := newClientKey(t)
+	b := startBastion(t, key.PublicKey())
+	target := startEcho(t)
+
+	// an address the bastion cannot reach
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unreachable := l.Addr().String()
+	_ = l.Close()
+
+	d := NewSSHDialer(b.addr, &ssh.ClientConfig{
+		User:            "tunnel",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.FixedHostKey(b.hostKey.PublicKey()),
+	})
+	defer d.Close()
+
+	if conn, err := d.DialContext(context.Background(), "tcp", unreachable); err == nil {
+		_ = conn.Close()
+
+		t.Fatal("DialContext() of an unreachable address succeeded, want error")
+	}
+
+	conn, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	echo(t, conn, "kept")
+
+	if n := b.connections(); n != 1 {
+		t.Errorf("bastion accepted %d connections, want 1 kept after the rejected channel", n)
+	}
+}
+
+func TestSSHDialerContext(t *testing.T) {
+	// a bastion that never completes the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	d := NewSSHDialer(l.Addr().String(), &ssh.ClientConfig{
+		User:            "tunnel",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(newClientKey(t))},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := d.DialContext(ctx, "tcp", "127.0.0.1:27017"); err != context.DeadlineExceeded {
+		t.Errorf("DialContext() = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+type passphrase string
+
+func (p passphrase) Secret(_ context.Context, name string) (string, error) {
+	if name != SecretSSHPassphrase {
+		return "", nil
+	}
+
+	return string(p), nil
+}
+
+func TestNewSSHDialer(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key encrypted in the legacy PEM format, which ParsePrivateKeyWithPassphrase decrypts
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), []byte("s3cret-phrase"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ssh.NewSignerFromKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := startBastion(t, key.PublicKey())
+	target := startEcho(t)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_rsa")
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(b.addr)}, b.hostKey.PublicKey())
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := map[string]string{
+		config.MongoDBSSHHost:       b.addr,
+		config.MongoDBSSHUser:       "tunnel",
+		config.MongoDBSSHKeyFile:    keyFile,
+		config.MongoDBSSHKnownHosts: knownHostsFile,
+	}
+
+	for k, v := range settings {
+		config.Set(k, v)
+	}
+
+	t.Cleanup(func() {
+		for k := range settings {
+			config.Set(k, "")
+		}
+	})
+
+	d, err := newSSHDialer(context.Background(), &selections{secrets: passphrase("s3cret-phrase")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	conn, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	echo(t, conn, "configured")
+
+	if _, err := newSSHDialer(context.Background(), &selections{secrets: passphrase("wrong-phrase")}); err == nil {
+		t.Error("newSSHDialer() with a wrong passphrase succeeded, want error")
+	}
+
+	config.Set(config.MongoDBSSHHost, "")
+
+	if d, err := newSSHDialer(context.Background(), &selections{}); d != nil || err != nil {
+		t.Errorf("newSSHDialer() without a bastion = %v, %v, want none", d, err)
+	}
+}
+
+func TestNewSSHDialerAgent(t *testing.T) {
+	_, agentKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: &agentKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(agentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := startBastion(t, signer.PublicKey())
+	target := startEcho(t)
+
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "agent.sock")
+
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// closed once the dialer closes its connection to the agent
+	served := make(chan struct{})
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		_ = agent.ServeAgent(keyring, conn)
+		close(served)
+	}()
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(b.addr)}, b.hostKey.PublicKey())
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	t.Cleanup(config.Restore)
+
+	for k, v := range map[string]interface{}{
+		config.MongoDBSSHHost:       b.addr,
+		config.MongoDBSSHUser:       "tunnel",
+		config.MongoDBSSHKnownHosts: knownHostsFile,
+		config.MongoDBSSHAgent:      true,
+	} {
+		config.Set(k, v)
+	}
+
+	d, err := newSSHDialer(context.Background(), &selections{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	echo(t, conn, "agent")
+
+	if err := d.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Error("Close() left the connection to the SSH agent open")
+	}
+}
@@ -0,0 +1,197 @@
+package mongo
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// minBackoff bounds the wait between attempts so an unset backoff does not retry without pause.
+const minBackoff = 50 * time.Millisecond
+
+// verifiers holds the function stopping the background verification of each client started in degraded mode.
+var verifiers sync.Map
+
+// startup holds the policy used to wait for the cluster while creating a client.
+type startup struct {
+	deadline   time.Duration
+	backoff    time.Duration
+	maxBackoff time.Duration
+	degraded   bool
+}
+
+func newStartup(s *selections) *startup {
+	return &startup{
+		deadline:   config.GetDuration(config.MongoDBStartupDeadline),
+		backoff:    atLeast(config.GetDuration(config.MongoDBStartupBackoff), minBackoff),
+		maxBackoff: config.GetDuration(config.MongoDBStartupMaxBackoff),
+		degraded:   config.GetBool(config.MongoDBStartupDegraded) && !s.verified,
+	}
+}
+
+// connect creates a client using the options provided by newOpts and verifies the cluster can be reached,
+// retrying each with backoff until the startup deadline is exceeded. In degraded mode a client that cannot
+// reach the cluster by the deadline is returned anyway and the cluster is verified in the background.
+//
+// Options are re-created for each attempt as a failed DNS SRV lookup is retained by the options.
+func (p *startup) connect(ctx context.Context, newOpts func() *options.ClientOptions) (*mongo.Client, error) {
+	if p.deadline > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, p.deadline)
+		defer cancel()
+	}
+
+	var c *mongo.Client
+
+	err := p.retry(ctx, func() error {
+		var err error
+
+		c, err = mongo.Connect(ctx, newOpts())
+
+		return wraperrors.Wrap(err, "unable to create mongo client")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.retry(ctx, func() error {
+		return wraperrors.Wrap(c.Ping(ctx, nil), "unable to reach mongo cluster")
+	})
+	if err == nil {
+		return c, nil
+	}
+
+	if p.degraded {
+		log(ctx).Warnf("Starting in degraded mode; connecting to mongo cluster in the background: %s", MaskSecrets(err.Error()))
+
+		// the verification outlives the context of New and stops when the client is disconnected
+		vctx, cancel := context.WithCancel(context.Background())
+		verifiers.Store(c, cancel)
+
+		go p.verify(vctx, c)
+
+		return c, nil
+	}
+
+	_ = c.Disconnect(context.Background())
+
+	return nil, err
+}
+
+// retry calls fn until it succeeds, waiting with backoff between attempts, or until the context expires.
+// Only a single attempt is made when there is no startup deadline.
+func (p *startup) retry(ctx context.Context, fn func() error) error {
+	wait := p.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				log(ctx).WithField("mongodb.startup.attempt", attempt).Info("Connected to mongo cluster")
+			}
+
+			return nil
+		}
+
+		if p.deadline <= 0 {
+			return err
+		}
+
+		delay := jitter(wait)
+
+		log(ctx).WithFields(logrus.Fields{
+			"mongodb.startup.attempt": attempt,
+			"mongodb.startup.delay":   delay,
+		}).Warnf("Unable to connect to mongo cluster; retrying: %s", MaskSecrets(err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return wraperrors.Wrapf(err, "gave up waiting for mongo cluster after %d attempts", attempt)
+		case <-time.After(delay):
+		}
+
+		wait = next(wait, p.maxBackoff)
+	}
+}
+
+// verify pings the cluster with backoff until it is reachable, the client is disconnected or the context is
+// canceled.
+func (p *startup) verify(ctx context.Context, c *mongo.Client) {
+	defer stopVerify(c)
+
+	wait := p.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := c.Ping(ctx, nil)
+		if err == nil {
+			log(ctx).WithField("mongodb.startup.attempt", attempt).Info("Connected to mongo cluster; leaving degraded mode")
+
+			return
+		}
+
+		if err == mongo.ErrClientDisconnected || ctx.Err() != nil {
+			return
+		}
+
+		delay := jitter(wait)
+
+		log(ctx).WithFields(logrus.Fields{
+			"mongodb.startup.attempt": attempt,
+			"mongodb.startup.delay":   delay,
+		}).Warnf("Running degraded; unable to reach mongo cluster: %s", MaskSecrets(err.Error()))
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		case <-timer.C:
+		}
+
+		wait = next(wait, p.maxBackoff)
+	}
+}
+
+// stopVerify stops the background verification of the client, if any.
+func stopVerify(c *mongo.Client) {
+	if cancel, ok := verifiers.LoadAndDelete(c); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
+func atLeast(d, min time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+
+	return d
+}
+
+func next(wait, max time.Duration) time.Duration {
+	wait *= 2
+	if max > 0 && wait > max {
+		return max
+	}
+
+	return wait
+}
+
+// jitter spreads retries of pods started together across +/- 20% of the wait.
+func jitter(wait time.Duration) time.Duration {
+	if wait <= 0 {
+		return 0
+	}
+
+	return wait - wait/5 + time.Duration(rand.Int63n(int64(wait)/5*2+1))
+}
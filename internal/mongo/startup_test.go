@@ -0,0 +1,78 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestVerifyCanceled(t *testing.T) {
+	// nothing listens on the port so every ping fails
+	c, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = c.Disconnect(context.Background())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	verifiers.Store(c, cancel)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		(&startup{backoff: time.Hour, maxBackoff: time.Hour}).verify(ctx, c)
+	}()
+
+	// the verification waits out the backoff after the first failed ping
+	time.Sleep(100 * time.Millisecond)
+	stopVerify(c)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("verify() did not stop once canceled")
+	}
+
+	if _, ok := verifiers.Load(c); ok {
+		t.Error("verify() did not release the client once stopped")
+	}
+}
+
+func TestDisconnectStopsVerify(t *testing.T) {
+	configure(t, map[string]string{
+		"MONGO_DB_URI":              "mongodb://127.0.0.1:1/app?serverSelectionTimeoutMS=100",
+		"MONGO_DB_STARTUP_DEADLINE": "200ms",
+	}, "")
+
+	dbc, err := New(context.Background())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	if _, ok := verifiers.Load(dbc.Client()); !ok {
+		t.Fatal("New() did not verify the degraded client in the background")
+	}
+
+	if err := Disconnect(context.Background(), dbc); err != nil {
+		t.Fatalf("Disconnect() failed: %v", err)
+	}
+
+	if _, ok := verifiers.Load(dbc.Client()); ok {
+		t.Error("Disconnect() did not stop the background verification")
+	}
+}
+
+func TestNewStartupMinBackoff(t *testing.T) {
+	configure(t, map[string]string{}, "db.mongo:\n  startup:\n    backoff:\n      initial: 0s\n")
+
+	if p := newStartup(new(selections)); p.backoff != minBackoff {
+		t.Errorf("newStartup() backoff = %v, want %v", p.backoff, minBackoff)
+	}
+}
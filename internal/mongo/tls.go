@@ -0,0 +1,202 @@
+package mongo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/youmark/pkcs8"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// authX509 is the authentication mechanism using the client certificate.
+const authX509 = "MONGODB-X509"
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig creates the TLS configuration from the db.mongo.tls.* configurations.
+// Returns nil when TLS is not configured.
+func newTLSConfig(ctx context.Context, s *selections) (*tls.Config, error) {
+	caFile := config.GetString(config.MongoDBCACert)
+	certFile := config.GetString(config.MongoDBTLSCertFile)
+	keyFile := config.GetString(config.MongoDBTLSKeyFile)
+	insecure := config.GetBool(config.MongoDBTLSInsecure)
+
+	if caFile == "" && certFile == "" && keyFile == "" && !insecure {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName: config.GetString(config.MongoDBTLSServerName),
+	}
+
+	version, ok := tlsVersions[config.GetString(config.MongoDBTLSMinVersion)]
+	if !ok {
+		return nil, wraperrors.Errorf("invalid %q %q expected one of 1.0, 1.1, 1.2 or 1.3", config.MongoDBTLSMinVersion, config.GetString(config.MongoDBTLSMinVersion))
+	}
+
+	cfg.MinVersion = version
+
+	ciphers, err := cipherSuites(config.GetStringSlice(config.MongoDBTLSCiphers))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphers) > 0 && version == tls.VersionTLS13 {
+		return nil, wraperrors.Errorf("%q can not be restricted when %q is 1.3", config.MongoDBTLSCiphers, config.MongoDBTLSMinVersion)
+	}
+
+	cfg.CipherSuites = ciphers
+
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, wraperrors.Wrapf(err, "unable to read %q", config.MongoDBCACert)
+		}
+
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, wraperrors.Errorf("no PEM encoded certificates found in %q %q", config.MongoDBCACert, caFile)
+		}
+
+		cfg.RootCAs = caCertPool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := clientCertificate(ctx, s, certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if insecure {
+		log(ctx).Warnf("TLS certificate verification is disabled by %q; for development ONLY!", config.MongoDBTLSInsecure)
+
+		cfg.InsecureSkipVerify = true
+	}
+
+	return cfg, nil
+}
+
+// clientCertificate loads the client certificate and its key; the key may be an encrypted PKCS#8 key.
+func clientCertificate(ctx context.Context, s *selections, certFile, keyFile string) (tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, wraperrors.Errorf("both %q and %q configurations are required", config.MongoDBTLSCertFile, config.MongoDBTLSKeyFile)
+	}
+
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, wraperrors.Wrapf(err, "unable to read %q", config.MongoDBTLSCertFile)
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, wraperrors.Wrapf(err, "unable to read %q", config.MongoDBTLSKeyFile)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return tls.Certificate{}, wraperrors.Errorf("no PEM encoded key found in %q %q", config.MongoDBTLSKeyFile, keyFile)
+	}
+
+	if block.Type != "ENCRYPTED PRIVATE KEY" {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+
+		return cert, wraperrors.Wrapf(err, "invalid %q or %q", config.MongoDBTLSCertFile, config.MongoDBTLSKeyFile)
+	}
+
+	password, err := keyPassword(ctx, s)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+	if err != nil {
+		return tls.Certificate{}, wraperrors.Wrapf(err, "unable to decrypt %q", config.MongoDBTLSKeyFile)
+	}
+
+	cert := tls.Certificate{PrivateKey: key}
+
+	for rest := certPEM; ; {
+		var b *pem.Block
+
+		if b, rest = pem.Decode(rest); b == nil {
+			break
+		}
+
+		if b.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, b.Bytes)
+		}
+	}
+
+	if len(cert.Certificate) == 0 {
+		return tls.Certificate{}, wraperrors.Errorf("no PEM encoded certificates found in %q %q", config.MongoDBTLSCertFile, certFile)
+	}
+
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return tls.Certificate{}, wraperrors.Wrapf(err, "invalid %q", config.MongoDBTLSCertFile)
+	}
+
+	return cert, nil
+}
+
+func keyPassword(ctx context.Context, s *selections) (string, error) {
+	p := s.secrets
+	if p == nil {
+		var err error
+
+		if p, err = configuredSecrets(); err != nil {
+			return "", err
+		}
+	}
+
+	password, err := p.Secret(ctx, SecretTLSKeyPassword)
+	if err != nil {
+		return "", wraperrors.Wrap(err, "unable to read TLS key password")
+	}
+
+	if password == "" {
+		return "", wraperrors.Errorf("%q is encrypted and requires %q", config.MongoDBTLSKeyFile, config.MongoDBTLSKeyPassword)
+	}
+
+	remember(SecretTLSKeyPassword, password)
+
+	return password, nil
+}
+
+// cipherSuites converts the names of cipher suites, as defined by crypto/tls, into their IDs.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, wraperrors.Errorf("unsupported %q %q; insecure cipher suites are not allowed", config.MongoDBTLSCiphers, name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,144 @@
+package mongo
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// clientOptions creates the client options from the connection string, when configured, merged with the
+// granular configurations. Explicitly configured keys take precedence over the connection string, which
+// takes precedence over the defaults.
+func clientOptions(s *selections, uri string) *options.ClientOptions {
+	opts := options.Client()
+
+	if uri == "" {
+		opts = connectTo(opts)
+	} else {
+		opts.ApplyURI(uri)
+
+		if config.Explicit(config.MongoDBClusterSrv) || config.Explicit(config.MongoDBHosts) {
+			opts = connectTo(opts)
+		}
+	}
+
+	if s.appName != "" || opts.AppName == nil {
+		opts.SetAppName(appName(s))
+	}
+
+	if rs := config.GetString(config.MongoDBReplicaSet); rs != "" && preferred(config.MongoDBReplicaSet, opts.ReplicaSet != nil) {
+		opts.SetReplicaSet(rs)
+	}
+
+	if preferred(config.MongoDBConnectTimeout, opts.ConnectTimeout != nil) {
+		opts.SetConnectTimeout(config.GetDuration(config.MongoDBConnectTimeout))
+	}
+
+	if s.upgrade || preferred(config.MongoDBTimeout, opts.SocketTimeout != nil) {
+		opts.SetSocketTimeout(socketTimeout(s))
+	}
+
+	if preferred(config.MongoDBSelectTimeout, opts.ServerSelectionTimeout != nil) {
+		opts.SetServerSelectionTimeout(config.GetDuration(config.MongoDBSelectTimeout))
+	}
+
+	if opts.MinPoolSize == nil {
+		opts.SetMinPoolSize(uint64(1))
+	}
+
+	if preferred(config.MongoDBPoolLimit, opts.MaxPoolSize != nil) {
+		opts.SetMaxPoolSize(uint64(config.GetInt(config.MongoDBPoolLimit)))
+	}
+
+	if preferred(config.MongoDBPoolMaxIdleTime, opts.MaxConnIdleTime != nil) {
+		opts.SetMaxConnIdleTime(config.GetDuration(config.MongoDBPoolMaxIdleTime))
+	}
+
+	if s.readPref != nil {
+		opts.SetReadPreference(s.readPref)
+	} else if opts.ReadPreference == nil {
+		opts.SetReadPreference(readpref.PrimaryPreferred())
+	}
+
+	if opts.RetryReads == nil {
+		opts.SetRetryReads(true)
+	}
+
+	if opts.RetryWrites == nil {
+		opts.SetRetryWrites(true)
+	}
+
+	return opts.SetRegistry(Registry())
+}
+
+// preferred determines if the configured value of a key is used instead of the value from the connection string.
+func preferred(key string, inURI bool) bool {
+	return !inURI || config.Explicit(key)
+}
+
+// withAuth merges the credentials with those of the connection string; configured values take precedence.
+func withAuth(opts *options.ClientOptions, creds *options.Credential) *options.ClientOptions {
+	if creds == nil {
+		return opts
+	}
+
+	merged := *creds
+
+	if opts.Auth != nil && merged.AuthSource == "" {
+		merged.AuthSource = opts.Auth.AuthSource
+	}
+
+	return opts.SetAuth(merged)
+}
+
+// databaseName provides the configured database name, or the database of the connection string.
+func databaseName(uri string) string {
+	if name := config.GetString(config.MongoDBName); name != "" {
+		return name
+	}
+
+	return uriDatabase(uri)
+}
+
+// uriDatabase extracts the database from a connection string: scheme://[userinfo@]hosts[/database][?options].
+// The connection string is not parsed by net/url as it does not support a list of hosts.
+func uriDatabase(uri string) string {
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return ""
+	}
+
+	rest := uri[i+3:]
+	if q := strings.Index(rest, "?"); q >= 0 {
+		rest = rest[:q]
+	}
+
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		rest = rest[at+1:]
+	}
+
+	slash := strings.Index(rest, "/")
+	if slash < 0 {
+		return ""
+	}
+
+	return rest[slash+1:]
+}
+
+// uriCredentials determines if the connection string includes credentials.
+func uriCredentials(uri string) bool {
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return false
+	}
+
+	rest := uri[i+3:]
+	if slash := strings.IndexAny(rest, "/?"); slash >= 0 {
+		rest = rest[:slash]
+	}
+
+	return strings.Contains(rest, "@")
+}
@@ -0,0 +1,160 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitscm.cisco.com/mcmp/utils/env"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// configure sets the environment and loads the configuration file, if any, for a single test.
+func configure(t *testing.T, vars map[string]string, file string) {
+	t.Helper()
+	t.Cleanup(config.Restore)
+
+	for k, v := range vars {
+		t.Setenv(k, v)
+	}
+
+	viper.Set(env.SvcName, "orders")
+
+	if file == "" {
+		file = "db.mongo: {}\n"
+	}
+
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("MONGO_DB_CONFIG_FILE", name)
+
+	if err := os.WriteFile(name, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.LoadMongoConfigs(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	const uri = "mongodb://db1:27017,db2:27017/app?replicaSet=rs1&maxPoolSize=50&connectTimeoutMS=1000&appName=legacy"
+
+	documentDB := context.WithValue(context.Background(), "flag", true)
+
+	for _, tc := range []struct {
+		name     string
+		ctx      context.Context
+		vars     map[string]string
+		file     string
+		picks    []Selector
+		hosts    []string
+		replSet  string
+		mode     readpref.Mode
+		connect  time.Duration
+		pool     uint64
+		app      string
+		database string
+	}{
+		{
+			name:     "documentdb",
+			ctx:      documentDB,
+			hosts:    []string{clusterEndpoint},
+			replSet:  "rs0",
+			mode:     readpref.SecondaryPreferredMode,
+			connect:  30 * time.Second,
+			pool:     10,
+			app:      "orders",
+			database: "test",
+		},
+		{
+			name:     "connection string",
+			ctx:      documentDB,
+			vars:     map[string]string{"MONGO_DB_URI": uri},
+			hosts:    []string{"db1:27017", "db2:27017"},
+			replSet:  "rs1",
+			mode:     readpref.PrimaryPreferredMode,
+			connect:  time.Second,
+			pool:     50,
+			app:      "legacy",
+			database: "app",
+		},
+		{
+			name:     "explicit configurations",
+			ctx:      context.Background(),
+			vars:     map[string]string{"MONGO_DB_URI": uri},
+			file:     "db.mongo:\n  name: orders_db\n  replicaset: rs2\n  timeout:\n    connect: 2s\n  pool:\n    limit: 20\n",
+			picks:    []Selector{AppName("worker"), ReadPreference(readpref.Nearest())},
+			hosts:    []string{"db1:27017", "db2:27017"},
+			replSet:  "rs2",
+			mode:     readpref.NearestMode,
+			connect:  2 * time.Second,
+			pool:     20,
+			app:      "worker",
+			database: "orders_db",
+		},
+		{
+			name:     "hosts",
+			ctx:      context.Background(),
+			vars:     map[string]string{"MONGO_DB_HOSTS": "db3:27017", "MONGO_DB_NAME": "orders_db"},
+			hosts:    []string{"db3:27017"},
+			mode:     readpref.PrimaryPreferredMode,
+			connect:  30 * time.Second,
+			pool:     10,
+			app:      "orders",
+			database: "orders_db",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			configure(t, tc.vars, tc.file)
+
+			uri, err := connectionURI(tc.ctx)
+			if err != nil {
+				t.Fatalf("connectionURI() failed: %v", err)
+			}
+
+			opts := clientOptions(applySelections(tc.picks...), uri)
+
+			if !reflect.DeepEqual(opts.Hosts, tc.hosts) {
+				t.Errorf("Hosts = %v, want %v", opts.Hosts, tc.hosts)
+			}
+
+			if replSet := opts.ReplicaSet; (replSet == nil && tc.replSet != "") || (replSet != nil && *replSet != tc.replSet) {
+				t.Errorf("ReplicaSet = %v, want %q", replSet, tc.replSet)
+			}
+
+			if mode := opts.ReadPreference.Mode(); mode != tc.mode {
+				t.Errorf("ReadPreference = %v, want %v", mode, tc.mode)
+			}
+
+			if *opts.ConnectTimeout != tc.connect {
+				t.Errorf("ConnectTimeout = %v, want %v", *opts.ConnectTimeout, tc.connect)
+			}
+
+			if *opts.MaxPoolSize != tc.pool {
+				t.Errorf("MaxPoolSize = %d, want %d", *opts.MaxPoolSize, tc.pool)
+			}
+
+			if *opts.AppName != tc.app {
+				t.Errorf("AppName = %q, want %q", *opts.AppName, tc.app)
+			}
+
+			if name := databaseName(uri); name != tc.database {
+				t.Errorf("databaseName() = %q, want %q", name, tc.database)
+			}
+		})
+	}
+}
+
+func TestConnectionURIMissing(t *testing.T) {
+	configure(t, nil, "")
+
+	if uri, err := connectionURI(context.Background()); err == nil {
+		t.Errorf("connectionURI() = %q, want error", uri)
+	}
+}
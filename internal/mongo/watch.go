@@ -0,0 +1,156 @@
+package mongo
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	wraperrors "github.com/pkg/errors"
+
+	"docdb_poc/internal/mongo/config"
+)
+
+// settle is how long to wait for a burst of file events to finish before reloading; Kubernetes
+// updates mounted secrets and config maps with several renames and symlink swaps.
+const settle = 500 * time.Millisecond
+
+// WatchConfigs watches the MongoDB configuration file, certificates, keys, encryption, policy and secret files, and
+// calls reload after any of them changes, until the context is canceled. Cached secrets are refreshed before reloading.
+// The watched files are determined again after each reload as the configuration file may reference other files.
+//
+// The parent directories are watched rather than the files so that updates made by replacing a file or
+// swapping a symlink, as done for mounted Kubernetes volumes, are detected.
+func WatchConfigs(ctx context.Context, reload func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return wraperrors.Wrap(err, "unable to create configuration watcher")
+	}
+
+	cw := &configWatcher{watcher: w, dirs: make(map[string]bool)}
+	cw.refresh(ctx)
+
+	go cw.watch(ctx, reload)
+
+	return nil
+}
+
+// configWatcher tracks the files referenced by the configurations along with the watched directories.
+type configWatcher struct {
+	watcher *fsnotify.Watcher
+	files   map[string]string
+	dirs    map[string]bool
+}
+
+// refresh determines the watched files from the configurations, watching the directories of new files.
+func (cw *configWatcher) refresh(ctx context.Context) {
+	cw.files = watchedFiles()
+
+	for name := range cw.files {
+		dir := filepath.Dir(name)
+		if cw.dirs[dir] {
+			continue
+		}
+
+		if err := cw.watcher.Add(dir); err != nil {
+			log(ctx).Warnf("Unable to watch %q for configuration changes: %v", dir, err)
+
+			continue
+		}
+
+		cw.dirs[dir] = true
+	}
+}
+
+// watchedFiles maps each watched file to the file it currently resolves to.
+func watchedFiles() map[string]string {
+	files := make(map[string]string)
+
+	for _, key := range []string{config.MongoDBConfigFile, config.MongoDBCACert, config.MongoDBTLSCertFile, config.MongoDBTLSKeyFile,
+		config.MongoDBSSHKeyFile, config.MongoDBSSHKnownHosts, config.MongoDBEncryptionKeyRing, config.MongoDBEncryptionSchema,
+		config.MongoDBPolicy} {
+		name := config.GetString(key)
+		if name == "" {
+			continue
+		}
+
+		name = filepath.Clean(name)
+		files[name] = resolve(name)
+	}
+
+	for _, name := range secretFiles() {
+		name = filepath.Clean(name)
+		files[name] = resolve(name)
+	}
+
+	return files
+}
+
+func (cw *configWatcher) watch(ctx context.Context, reload func()) {
+	defer func() {
+		_ = cw.watcher.Close()
+	}()
+
+	timer := time.NewTimer(settle)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		case ev, ok := <-cw.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if changed(cw.files, ev) {
+				timer.Reset(settle)
+			}
+		case err, ok := <-cw.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log(ctx).Warnf("Error watching configuration files: %v", err)
+		case <-timer.C:
+			log(ctx).Info("MongoDB configuration changed; reloading")
+			RefreshSecrets()
+			reload()
+			cw.refresh(ctx)
+		}
+	}
+}
+
+// changed determines if the event modified one of the watched files, either directly or by
+// changing where the file resolves to.
+func changed(files map[string]string, ev fsnotify.Event) bool {
+	if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return false
+	}
+
+	modified := false
+
+	for name, current := range files {
+		if filepath.Clean(ev.Name) == name && ev.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+			modified = true
+		}
+
+		if target := resolve(name); target != current {
+			files[name] = target
+			modified = true
+		}
+	}
+
+	return modified
+}
+
+func resolve(name string) string {
+	target, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return ""
+	}
+
+	return target
+}
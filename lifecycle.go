@@ -0,0 +1,173 @@
+package docdb_poc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// retireTimeout bounds how long a replaced connection waits for its in-flight operations before disconnecting.
+const retireTimeout = time.Minute
+
+// errUnavailable is returned by every operation once the client has been closed.
+var errUnavailable = errors.NewDomainError(errors.ErrUnavailable, errors.Default)
+
+// lifecycle tracks in-flight operations so a connection can be drained before disconnecting.
+type lifecycle struct {
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+// begin registers an in-flight operation; the returned func must be called once the operation completes.
+func (l *lifecycle) begin() (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, errUnavailable
+	}
+
+	l.inflight.Add(1)
+
+	return l.inflight.Done, nil
+}
+
+// drain stops new operations from starting and waits until the in-flight operations complete or the context expires.
+// Returns false if the lifecycle was already drained.
+func (l *lifecycle) drain(ctx context.Context) bool {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+
+		return false
+	}
+
+	l.closed = true
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		l.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logrus.Warnf("Closing datastore connection before in-flight operations completed: %v", ctx.Err())
+	}
+
+	return true
+}
+
+// connection is a single generation of the database connection used by the client.
+type connection struct {
+	lifecycle
+
+	dbc *mongo.Database
+	// configurations consulted by every command, read when the connection was created
+	settings *dbutil.Settings
+}
+
+// close drains and disconnects the connection.
+func (conn *connection) close(ctx context.Context) error {
+	if !conn.drain(ctx) {
+		return nil
+	}
+
+	return dbutil.Disconnect(ctx, conn.dbc)
+}
+
+// acquire provides the current database connection for a single operation; the returned func must be
+// called once the operation completes.
+func (c *client) acquire() (*mongo.Database, func(), error) {
+	for {
+		if c.closed.Load() {
+			return nil, nil, errUnavailable
+		}
+
+		conn := c.conn.Load()
+
+		done, err := conn.begin()
+		if err == nil {
+			return conn.dbc, done, nil
+		}
+
+		// the connection was retired by a reload after it was loaded; pick up its replacement
+	}
+}
+
+// settings provides the configurations consulted by every command of the current connection.
+func (c *client) settings() *dbutil.Settings {
+	return c.conn.Load().settings
+}
+
+// swap replaces the current connection and returns the previous one.
+// Returns false when the client has been closed.
+func (c *client) swap(conn *connection) (*connection, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed.Load() {
+		return nil, false
+	}
+
+	return c.conn.Swap(conn), true
+}
+
+// hold keeps a connection that is not serving all traffic open until the client is closed.
+// Returns false when the client has been closed.
+func (c *client) hold(conn *connection) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed.Load() {
+		return false
+	}
+
+	c.standby.Store(conn)
+
+	return true
+}
+
+// retire closes the connection in the background once its in-flight operations complete.
+func retire(conn *connection) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), retireTimeout)
+		defer cancel()
+
+		if err := conn.close(ctx); err != nil {
+			logrus.Warnf("Unable to close replaced datastore connection: %v", err)
+		}
+	}()
+}
+
+func (c *client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed.Load() {
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	c.closed.Store(true)
+	c.mu.Unlock()
+
+	c.stopWatch()
+
+	if standby := c.standby.Swap(nil); standby != nil {
+		if err := standby.close(ctx); err != nil {
+			logrus.Warnf("Unable to close standby datastore connection: %v", err)
+		}
+	}
+
+	return c.conn.Load().close(ctx)
+}
@@ -0,0 +1,130 @@
+package docdb_poc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLifecycleDrain(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		inflight int
+		finish   bool
+		timeout  time.Duration
+		drained  bool
+	}{
+		{"idle", 0, false, time.Second, true},
+		{"in-flight operations complete", 2, true, time.Second, true},
+		{"in-flight operations outlive the context", 1, false, 50 * time.Millisecond, true},
+	} {
+		var l lifecycle
+
+		var done []func()
+
+		for i := 0; i < tc.inflight; i++ {
+			d, err := l.begin()
+			if err != nil {
+				t.Fatalf("%s: begin() failed: %v", tc.name, err)
+			}
+
+			done = append(done, d)
+		}
+
+		if tc.finish {
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+
+				for _, d := range done {
+					d()
+				}
+			}()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+		start := time.Now()
+
+		if drained := l.drain(ctx); drained != tc.drained {
+			t.Errorf("%s: drain() = %t, want %t", tc.name, drained, tc.drained)
+		}
+
+		if elapsed := time.Since(start); elapsed >= tc.timeout && tc.finish {
+			t.Errorf("%s: drain() waited %v for completed operations", tc.name, elapsed)
+		}
+
+		cancel()
+
+		if _, err := l.begin(); err != errUnavailable {
+			t.Errorf("%s: begin() after drain = %v, want errUnavailable", tc.name, err)
+		}
+
+		if l.drain(context.Background()) {
+			t.Errorf("%s: drain() of a drained lifecycle = true, want false", tc.name)
+		}
+
+		if !tc.finish {
+			for _, d := range done {
+				d()
+			}
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	s := newFakeServer(t)
+	c := newTestClient(t, s, false)
+
+	standby := &connection{dbc: c.conn.Load().dbc}
+	if !c.hold(standby) {
+		t.Fatal("hold() of an open client = false, want true")
+	}
+
+	_, done, err := c.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan error)
+
+	go func() {
+		closed <- c.Close(context.Background())
+	}()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("Close() = %v before the in-flight operation completed", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	done()
+
+	if err := <-closed; err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"acquire", func() error { _, _, err := c.acquire(); return err }},
+		{"acquireWrite", func() error { _, _, err := c.acquireWrite(context.Background()); return err }},
+		{"FindData", func() error { _, err := c.FindData(context.Background(), nil); return err }},
+		{"standby", func() error { _, err := standby.begin(); return err }},
+	} {
+		if err := tc.fn(); err != errUnavailable {
+			t.Errorf("%s: after Close() = %v, want errUnavailable", tc.name, err)
+		}
+	}
+
+	if c.hold(&connection{}) {
+		t.Error("hold() of a closed client = true, want false")
+	}
+
+	if _, ok := c.swap(&connection{}); ok {
+		t.Error("swap() of a closed client = true, want false")
+	}
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Errorf("Close() of a closed client = %v, want nil", err)
+	}
+}
@@ -2,32 +2,84 @@ package docdb_poc
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+
 	"github.com/sirupsen/logrus"
-	dbutil "gitscm.cisco.com/mcmp/db/mongo"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 
 	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+	"docdb_poc/internal/mongo/encrypt"
 )
 
+// dataCollection is the collection holding the data of the Datastore.
+const dataCollection = "collection"
+
 func init() {
+	// every datastore log line is redacted, including those of the service logging through the standard logger
+	logrus.AddHook(dbutil.RedactionHook{})
+
 	db.Register("mongodb", NewClient)
+	db.Register("mongodb-readonly", NewReadOnlyClient)
 }
 
 type client struct {
-	dbc *mongo.Database
+	// rejects every mutating operation before it reaches the driver
+	readOnly bool
+	// selects the connection mode of every connection made by the client
+	picks []dbutil.Selector
+
+	mu      sync.Mutex
+	closed  atomic.Bool
+	conn    atomic.Pointer[connection]
+	standby atomic.Pointer[connection]
+	canary  atomic.Pointer[canary]
+
+	// encrypts the configured fields before they leave the service; nil when encryption is not configured
+	enc atomic.Pointer[encrypt.Encrypter]
+	// authorizes each operation by the caller; nil when every caller is authorized
+	policy atomic.Pointer[db.Policy]
+
+	// serializes changes to the connections made by reloads and switchovers
+	cutover sync.Mutex
+
+	stopWatch context.CancelFunc
+
+	// unix nanoseconds of the last successful ping
+	lastPing atomic.Int64
 }
 
 func NewClient() (db.Datastore, error) {
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, "flag", true)
+	return newClient(&client{
+		picks: []dbutil.Selector{dbutil.ReadWrite()},
+	})
+}
 
-	dbc, err := dbutil.New(ctx)
+func newClient(c *client) (db.Datastore, error) {
+	// waits for the cluster up to the startup deadline, then starts degraded when configured
+	dbc, err := dbutil.New(newContext(), c.selectors()...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &client{dbc: dbc}, nil
+	if err := c.configure(); err != nil {
+		_ = dbutil.Disconnect(context.Background(), dbc)
+
+		return nil, err
+	}
+
+	c.conn.Store(&connection{dbc: dbc, settings: dbutil.CurrentSettings()})
+	c.watch()
+
+	return c, nil
+}
+
+func newContext() context.Context {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, "flag", true)
+
+	return ctx
 }
 
 func main() {
@@ -37,22 +89,50 @@ func main() {
 		panic(err)
 	}
 
+	defer func() {
+		_ = database.Close(context.Background())
+	}()
+
 	// save data
 	if err = database.SaveData(context.TODO(), bson.M{"name": "Runon MCMP Test"}); err != nil {
 		panic(err)
 	}
 }
 
-func (c *client) SaveData(ctx context.Context, object bson.M) error {
-	collection := c.dbc.Collection("collection")
+// configure loads the encryption keys and the authorization policy; the current ones are kept on error.
+func (c *client) configure() error {
+	enc, err := encrypt.Configured()
+	if err != nil {
+		return err
+	}
 
-	// insert record
-	res, err := collection.InsertOne(context.TODO(), object)
+	policy, err := configuredPolicy()
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	c.enc.Store(enc)
+	c.policy.Store(policy)
+
+	return nil
+}
+
+// selectors provides the connection mode of the client along with the additional selections.
+func (c *client) selectors(picks ...dbutil.Selector) []dbutil.Selector {
+	return append(append([]dbutil.Selector(nil), c.picks...), picks...)
+}
+
+func (c *client) SaveData(ctx context.Context, object bson.M, opts ...db.Option) error {
+	id, err := c.Insert(ctx, dataCollection, object, opts...)
+	if err != nil {
+		return err
 	}
 
-	logrus.Infof("Inserted document with ID:%v", res.InsertedID)
+	logrus.Infof("Inserted document with ID:%v", c.settings().Shape(id))
 
 	return nil
 }
+
+func (c *client) FindData(ctx context.Context, filter bson.M, opts ...db.Option) ([]bson.M, error) {
+	return c.find(ctx, dataCollection, filter, nil, opts)
+}
@@ -0,0 +1,96 @@
+package docdb_poc
+
+import (
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/tag"
+
+	db "docdb_poc/db"
+)
+
+// configuredCollection provides the named collection configured using the options of a single operation.
+func configuredCollection(dbc *mongo.Database, name string, opts []db.Option) (*mongo.Collection, error) {
+	o := db.NewOptions(opts...)
+	co := options.Collection()
+
+	if o.ReadPreference != nil {
+		rp, err := readPreference(o.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+
+		co.SetReadPreference(rp)
+	}
+
+	if o.ReadConcern != "" {
+		co.SetReadConcern(readconcern.New(readconcern.Level(o.ReadConcern)))
+	}
+
+	if o.WriteConcern != nil {
+		wc, err := writeConcern(o.WriteConcern)
+		if err != nil {
+			return nil, err
+		}
+
+		co.SetWriteConcern(wc)
+	}
+
+	return dbc.Collection(name, co), nil
+}
+
+func readPreference(p *db.ReadPreference) (*readpref.ReadPref, error) {
+	mode, err := readpref.ModeFromString(p.Mode)
+	if err != nil {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "read preference", "one of primary, primaryPreferred, secondary, secondaryPreferred or nearest")
+	}
+
+	var opts []readpref.Option
+
+	if p.MaxStaleness > 0 {
+		opts = append(opts, readpref.WithMaxStaleness(p.MaxStaleness))
+	}
+
+	if len(p.TagSets) > 0 {
+		opts = append(opts, readpref.WithTagSets(tag.NewTagSetsFromMaps(p.TagSets)...))
+	}
+
+	rp, err := readpref.New(mode, opts...)
+	if err != nil {
+		// the primary cannot be combined with a max staleness or tag sets
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "read preference", err.Error())
+	}
+
+	return rp, nil
+}
+
+func writeConcern(c *db.WriteConcern) (*writeconcern.WriteConcern, error) {
+	var opts []writeconcern.Option
+
+	switch w := c.W.(type) {
+	case nil:
+	case int:
+		opts = append(opts, writeconcern.W(w))
+	case string:
+		if w == db.WriteMajority {
+			opts = append(opts, writeconcern.WMajority())
+		} else {
+			opts = append(opts, writeconcern.WTagSet(w))
+		}
+	default:
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "write concern", "a number of members or "+db.WriteMajority)
+	}
+
+	if c.Journal {
+		opts = append(opts, writeconcern.J(true))
+	}
+
+	if c.Timeout > 0 {
+		opts = append(opts, writeconcern.WTimeout(c.Timeout))
+	}
+
+	return writeconcern.New(opts...), nil
+}
@@ -0,0 +1,204 @@
+package docdb_poc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+
+	db "docdb_poc/db"
+)
+
+func TestReadPreference(t *testing.T) {
+	east := map[string]string{"region": "us-east-1"}
+
+	for _, tc := range []struct {
+		name      string
+		pref      *db.ReadPreference
+		mode      readpref.Mode
+		staleness time.Duration
+		tags      []tag.Set
+	}{
+		{"primary", &db.ReadPreference{Mode: db.ReadPrimary}, readpref.PrimaryMode, 0, nil},
+		{"nearest", &db.ReadPreference{Mode: db.ReadNearest}, readpref.NearestMode, 0, nil},
+		{
+			name:      "staleness and tags",
+			pref:      &db.ReadPreference{Mode: db.ReadSecondary, MaxStaleness: 90 * time.Second, TagSets: []map[string]string{east, {}}},
+			mode:      readpref.SecondaryMode,
+			staleness: 90 * time.Second,
+			tags:      []tag.Set{{{Name: "region", Value: "us-east-1"}}, nil},
+		},
+	} {
+		rp, err := readPreference(tc.pref)
+		if err != nil {
+			t.Errorf("%s: readPreference() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		staleness, _ := rp.MaxStaleness()
+
+		if rp.Mode() != tc.mode || staleness != tc.staleness || !reflect.DeepEqual(rp.TagSets(), tc.tags) {
+			t.Errorf("%s: readPreference() = %v %v %v, want %v %v %v", tc.name, rp.Mode(), staleness, rp.TagSets(), tc.mode, tc.staleness, tc.tags)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		pref *db.ReadPreference
+	}{
+		{"unknown mode", &db.ReadPreference{Mode: "fastest"}},
+		{"primary with tags", &db.ReadPreference{Mode: db.ReadPrimary, TagSets: []map[string]string{east}}},
+		{"primary with staleness", &db.ReadPreference{Mode: db.ReadPrimary, MaxStaleness: time.Minute}},
+	} {
+		if _, err := readPreference(tc.pref); err == nil {
+			t.Errorf("%s: readPreference() succeeded, want error", tc.name)
+		}
+	}
+}
+
+func TestWriteConcern(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		concern  *db.WriteConcern
+		w        interface{}
+		journal  bool
+		wtimeout time.Duration
+	}{
+		{"majority", &db.WriteConcern{W: db.WriteMajority, Journal: true, Timeout: 5 * time.Second}, "majority", true, 5 * time.Second},
+		{"members", &db.WriteConcern{W: 2}, 2, false, 0},
+		{"tag set", &db.WriteConcern{W: "multiRegion"}, "multiRegion", false, 0},
+		{"journal only", &db.WriteConcern{Journal: true}, nil, true, 0},
+	} {
+		wc, err := writeConcern(tc.concern)
+		if err != nil {
+			t.Errorf("%s: writeConcern() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		if wc.GetW() != tc.w || wc.GetJ() != tc.journal || wc.GetWTimeout() != tc.wtimeout {
+			t.Errorf("%s: writeConcern() = %v %t %v, want %v %t %v", tc.name, wc.GetW(), wc.GetJ(), wc.GetWTimeout(), tc.w, tc.journal, tc.wtimeout)
+		}
+	}
+
+	if _, err := writeConcern(&db.WriteConcern{W: 1.5}); err == nil {
+		t.Error("writeConcern() of a fractional number of members succeeded, want error")
+	}
+}
+
+func TestOperationConcerns(t *testing.T) {
+	var find, insert bson.M
+
+	s := newFakeServer(t)
+	s.handle("find", func(cmd bson.M) bson.M {
+		find = cmd
+
+		return bson.M{"cursor": bson.M{"id": int64(0), "ns": "app." + cmd["find"].(string), "firstBatch": bson.A{}}}
+	})
+	s.handle("insert", func(cmd bson.M) bson.M {
+		insert = cmd
+
+		return bson.M{"n": int32(1)}
+	})
+
+	c := newTestClient(t, s, false)
+	ctx := context.Background()
+
+	if _, err := c.FindData(ctx, bson.M{"name": "a"}, db.WithReadConcern(db.ReadConcernMajority)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rc, _ := find["readConcern"].(bson.M); rc["level"] != db.ReadConcernMajority {
+		t.Errorf("find readConcern = %v, want majority", find["readConcern"])
+	}
+
+	if err := c.SaveData(ctx, bson.M{"name": "a"}, db.WithWriteConcern(db.WriteMajority, true, 5*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	wc, _ := insert["writeConcern"].(bson.M)
+	if wc["w"] != "majority" || wc["j"] != true || wc["wtimeout"] != int64(5000) {
+		t.Errorf("insert writeConcern = %v, want majority journaled within 5s", insert["writeConcern"])
+	}
+
+	if _, err := c.FindData(ctx, nil, db.WithReadPreference("fastest", 0)); err == nil {
+		t.Error("FindData() with an unknown read preference succeeded, want error")
+	}
+}
+
+func TestCausalSession(t *testing.T) {
+	c := newTestClient(t, newFakeServer(t), false)
+
+	if _, ok := sessionDatabase(context.Background()); ok {
+		t.Error("sessionDatabase() without a session = true, want false")
+	}
+
+	ctx, end, err := c.CausalSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess := mongo.SessionFromContext(ctx)
+	if sess == nil {
+		t.Fatal("CausalSession() context holds no session")
+	}
+
+	dbc, ok := sessionDatabase(ctx)
+	if !ok || dbc != c.conn.Load().dbc {
+		t.Errorf("sessionDatabase() = %v %t, want the connection of the session", dbc, ok)
+	}
+
+	// a reload replacing the connection leaves the session on its own connection
+	replaced := &connection{dbc: newTestClient(t, newFakeServer(t), false).conn.Load().dbc}
+	started, _ := c.swap(replaced)
+
+	for _, tc := range []struct {
+		name    string
+		acquire func(ctx context.Context) (*mongo.Database, func(), error)
+	}{
+		{"acquireRead", c.acquireRead},
+		{"acquireWrite", c.acquireWrite},
+	} {
+		got, done, err := tc.acquire(ctx)
+		if err != nil {
+			t.Errorf("%s: failed: %v", tc.name, err)
+
+			continue
+		}
+
+		done()
+
+		if got != started.dbc {
+			t.Errorf("%s: within the session used another connection", tc.name)
+		}
+	}
+
+	drained := make(chan bool)
+
+	go func() {
+		drained <- started.drain(context.Background())
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("drain() completed while the session was open")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	end()
+	end()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("drain() did not complete once the session ended")
+	}
+
+	c.swap(started)
+}
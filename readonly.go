@@ -0,0 +1,39 @@
+package docdb_poc
+
+import (
+	"context"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// errReadOnly is returned by every mutating operation of a read-only client.
+var errReadOnly = errors.NewDomainError(errors.ErrUnauthorized, errors.Default)
+
+// NewReadOnlyClient creates a Datastore that connects with the read-only credentials, reads from the
+// secondaries when available and rejects every mutating operation, regardless of the roles granted to
+// the credentials.
+func NewReadOnlyClient() (db.Datastore, error) {
+	return newClient(&client{
+		readOnly: true,
+		picks:    []dbutil.Selector{dbutil.ReadOnly(), dbutil.ReadPreference(readpref.SecondaryPreferred())},
+	})
+}
+
+// acquireWrite provides the current database connection for a single mutating operation; the returned
+// func must be called once the operation completes. Writes within a session use the connection of the session.
+func (c *client) acquireWrite(ctx context.Context) (*mongo.Database, func(), error) {
+	if c.readOnly {
+		return nil, nil, errReadOnly
+	}
+
+	if dbc, ok := sessionDatabase(ctx); ok {
+		return dbc, func() {}, nil
+	}
+
+	return c.acquire()
+}
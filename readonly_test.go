@@ -0,0 +1,61 @@
+package docdb_poc
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	db "docdb_poc/db"
+)
+
+func TestReadOnlyClient(t *testing.T) {
+	s := newFakeServer(t)
+	s.handle("find", func(cmd bson.M) bson.M {
+		return bson.M{"cursor": bson.M{"id": int64(0), "ns": "app." + cmd["find"].(string), "firstBatch": bson.A{}}}
+	})
+
+	c := newTestClient(t, s, true)
+	ctx := context.Background()
+
+	u, err := db.NewUpdate(db.Set("status", "shipped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"SaveData", func() error { return c.SaveData(ctx, bson.M{"name": "a"}) }},
+		{"Insert", func() error { _, err := c.Insert(ctx, "orders", bson.M{"name": "a"}); return err }},
+		{"Replace", func() error { return c.Replace(ctx, "orders", 1, bson.M{"name": "a"}) }},
+		{"Patch", func() error { return c.Patch(ctx, "orders", 1, []byte(`{"name": "a"}`)) }},
+		{"Update", func() error { return c.Update(ctx, "orders", 1, u) }},
+		{"FindOneAndUpdate", func() error { _, err := c.FindOneAndUpdate(ctx, "orders", bson.M{"_id": 1}, u); return err }},
+		{"FindOneAndDelete", func() error { _, err := c.FindOneAndDelete(ctx, "orders", bson.M{"_id": 1}); return err }},
+		{"Delete", func() error { return c.Delete(ctx, "orders", 1) }},
+		{"ApplySchemas", func() error { return c.ApplySchemas(ctx) }},
+	} {
+		if err := tc.fn(); err != errReadOnly {
+			t.Errorf("%s: = %v, want errReadOnly", tc.name, err)
+		}
+	}
+
+	if _, err := c.FindData(ctx, bson.M{"name": "a"}); err != nil {
+		t.Errorf("FindData() failed: %v", err)
+	}
+
+	for _, name := range s.received() {
+		switch name {
+		case "ping", "find", "endSessions":
+		default:
+			t.Errorf("%s sent by a read-only client", name)
+		}
+	}
+
+	if mode := c.conn.Load().dbc.ReadPreference().Mode(); mode != readpref.SecondaryPreferredMode {
+		t.Errorf("read preference = %v, want secondaryPreferred", mode)
+	}
+}
@@ -0,0 +1,61 @@
+package docdb_poc
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	dbutil "docdb_poc/internal/mongo"
+	"docdb_poc/internal/mongo/config"
+)
+
+// watch rebuilds the connection whenever the MongoDB configuration files change, such as when
+// credentials are rotated or a new CA certificate is mounted.
+func (c *client) watch() {
+	if !config.GetBool(config.MongoDBWatch) {
+		c.stopWatch = func() {}
+
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopWatch = cancel
+
+	if err := dbutil.WatchConfigs(ctx, c.reload); err != nil {
+		logrus.Warnf("Unable to watch MongoDB configurations; changes require a restart: %v", err)
+	}
+}
+
+// reload creates a new connection using the latest configurations, read again from the configuration file by
+// dbutil.New, and swaps it in once it is verified; the current connection is kept when the new one cannot be established.
+func (c *client) reload() {
+	// a switchover in progress owns the connections until it completes
+	c.cutover.Lock()
+	defer c.cutover.Unlock()
+
+	// the replacement connection must reach the cluster before taking over
+	dbc, err := dbutil.New(newContext(), c.selectors(dbutil.Verified())...)
+	if err != nil {
+		logrus.Errorf("Unable to reload MongoDB connection; keeping current connection: %v", err)
+
+		return
+	}
+
+	if err := c.configure(); err != nil {
+		logrus.Errorf("Unable to reload MongoDB encryption keys or policy; keeping current connection: %v", err)
+		_ = dbutil.Disconnect(context.Background(), dbc)
+
+		return
+	}
+
+	old, ok := c.swap(&connection{dbc: dbc, settings: dbutil.CurrentSettings()})
+	if !ok {
+		_ = dbutil.Disconnect(context.Background(), dbc)
+
+		return
+	}
+
+	retire(old)
+
+	logrus.Info("Reloaded MongoDB connection")
+}
@@ -0,0 +1,86 @@
+package docdb_poc
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	dbutil "docdb_poc/internal/mongo"
+)
+
+func TestReload(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		vars     func(t *testing.T) map[string]string
+		close    bool
+		replaced bool
+	}{
+		{
+			name:     "new configurations",
+			vars:     func(*testing.T) map[string]string { return map[string]string{"MONGO_DB_COMPAT": "strict"} },
+			replaced: true,
+		},
+		{
+			name: "unreachable cluster",
+			vars: func(*testing.T) map[string]string {
+				return map[string]string{"MONGO_DB_URI": "mongodb://127.0.0.1:1/app?serverSelectionTimeoutMS=100"}
+			},
+		},
+		{
+			name: "missing policy",
+			vars: func(t *testing.T) map[string]string {
+				return map[string]string{"MONGO_DB_POLICY": filepath.Join(t.TempDir(), "policy.yaml")}
+			},
+		},
+		{
+			name:  "closed client",
+			vars:  func(*testing.T) map[string]string { return nil },
+			close: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, newFakeServer(t), false)
+			current := c.conn.Load()
+
+			for k, v := range tc.vars(t) {
+				t.Setenv(k, v)
+			}
+
+			if tc.close {
+				if err := c.Close(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c.reload()
+
+			conn := c.conn.Load()
+			if replaced := conn != current; replaced != tc.replaced {
+				t.Fatalf("reload() replaced the connection %t, want %t", replaced, tc.replaced)
+			}
+
+			if !tc.replaced {
+				done, err := current.begin()
+				if (err == nil) == tc.close {
+					t.Errorf("begin() of the kept connection = %v, want it open %t", err, !tc.close)
+				}
+
+				if done != nil {
+					done()
+				}
+
+				return
+			}
+
+			if conn.settings.Compat != dbutil.CompatStrict || current.settings.Compat != dbutil.CompatWarn {
+				t.Errorf("reload() settings = %q, was %q; want %q, was %q", conn.settings.Compat, current.settings.Compat, dbutil.CompatStrict, dbutil.CompatWarn)
+			}
+
+			if _, done, err := c.acquire(); err != nil {
+				t.Errorf("acquire() after reload() failed: %v", err)
+			} else {
+				done()
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package docdb_poc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	db "docdb_poc/db"
+	"docdb_poc/internal/mongo/encrypt"
+)
+
+const (
+	codeNamespaceNotFound   = 26
+	codeCommandNotFound     = 59
+	codeCannotCreateIndex   = 67
+	codeCommandNotSupported = 115
+	codeInvalidIndexSpec    = 197
+	// reported by DocumentDB for features it does not implement
+	codeFeatureNotSupported = 303
+	codeUnrecognizedStage   = 40324
+)
+
+func (c *client) ApplySchemas(ctx context.Context) error {
+	if c.readOnly {
+		return errReadOnly
+	}
+
+	validators := db.ServerSchemas()
+	indexes := []map[string][]mongo.IndexModel{db.ShadowIndexes(), db.SearchIndexes(), db.GeoIndexes()}
+	vectors := db.VectorFields()
+
+	// every collection is authorized before any is changed
+	collections := make(map[string]bool)
+	for coll := range validators {
+		collections[coll] = true
+	}
+
+	for _, group := range indexes {
+		for coll := range group {
+			collections[coll] = true
+		}
+	}
+
+	for coll := range vectors {
+		collections[coll] = true
+	}
+
+	for coll := range collections {
+		if err := c.authorizeSchema(ctx, coll); err != nil {
+			return err
+		}
+	}
+
+	if enc := c.enc.Load(); enc != nil {
+		for coll, validator := range validators {
+			encryptedSchema(validator, enc.Fields(coll))
+		}
+	}
+
+	dbc, done, err := c.acquire()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	for coll, validator := range validators {
+		err := dbc.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: coll},
+			{Key: "validator", Value: validator},
+			{Key: "validationLevel", Value: "strict"},
+		}).Err()
+
+		if commandCode(err) == codeNamespaceNotFound {
+			err = dbc.CreateCollection(ctx, coll, options.CreateCollection().SetValidator(validator))
+		}
+
+		switch commandCode(err) {
+		case 0:
+			if err != nil {
+				return wraperrors.Wrapf(err, "unable to apply schema of %s", coll)
+			}
+
+			logrus.Infof("Applied schema validator to %s", coll)
+		case codeCommandNotFound, codeCommandNotSupported, codeFeatureNotSupported:
+			logrus.Warnf("Server does not support schema validators; %s is only validated by the client: %v", coll, err)
+		default:
+			return wraperrors.Wrapf(err, "unable to apply schema of %s", coll)
+		}
+	}
+
+	for _, group := range indexes {
+		for coll, models := range group {
+			if _, err := dbc.Collection(coll).Indexes().CreateMany(ctx, models); err != nil {
+				return wraperrors.Wrapf(err, "unable to create indexes of %s", coll)
+			}
+
+			logrus.Infof("Created indexes of %s", coll)
+		}
+	}
+
+	for coll, fields := range vectors {
+		for _, f := range fields {
+			err := dbc.RunCommand(ctx, bson.D{
+				{Key: "createIndexes", Value: coll},
+				{Key: "indexes", Value: bson.A{f.IndexSpec()}},
+			}).Err()
+
+			switch commandCode(err) {
+			case 0:
+				if err != nil {
+					return wraperrors.Wrapf(err, "unable to create vector index of %s.%s", coll, f.Path)
+				}
+
+				logrus.Infof("Created vector index of %s.%s", coll, f.Path)
+			case codeCommandNotSupported, codeFeatureNotSupported, codeInvalidIndexSpec, codeCannotCreateIndex:
+				logrus.Warnf("Server does not support vector indexes; KNN queries of %s scan the collection: %v", coll, err)
+			default:
+				return wraperrors.Wrapf(err, "unable to create vector index of %s.%s", coll, f.Path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// encryptedSchema replaces the schema of each encrypted field within the $jsonSchema validator: the server only
+// sees the ciphertext, stored as binary values of the encrypted subtype, so the keywords of the field cannot be
+// checked by the server and are left to the client.
+func encryptedSchema(validator bson.M, fields encrypt.Fields) {
+	root, _ := validator["$jsonSchema"].(bson.M)
+
+	for path := range fields {
+		schema := root
+		names := strings.Split(path, ".")
+
+		for i, name := range names {
+			props, _ := schema["properties"].(bson.M)
+			if props == nil {
+				break
+			}
+
+			if i == len(names)-1 {
+				props[name] = bson.M{"bsonType": "binData"}
+
+				break
+			}
+
+			if schema, _ = props[name].(bson.M); schema == nil {
+				break
+			}
+		}
+	}
+}
+
+// commandCode provides the server error code of a failed command; zero when there is none.
+func commandCode(err error) int32 {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code
+	}
+
+	return 0
+}
@@ -0,0 +1,69 @@
+package docdb_poc
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"docdb_poc/internal/mongo/encrypt"
+)
+
+func TestEncryptedSchema(t *testing.T) {
+	validator := func() bson.M {
+		return bson.M{"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"properties": bson.M{
+				"name": bson.M{"type": bson.A{"string"}, "minLength": 1},
+				"ssn":  bson.M{"type": bson.A{"string"}, "pattern": "^[0-9]{9}$"},
+				"address": bson.M{
+					"type":       bson.A{"object"},
+					"properties": bson.M{"street": bson.M{"type": bson.A{"string"}}},
+				},
+			},
+		}}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		fields encrypt.Fields
+		want   bson.M
+	}{
+		{
+			name:   "top level",
+			fields: encrypt.Fields{"ssn": encrypt.Deterministic},
+			want: bson.M{
+				"name": bson.M{"type": bson.A{"string"}, "minLength": 1},
+				"ssn":  bson.M{"bsonType": "binData"},
+				"address": bson.M{
+					"type":       bson.A{"object"},
+					"properties": bson.M{"street": bson.M{"type": bson.A{"string"}}},
+				},
+			},
+		},
+		{
+			name:   "embedded",
+			fields: encrypt.Fields{"address.street": encrypt.Random},
+			want: bson.M{
+				"name": bson.M{"type": bson.A{"string"}, "minLength": 1},
+				"ssn":  bson.M{"type": bson.A{"string"}, "pattern": "^[0-9]{9}$"},
+				"address": bson.M{
+					"type":       bson.A{"object"},
+					"properties": bson.M{"street": bson.M{"bsonType": "binData"}},
+				},
+			},
+		},
+		{
+			name:   "not in schema",
+			fields: encrypt.Fields{"card.number": encrypt.Random},
+			want:   validator()["$jsonSchema"].(bson.M)["properties"].(bson.M),
+		},
+	} {
+		v := validator()
+		encryptedSchema(v, tc.fields)
+
+		if got := v["$jsonSchema"].(bson.M)["properties"]; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: encryptedSchema() properties = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package docdb_poc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+)
+
+// rebuildBatch is the number of postings inserted at once when rebuilding a search index.
+const rebuildBatch = 1000
+
+// scored is a document matching the terms of a Text filter along with the sum of the frequencies of the terms.
+type scored struct {
+	ID    interface{} `bson:"_id"`
+	Score int64       `bson:"score"`
+}
+
+// search provides the documents of the collection holding every keyword of the Text filter of the query and
+// matching its other filters, ranked by the sum of the frequencies of the keywords within each document. The
+// Count of the query is set to the number of matching documents, which its limit and offset page through; the
+// order of the query is not applied.
+func (c *client) search(ctx context.Context, collection, keywords string, q *search.Query, opts []db.Option) ([]bson.M, error) {
+	index, ok := db.SearchIndexOf(collection)
+	if !ok {
+		return nil, errors.NewDomainError(errors.ErrInvalid, errors.Default, "text filter of "+collection, "a collection with a search index")
+	}
+
+	filter, grant, err := c.prepareRead(ctx, collection, db.Filters(collection, q))
+	if err != nil {
+		return nil, err
+	}
+
+	q.Count = 0
+
+	terms := index.Terms(keywords)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	dbc, done, err := c.acquireRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	postings, err := configuredCollection(dbc, db.SearchCollection(collection), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page, total, err := rank(ctx, postings, collection, terms, filter, q)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Count = total
+
+	if len(page) == 0 {
+		return nil, nil
+	}
+
+	ids := make(bson.A, 0, len(page))
+	for _, s := range page {
+		ids = append(ids, s.ID)
+	}
+
+	findOpts := options.Find()
+	if !q.EmptyFields() {
+		findOpts.SetProjection(dbutil.Select(q))
+	}
+
+	cur, err := coll.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, findOpts)
+	if err != nil {
+		return nil, asDomainError(err, collection, "unable to find documents")
+	}
+
+	var docs []bson.M
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, wraperrors.Wrap(err, "unable to read documents")
+	}
+
+	byID := make(map[string]bson.M, len(docs))
+	for _, doc := range docs {
+		byID[idKey(doc["_id"])] = doc
+	}
+
+	found := make([]bson.M, 0, len(page))
+
+	for _, s := range page {
+		// documents deleted since they were ranked are skipped
+		doc, ok := byID[idKey(s.ID)]
+		if !ok {
+			continue
+		}
+
+		if doc, err = c.readResult(collection, grant, doc); err != nil {
+			return nil, err
+		}
+
+		found = append(found, doc)
+	}
+
+	return found, nil
+}
+
+// rank provides the page, selected by the offset and limit of the query, of the ids of the documents of the
+// collection holding every term and matching the filter, by descending score, along with the number of such
+// documents. The postings are joined with the collection so that only the page is read.
+func rank(ctx context.Context, postings *mongo.Collection, collection string, terms []string, filter bson.M, q *search.Query) ([]scored, int64, error) {
+	stages, err := rankPipeline(collection, terms, filter, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cur, err := postings.Aggregate(ctx, stages)
+	if err != nil {
+		return nil, 0, asDomainError(err, postings.Name(), "unable to rank documents")
+	}
+
+	var ranked []struct {
+		Page  []scored `bson:"page"`
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+	}
+
+	if err := cur.All(ctx, &ranked); err != nil {
+		return nil, 0, wraperrors.Wrap(err, "unable to read ranked documents")
+	}
+
+	if len(ranked) == 0 || len(ranked[0].Total) == 0 {
+		return nil, 0, nil
+	}
+
+	return ranked[0].Page, ranked[0].Total[0].N, nil
+}
+
+// rankPipeline aggregates the postings into a single document holding the ranked page in the page field and the
+// number of ranked documents in the total field.
+func rankPipeline(collection string, terms []string, filter bson.M, q *search.Query) (mongo.Pipeline, error) {
+	p := db.NewPipeline().
+		Match(bson.M{"term": bson.M{"$in": terms}}).
+		Group("$doc", bson.M{"score": bson.M{"$sum": "$tf"}, "terms": bson.M{"$sum": 1}}).
+		Match(bson.M{"terms": len(terms)})
+
+	if len(filter) > 0 {
+		p = p.Stage(bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: collection},
+			{Key: "let", Value: bson.M{"doc": "$_id"}},
+			{Key: "pipeline", Value: bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$doc"}}}},
+				bson.M{"$match": filter},
+				bson.M{"$project": bson.M{"_id": 1}},
+			}},
+			{Key: "as", Value: "matched"},
+		}}}).
+			Match(bson.M{"matched.0": bson.M{"$exists": true}})
+	}
+
+	page := db.NewPipeline().Skip(int64(q.Offset()))
+	if q.Limit() > 0 {
+		page = page.Limit(int64(q.Limit()))
+	}
+
+	return p.
+		Sort(bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}).
+		Facet(map[string]*db.Pipeline{
+			"page":  page.Project(bson.M{"score": 1}),
+			"total": db.NewPipeline().Count("n"),
+		}).
+		Build()
+}
+
+// idKey provides a comparable key of a document id, as ids such as binary UUIDs cannot be map keys.
+func idKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+// index replaces the postings of the document of the collection, removing them when the document is nil, when
+// the collection has a search index. The postings are written after the document, so a failure is logged rather
+// than failing the write; the postings are repaired when the document is next written or by RebuildSearchIndex.
+func (c *client) index(ctx context.Context, dbc *mongo.Database, collection string, id interface{}, doc bson.M, opts []db.Option) {
+	index, ok := db.SearchIndexOf(collection)
+	if !ok {
+		return
+	}
+
+	postings, err := configuredCollection(dbc, db.SearchCollection(collection), opts)
+	if err == nil {
+		err = writePostings(ctx, postings, index, id, doc)
+	}
+
+	if err != nil {
+		logrus.Warnf("Unable to index document %v of %s: %v", c.settings().Shape(id), collection, err)
+	}
+}
+
+// reindex replaces the postings of the document of the collection with the id, as stored after an update, which
+// is read from the primary as secondaries may not have replicated the update yet.
+func (c *client) reindex(ctx context.Context, dbc *mongo.Database, collection string, id interface{}, opts []db.Option) {
+	if _, ok := db.SearchIndexOf(collection); !ok {
+		return
+	}
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err == nil {
+		coll, err = coll.Clone(options.Collection().SetReadPreference(readpref.Primary()))
+	}
+
+	var doc bson.M
+
+	if err == nil {
+		err = coll.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	}
+
+	if err != nil && err != mongo.ErrNoDocuments {
+		logrus.Warnf("Unable to index document %v of %s: %v", c.settings().Shape(id), collection, err)
+
+		return
+	}
+
+	c.index(ctx, dbc, collection, id, doc, opts)
+}
+
+// checkSearchIndex verifies that the fields of the search index of the collection are not encrypted, as their
+// postings would hold their keywords in plain text.
+func (c *client) checkSearchIndex(collection string) error {
+	enc := c.enc.Load()
+	if enc == nil {
+		return nil
+	}
+
+	index, ok := db.SearchIndexOf(collection)
+	if !ok {
+		return nil
+	}
+
+	for field := range enc.Fields(collection) {
+		for _, f := range index.Fields {
+			if f == field || strings.HasPrefix(f, field+".") || strings.HasPrefix(field, f+".") {
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, "search index field "+f, "a field that is not encrypted")
+			}
+		}
+	}
+
+	return nil
+}
+
+func writePostings(ctx context.Context, postings *mongo.Collection, index *db.SearchIndex, id interface{}, doc bson.M) error {
+	if _, err := postings.DeleteMany(ctx, bson.M{"doc": id}); err != nil {
+		return wraperrors.Wrap(err, "unable to delete postings")
+	}
+
+	if doc == nil {
+		return nil
+	}
+
+	if p := index.Postings(id, doc); len(p) > 0 {
+		if _, err := postings.InsertMany(ctx, p, options.InsertMany().SetOrdered(false)); err != nil {
+			return wraperrors.Wrap(err, "unable to insert postings")
+		}
+	}
+
+	return nil
+}
+
+func (c *client) RebuildSearchIndex(ctx context.Context, collection string) error {
+	index, ok := db.SearchIndexOf(collection)
+	if !ok {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, collection, "a collection with a search index")
+	}
+
+	if err := c.checkSearchIndex(collection); err != nil {
+		return err
+	}
+
+	if err := c.authorizeRebuild(ctx, collection, index.Fields...); err != nil {
+		return err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	postings := dbc.Collection(db.SearchCollection(collection))
+
+	if _, err := postings.DeleteMany(ctx, bson.M{}); err != nil {
+		return wraperrors.Wrapf(err, "unable to delete postings of %s", collection)
+	}
+
+	fields := bson.M{"_id": 1}
+	for _, f := range index.Fields {
+		fields[f] = 1
+	}
+
+	cur, err := dbc.Collection(collection).Find(ctx, bson.M{}, options.Find().SetProjection(fields))
+	if err != nil {
+		return asDomainError(err, collection, "unable to find documents")
+	}
+	defer cur.Close(ctx)
+
+	var batch []interface{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if _, err := postings.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+			return wraperrors.Wrapf(err, "unable to insert postings of %s", collection)
+		}
+
+		batch = batch[:0]
+
+		return nil
+	}
+
+	indexed := 0
+
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return wraperrors.Wrap(err, "unable to read document")
+		}
+
+		batch = append(batch, index.Postings(doc["_id"], doc)...)
+		indexed++
+
+		if len(batch) >= rebuildBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return wraperrors.Wrap(err, "unable to read documents")
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	logrus.Infof("Rebuilt search index of %s from %d documents", collection, indexed)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package docdb_poc
+
+import (
+	"reflect"
+	"testing"
+
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRankPipeline(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		filter bson.M
+		q      *search.Query
+		stages []string
+		page   []string
+	}{
+		{
+			name:   "unfiltered",
+			q:      search.NewQuery(),
+			stages: []string{"$match", "$group", "$match", "$sort", "$facet"},
+			page:   []string{"$skip", "$project"},
+		},
+		{
+			name:   "filtered page",
+			filter: bson.M{"status": "active"},
+			q:      search.NewQuery(search.Offset(20), search.Limit(10)),
+			stages: []string{"$match", "$group", "$match", "$lookup", "$match", "$sort", "$facet"},
+			page:   []string{"$skip", "$limit", "$project"},
+		},
+	} {
+		stages, err := rankPipeline("articles", []string{"go", "mongo"}, tc.filter, tc.q)
+		if err != nil {
+			t.Errorf("%s: rankPipeline() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		var names []string
+		for _, stage := range stages {
+			names = append(names, stage[0].Key)
+		}
+
+		if !reflect.DeepEqual(names, tc.stages) {
+			t.Errorf("%s: rankPipeline() stages = %v, want %v", tc.name, names, tc.stages)
+
+			continue
+		}
+
+		facet := stages[len(stages)-1][0].Value.(bson.D)
+		if facet[0].Key != "page" || facet[1].Key != "total" {
+			t.Errorf("%s: $facet = %v, want page and total", tc.name, facet)
+
+			continue
+		}
+
+		var page []string
+		for _, stage := range facet[0].Value.(mongo.Pipeline) {
+			page = append(page, stage[0].Key)
+		}
+
+		if !reflect.DeepEqual(page, tc.page) {
+			t.Errorf("%s: page stages = %v, want %v", tc.name, page, tc.page)
+		}
+
+		if skip := facet[0].Value.(mongo.Pipeline)[0][0].Value; skip != int64(tc.q.Offset()) {
+			t.Errorf("%s: $skip = %v, want %d", tc.name, skip, tc.q.Offset())
+		}
+
+		if tc.filter != nil {
+			lookup := stages[3][0].Value.(bson.D)
+			if from := lookup[0].Value; from != "articles" {
+				t.Errorf("%s: $lookup from %v, want articles", tc.name, from)
+			}
+		}
+	}
+}
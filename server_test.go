@@ -0,0 +1,319 @@
+package docdb_poc
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gitscm.cisco.com/mcmp/utils/env"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/wiremessage"
+
+	dbutil "docdb_poc/internal/mongo"
+	"docdb_poc/internal/mongo/config"
+)
+
+// fakeServer answers the commands of the driver as a standalone server; commands without a handler fail with
+// CommandNotFound.
+type fakeServer struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	handlers map[string]func(cmd bson.M) bson.M
+	commands []string
+}
+
+// newFakeServer starts a fakeServer stopped once the test completes.
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeServer{ln: ln, handlers: make(map[string]func(cmd bson.M) bson.M)}
+
+	hello := func(bson.M) bson.M {
+		return bson.M{
+			"ismaster":                     true,
+			"isWritablePrimary":            true,
+			"helloOk":                      true,
+			"maxWireVersion":               int32(13),
+			"minWireVersion":               int32(0),
+			"maxBsonObjectSize":            int32(16 * 1024 * 1024),
+			"maxMessageSizeBytes":          int32(48 * 1024 * 1024),
+			"maxWriteBatchSize":            int32(100000),
+			"logicalSessionTimeoutMinutes": int32(30),
+		}
+	}
+
+	s.handle("hello", hello)
+	s.handle("isMaster", hello)
+	s.handle("ismaster", hello)
+	s.handle("ping", func(bson.M) bson.M { return bson.M{} })
+	s.handle("endSessions", func(bson.M) bson.M { return bson.M{} })
+
+	go s.serve()
+
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+
+	return s
+}
+
+// URI provides the connection string of the server.
+func (s *fakeServer) URI() string {
+	return "mongodb://" + s.ln.Addr().String() + "/app?serverSelectionTimeoutMS=500"
+}
+
+// handle answers the command using fn; the ok field is added to the reply unless set.
+func (s *fakeServer) handle(name string, fn func(cmd bson.M) bson.M) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[name] = fn
+}
+
+// received provides the names of the commands received, other than those monitoring the server.
+func (s *fakeServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *fakeServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+
+		msg := make([]byte, binary.LittleEndian.Uint32(size[:]))
+		copy(msg, size[:])
+
+		if _, err := io.ReadFull(conn, msg[4:]); err != nil {
+			return
+		}
+
+		_, reqID, _, opcode, rem, ok := wiremessage.ReadHeader(msg)
+		if !ok {
+			return
+		}
+
+		var reply []byte
+
+		switch opcode {
+		case wiremessage.OpQuery:
+			reply = s.query(reqID, rem)
+		case wiremessage.OpMsg:
+			reply = s.msg(reqID, rem)
+		}
+
+		if reply == nil {
+			continue
+		}
+
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// query answers the legacy handshake of the driver.
+func (s *fakeServer) query(reqID int32, rem []byte) []byte {
+	_, rem, _ = wiremessage.ReadQueryFlags(rem)
+	_, rem, _ = wiremessage.ReadQueryFullCollectionName(rem)
+	_, rem, _ = wiremessage.ReadQueryNumberToSkip(rem)
+	_, rem, _ = wiremessage.ReadQueryNumberToReturn(rem)
+
+	query, _, ok := wiremessage.ReadQueryQuery(rem)
+	if !ok {
+		return nil
+	}
+
+	doc := s.run(bson.Raw(query))
+
+	idx, dst := wiremessage.AppendHeaderStart(nil, 0, reqID, wiremessage.OpReply)
+	dst = wiremessage.AppendReplyFlags(dst, 0)
+	dst = wiremessage.AppendReplyCursorID(dst, 0)
+	dst = wiremessage.AppendReplyStartingFrom(dst, 0)
+	dst = wiremessage.AppendReplyNumberReturned(dst, 1)
+	dst = append(dst, doc...)
+
+	return bsoncore.UpdateLength(dst, idx, int32(len(dst[idx:])))
+}
+
+// msg answers a command; commands requesting no reply are not answered.
+func (s *fakeServer) msg(reqID int32, rem []byte) []byte {
+	flags, rem, ok := wiremessage.ReadMsgFlags(rem)
+	if !ok {
+		return nil
+	}
+
+	var cmd bson.D
+
+	for len(rem) > 0 {
+		stype, next, ok := wiremessage.ReadMsgSectionType(rem)
+		if !ok {
+			break
+		}
+
+		switch stype {
+		case wiremessage.SingleDocument:
+			doc, r, ok := wiremessage.ReadMsgSectionSingleDocument(next)
+			if !ok {
+				return nil
+			}
+
+			if err := bson.Unmarshal(doc, &cmd); err != nil {
+				return nil
+			}
+
+			rem = r
+		case wiremessage.DocumentSequence:
+			identifier, docs, r, ok := wiremessage.ReadMsgSectionDocumentSequence(next)
+			if !ok {
+				return nil
+			}
+
+			seq := make(bson.A, 0, len(docs))
+			for _, d := range docs {
+				seq = append(seq, bson.Raw(d))
+			}
+
+			cmd = append(cmd, bson.E{Key: identifier, Value: seq})
+			rem = r
+		default:
+			return nil
+		}
+	}
+
+	raw, err := bson.Marshal(cmd)
+	if err != nil {
+		return nil
+	}
+
+	doc := s.run(raw)
+
+	if flags&wiremessage.MoreToCome != 0 {
+		return nil
+	}
+
+	idx, dst := wiremessage.AppendHeaderStart(nil, 0, reqID, wiremessage.OpMsg)
+	dst = wiremessage.AppendMsgFlags(dst, 0)
+	dst = wiremessage.AppendMsgSectionType(dst, wiremessage.SingleDocument)
+	dst = append(dst, doc...)
+
+	return bsoncore.UpdateLength(dst, idx, int32(len(dst[idx:])))
+}
+
+// run answers the command held by the document.
+func (s *fakeServer) run(raw bson.Raw) bson.Raw {
+	elems, err := raw.Elements()
+	if err != nil || len(elems) == 0 {
+		return nil
+	}
+
+	name := elems[0].Key()
+
+	var cmd bson.M
+	_ = bson.Unmarshal(raw, &cmd)
+
+	s.mu.Lock()
+	fn, ok := s.handlers[name]
+
+	switch name {
+	case "hello", "isMaster", "ismaster":
+	default:
+		s.commands = append(s.commands, name)
+	}
+	s.mu.Unlock()
+
+	reply := bson.M{"ok": 0.0, "code": int32(59), "codeName": "CommandNotFound", "errmsg": "no such command: " + name}
+
+	if ok {
+		reply = fn(cmd)
+		if _, set := reply["ok"]; !set {
+			reply["ok"] = 1.0
+		}
+	}
+
+	out, _ := bson.Marshal(reply)
+
+	return out
+}
+
+// configureTest sets the environment and loads an empty configuration file for a single test.
+func configureTest(t *testing.T, vars map[string]string) {
+	t.Helper()
+	t.Cleanup(config.Restore)
+
+	for k, v := range vars {
+		t.Setenv(k, v)
+	}
+
+	viper.Set(env.SvcName, "orders")
+
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("MONGO_DB_CONFIG_FILE", name)
+
+	if err := os.WriteFile(name, []byte("db.mongo: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.LoadMongoConfigs(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestClient creates a client of the server, or of an unreachable cluster when the server is nil, closed
+// once the test completes.
+func newTestClient(t *testing.T, s *fakeServer, readOnly bool) *client {
+	t.Helper()
+
+	uri := "mongodb://127.0.0.1:1/app?serverSelectionTimeoutMS=100"
+	if s != nil {
+		uri = s.URI()
+	}
+
+	configureTest(t, map[string]string{"MONGO_DB_URI": uri, "MONGO_DB_STARTUP_DEADLINE": "200ms"})
+
+	c := &client{picks: []dbutil.Selector{dbutil.ReadWrite()}}
+	if readOnly {
+		c = &client{readOnly: true, picks: []dbutil.Selector{dbutil.ReadOnly(), dbutil.ReadPreference(readpref.SecondaryPreferred())}}
+	}
+
+	if _, err := newClient(c); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = c.Close(context.Background())
+	})
+
+	return c
+}
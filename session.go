@@ -0,0 +1,48 @@
+package docdb_poc
+
+import (
+	"context"
+	"sync"
+
+	wraperrors "github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type sessionKey struct{}
+
+// CausalSession starts a causally-consistent session that is used by every operation provided the
+// returned context; reads within the session observe the preceding writes of the session, even when
+// reading from a secondary. The session remains bound to the connection it was started on, which is
+// kept open until the returned func is called.
+func (c *client) CausalSession(ctx context.Context) (context.Context, func(), error) {
+	dbc, done, err := c.acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sess, err := dbc.Client().StartSession(options.Session().SetCausalConsistency(true))
+	if err != nil {
+		done()
+
+		return nil, nil, wraperrors.Wrap(err, "unable to start session")
+	}
+
+	var once sync.Once
+
+	end := func() {
+		once.Do(func() {
+			sess.EndSession(context.Background())
+			done()
+		})
+	}
+
+	return context.WithValue(mongo.NewSessionContext(ctx, sess), sessionKey{}, dbc), end, nil
+}
+
+// sessionDatabase provides the database connection of the session started by CausalSession, when present.
+func sessionDatabase(ctx context.Context) (*mongo.Database, bool) {
+	dbc, ok := ctx.Value(sessionKey{}).(*mongo.Database)
+
+	return dbc, ok
+}
@@ -0,0 +1,100 @@
+package docdb_poc
+
+import (
+	"context"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	db "docdb_poc/db"
+)
+
+func (c *client) RebuildShadowFields(ctx context.Context, collection string) error {
+	fields := db.ShadowFields(collection)
+	if len(fields) == 0 {
+		return errors.NewDomainError(errors.ErrInvalid, errors.Default, collection, "a collection with shadow fields")
+	}
+
+	if err := c.checkShadows(collection); err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(fields))
+	for _, f := range fields {
+		paths = append(paths, f.Path)
+	}
+
+	if err := c.authorizeRebuild(ctx, collection, paths...); err != nil {
+		return err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	coll := dbc.Collection(collection)
+
+	projection := bson.M{"_id": 1}
+	for _, f := range fields {
+		projection[f.Path] = 1
+	}
+
+	cur, err := coll.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return asDomainError(err, collection, "unable to find documents")
+	}
+	defer cur.Close(ctx)
+
+	var batch []mongo.WriteModel
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if _, err := coll.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false)); err != nil {
+			return wraperrors.Wrapf(err, "unable to write shadow fields of %s", collection)
+		}
+
+		batch = batch[:0]
+
+		return nil
+	}
+
+	rebuilt := 0
+
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return wraperrors.Wrap(err, "unable to read document")
+		}
+
+		filter, update := db.ShadowBackfill(collection, doc)
+		batch = append(batch, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update))
+		rebuilt++
+
+		if len(batch) >= rebuildBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return wraperrors.Wrap(err, "unable to read documents")
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	logrus.Infof("Rebuilt shadow fields of %s from %d documents", collection, rebuilt)
+
+	return nil
+}
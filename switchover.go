@@ -0,0 +1,281 @@
+package docdb_poc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+	"docdb_poc/internal/mongo/config"
+)
+
+const (
+	// how often the error rate is evaluated during a switchover
+	observeInterval = 5 * time.Second
+	// minimum number of commands within an interval before the error rate is considered
+	minSamples = 20
+)
+
+// canary routes a percentage of reads to a connection that is not yet serving all traffic.
+type canary struct {
+	conn    *connection
+	percent int
+}
+
+// acquireRead provides the database connection for a single read operation, routing the read to the
+// canary connection when a switchover is in progress. Reads within a session use the connection of the session.
+func (c *client) acquireRead(ctx context.Context) (*mongo.Database, func(), error) {
+	if dbc, ok := sessionDatabase(ctx); ok {
+		return dbc, func() {}, nil
+	}
+
+	if cn := c.canary.Load(); cn != nil && rand.Intn(100) < cn.percent {
+		if done, err := cn.conn.begin(); err == nil {
+			return cn.conn.dbc, done, nil
+		}
+	}
+
+	return c.acquire()
+}
+
+func (c *client) Switchover(ctx context.Context, plan db.SwitchoverPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+
+	plan = plan.WithDefaults()
+
+	c.cutover.Lock()
+	defer c.cutover.Unlock()
+
+	if c.closed.Load() {
+		return errUnavailable
+	}
+
+	stats := new(commandStats)
+
+	// the future configurations are merged into the current ones, so keys only within the future
+	// configurations are removed by restoring the snapshot
+	current := config.TakeSnapshot()
+
+	config.Future()
+
+	if err := config.LoadMongoConfigs(); err != nil {
+		current.Restore()
+
+		return wraperrors.Wrapf(err, "unable to load future configurations from %q", config.GetString(config.MongoDBConfigFile))
+	}
+
+	dbc, err := dbutil.New(newContext(), c.selectors(dbutil.Verified(), dbutil.Commands(stats.monitor()))...)
+	if err != nil {
+		current.Restore()
+
+		return wraperrors.Wrap(err, "unable to connect using future configurations")
+	}
+
+	future := &connection{dbc: dbc, settings: dbutil.CurrentSettings()}
+
+	if err := validate(ctx, dbc, plan); err != nil {
+		return c.rollback(current, future, err)
+	}
+
+	if plan.CanaryPercent > 0 {
+		if !c.hold(future) {
+			return c.rollback(current, future, errUnavailable)
+		}
+
+		logrus.Infof("Switchover sending %d%% of reads to future configurations", plan.CanaryPercent)
+
+		c.canary.Store(&canary{conn: future, percent: plan.CanaryPercent})
+		err := stats.observe(ctx, plan.CanaryDuration, plan.MaxErrorRate)
+		c.canary.Store(nil)
+
+		if err != nil {
+			c.standby.CompareAndSwap(future, nil)
+
+			return c.rollback(current, future, err)
+		}
+	}
+
+	serving, ok := c.swap(future)
+	if !ok {
+		return c.rollback(current, future, errUnavailable)
+	}
+
+	if !c.hold(serving) {
+		retire(serving)
+
+		return errUnavailable
+	}
+
+	logrus.Info("Switchover moved all traffic to future configurations")
+
+	if err := stats.observe(ctx, plan.Observe, plan.MaxErrorRate); err != nil {
+		if _, ok := c.swap(serving); ok {
+			c.standby.CompareAndSwap(serving, nil)
+		}
+
+		return c.rollback(current, future, err)
+	}
+
+	c.standby.CompareAndSwap(serving, nil)
+	retire(serving)
+
+	logrus.Info("Switchover to future configurations completed")
+
+	return nil
+}
+
+// rollback discards the future connection and restores the current configurations.
+func (c *client) rollback(current *config.Snapshot, future *connection, cause error) error {
+	logrus.Warnf("Switchover rolled back to current configurations: %v", cause)
+
+	retire(future)
+	current.Restore()
+
+	return cause
+}
+
+// validate checks that the connection is authenticated, can see the expected database and that the
+// indexes required by the plan exist.
+func validate(ctx context.Context, dbc *mongo.Database, plan db.SwitchoverPlan) error {
+	var status struct {
+		AuthInfo struct {
+			AuthenticatedUsers []bson.M `bson:"authenticatedUsers"`
+		} `bson:"authInfo"`
+	}
+
+	if err := dbc.RunCommand(ctx, bson.D{{Key: "connectionStatus", Value: 1}}).Decode(&status); err != nil {
+		return wraperrors.Wrap(err, "unable to check connection status")
+	}
+
+	if st, ok := dbutil.CurrentStatus(dbc); ok && st.Credentials != dbutil.CredentialsNone && len(status.AuthInfo.AuthenticatedUsers) == 0 {
+		return errors.NewDomainError(errors.ErrPreconditionNotMet, errors.Default, "authenticated user")
+	}
+
+	names, err := dbc.Client().ListDatabaseNames(ctx, bson.D{{Key: "name", Value: dbc.Name()}}, options.ListDatabases().SetAuthorizedDatabases(true))
+	if err != nil {
+		return wraperrors.Wrap(err, "unable to list databases")
+	}
+
+	if len(names) == 0 {
+		return errors.NewDomainError(errors.ErrPreconditionNotMet, errors.Default, "database "+dbc.Name())
+	}
+
+	for coll, expected := range plan.Indexes {
+		specs, err := dbc.Collection(coll).Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return wraperrors.Wrapf(err, "unable to list indexes of %s", coll)
+		}
+
+		found := make(map[string]bool, len(specs))
+		for _, spec := range specs {
+			found[spec.Name] = true
+		}
+
+		for _, name := range expected {
+			if !found[name] {
+				return errors.NewDomainError(errors.ErrPreconditionNotMet, errors.Default, fmt.Sprintf("index %s.%s", coll, name))
+			}
+		}
+	}
+
+	return nil
+}
+
+// commandStats counts the commands executed by a connection; only commands failing due to the network or the
+// servers are counted as failed.
+type commandStats struct {
+	succeeded atomic.Int64
+	failed    atomic.Int64
+}
+
+func (s *commandStats) monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(context.Context, *event.CommandSucceededEvent) {
+			s.succeeded.Add(1)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			if serverFailure(e.Failure) {
+				s.failed.Add(1)
+			} else {
+				s.succeeded.Add(1)
+			}
+		},
+	}
+}
+
+// observe evaluates the error rate of the commands every interval for the duration, returning an error
+// when the rate exceeds the maximum or the context is canceled.
+func (s *commandStats) observe(ctx context.Context, d time.Duration, maxRate float64) error {
+	ticker := time.NewTicker(observeInterval)
+	defer ticker.Stop()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	succeeded, failed := s.succeeded.Load(), s.failed.Load()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case <-ticker.C:
+			ok, nok := s.succeeded.Load()-succeeded, s.failed.Load()-failed
+			succeeded, failed = succeeded+ok, failed+nok
+
+			if total := ok + nok; total >= minSamples && float64(nok)/float64(total) > maxRate {
+				return errors.NewDomainError(errors.ErrPreconditionNotMet, errors.Default,
+					fmt.Sprintf("error rate %d/%d within %.0f%%", nok, total, maxRate*100))
+			}
+		}
+	}
+}
+
+// serverErrors are the names of the server errors caused by the servers or the credentials of a connection
+// rather than by the command, such as a duplicate key or a document failing validation.
+var serverErrors = map[string]bool{
+	"AuthenticationFailed":              true,
+	"Unauthorized":                      true,
+	"HostUnreachable":                   true,
+	"HostNotFound":                      true,
+	"NetworkTimeout":                    true,
+	"SocketException":                   true,
+	"ExceededTimeLimit":                 true,
+	"InternalError":                     true,
+	"ShutdownInProgress":                true,
+	"InterruptedAtShutdown":             true,
+	"InterruptedDueToReplStateChange":   true,
+	"PrimarySteppedDown":                true,
+	"NotWritablePrimary":                true,
+	"NotPrimaryNoSecondaryOk":           true,
+	"NotPrimaryOrSecondary":             true,
+	"NetworkInterfaceExceededTimeLimit": true,
+}
+
+// serverFailure reports if the failure of a command, formatted as "(Name) message" for server errors, was
+// caused by the network or the servers. Errors without a name are raised by the driver, such as when the
+// connection is closed or times out; those caused by the caller canceling the operation are not counted.
+func serverFailure(failure string) bool {
+	if strings.HasPrefix(failure, "(") {
+		if end := strings.Index(failure, ")"); end > 0 {
+			return serverErrors[failure[1:end]]
+		}
+	}
+
+	return !strings.Contains(failure, context.Canceled.Error())
+}
@@ -0,0 +1,205 @@
+package docdb_poc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	db "docdb_poc/db"
+	"docdb_poc/internal/mongo/config"
+)
+
+func TestSwitchoverMissingFuture(t *testing.T) {
+	c := newTestClient(t, newFakeServer(t), false)
+	conn := c.conn.Load()
+	file := config.GetString(config.MongoDBConfigFile)
+
+	if err := c.Switchover(context.Background(), db.SwitchoverPlan{}); err == nil {
+		t.Fatal("Switchover() without future configurations succeeded, want error")
+	}
+
+	if got := config.GetString(config.MongoDBConfigFile); got != file {
+		t.Errorf("Switchover() left %q configured, want %q restored", got, file)
+	}
+
+	if c.conn.Load() != conn {
+		t.Error("Switchover() replaced the connection, want the current one kept")
+	}
+
+	if err := c.Switchover(context.Background(), db.SwitchoverPlan{CanaryPercent: 101}); err == nil {
+		t.Error("Switchover() of an invalid plan succeeded, want error")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	c := newTestClient(t, newFakeServer(t), false)
+	serving := c.conn.Load()
+	future := &connection{dbc: newTestClient(t, newFakeServer(t), false).conn.Load().dbc}
+
+	current := config.TakeSnapshot()
+
+	config.Set(config.MongoDBCompat, "strict")
+
+	cause := errUnavailable
+	if err := c.rollback(current, future, cause); err != cause {
+		t.Errorf("rollback() = %v, want the cause", err)
+	}
+
+	if got := config.GetString(config.MongoDBCompat); got != "warn" {
+		t.Errorf("rollback() compat = %q, want the current configurations restored", got)
+	}
+
+	if c.conn.Load() != serving {
+		t.Error("rollback() replaced the serving connection")
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		done, err := future.begin()
+		if err != nil {
+			break
+		}
+
+		done()
+
+		if time.Now().After(deadline) {
+			t.Fatal("rollback() did not close the future connection")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	databases := func(names ...string) func(bson.M) bson.M {
+		return func(bson.M) bson.M {
+			dbs := bson.A{}
+			for _, name := range names {
+				dbs = append(dbs, bson.M{"name": name, "sizeOnDisk": int64(0), "empty": false})
+			}
+
+			return bson.M{"databases": dbs, "totalSize": int64(0)}
+		}
+	}
+
+	indexes := func(cmd bson.M) bson.M {
+		batch := bson.A{bson.M{"v": int32(2), "key": bson.M{"_id": int32(1)}, "name": "_id_"}}
+		if cmd["listIndexes"] == "orders" {
+			batch = append(batch, bson.M{"v": int32(2), "key": bson.M{"status": int32(1)}, "name": "status_1"})
+		}
+
+		return bson.M{"cursor": bson.M{"id": int64(0), "ns": "app." + cmd["listIndexes"].(string), "firstBatch": batch}}
+	}
+
+	status := func(bson.M) bson.M {
+		return bson.M{"authInfo": bson.M{"authenticatedUsers": bson.A{}, "authenticatedUserRoles": bson.A{}}}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		status    func(bson.M) bson.M
+		databases func(bson.M) bson.M
+		indexes   map[string][]string
+		ok        bool
+	}{
+		{"valid", status, databases("app"), map[string][]string{"orders": {"_id_", "status_1"}}, true},
+		{"no indexes required", status, databases("app"), nil, true},
+		{"missing database", status, databases(), nil, false},
+		{"missing index", status, databases("app"), map[string][]string{"orders": {"total_1"}}, false},
+		{"index of another collection", status, databases("app"), map[string][]string{"users": {"status_1"}}, false},
+		{"connection status unsupported", nil, databases("app"), nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newFakeServer(t)
+			s.handle("listDatabases", tc.databases)
+			s.handle("listIndexes", indexes)
+
+			if tc.status != nil {
+				s.handle("connectionStatus", tc.status)
+			}
+
+			c := newTestClient(t, s, false)
+
+			err := validate(context.Background(), c.conn.Load().dbc, db.SwitchoverPlan{Indexes: tc.indexes})
+			if (err == nil) != tc.ok {
+				t.Errorf("validate() = %v, want valid %t", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestAcquireRead(t *testing.T) {
+	c := newTestClient(t, newFakeServer(t), false)
+	serving := c.conn.Load()
+	future := &connection{dbc: newTestClient(t, newFakeServer(t), false).conn.Load().dbc}
+
+	for _, tc := range []struct {
+		name    string
+		canary  *canary
+		session bool
+		want    *connection
+	}{
+		{"no switchover", nil, false, serving},
+		{"no canary reads", &canary{conn: future, percent: 0}, false, serving},
+		{"all canary reads", &canary{conn: future, percent: 100}, false, future},
+		{"session", &canary{conn: future, percent: 100}, true, serving},
+	} {
+		c.canary.Store(tc.canary)
+
+		ctx := context.Background()
+		if tc.session {
+			ctx = context.WithValue(ctx, sessionKey{}, serving.dbc)
+		}
+
+		dbc, done, err := c.acquireRead(ctx)
+		if err != nil {
+			t.Errorf("%s: acquireRead() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		done()
+
+		if dbc != tc.want.dbc {
+			t.Errorf("%s: acquireRead() used the other connection", tc.name)
+		}
+	}
+
+	c.canary.Store(nil)
+}
+
+func TestServerFailure(t *testing.T) {
+	for _, tc := range []struct {
+		failure string
+		want    bool
+	}{
+		{"(NotWritablePrimary) not primary", true},
+		{"(AuthenticationFailed) bad credentials", true},
+		{"(DuplicateKey) E11000 duplicate key error", false},
+		{"(DocumentValidationFailure) Document failed validation", false},
+		{"connection(db1:27017[-3]) incomplete read of message header: EOF", true},
+		{"context canceled", false},
+	} {
+		if got := serverFailure(tc.failure); got != tc.want {
+			t.Errorf("serverFailure(%q) = %t, want %t", tc.failure, got, tc.want)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	s := new(commandStats)
+
+	if err := s.observe(context.Background(), 10*time.Millisecond, 0.1); err != nil {
+		t.Errorf("observe() = %v, want nil once the duration passes", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.observe(ctx, time.Hour, 0.1); err != context.Canceled {
+		t.Errorf("observe() = %v, want context.Canceled", err)
+	}
+}
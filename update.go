@@ -0,0 +1,395 @@
+package docdb_poc
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	db "docdb_poc/db"
+	dbutil "docdb_poc/internal/mongo"
+)
+
+func (c *client) Update(ctx context.Context, collection string, id interface{}, u *db.Update, opts ...db.Option) error {
+	o := db.NewOptions(opts...)
+
+	grant, err := c.prepareUpdate(ctx, collection, u, o)
+	if err != nil {
+		return err
+	}
+
+	byID := grant.Restrict(bson.M{"_id": id})
+
+	filter, err := c.encryptFilter(collection, u.Filter(byID))
+	if err != nil {
+		return err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("Updating document of %s with %v", collection, c.settings().Shape(u.Operators()))
+
+	var matched int64
+
+	if ops := u.Operators(); len(ops) > 0 {
+		res, err := coll.UpdateOne(ctx, filter, ops, options.Update().SetUpsert(o.Upsert))
+		if err != nil {
+			return c.updateError(ctx, coll, collection, err, u, o, byID)
+		}
+
+		matched = res.MatchedCount + res.UpsertedCount
+	} else if matched, err = coll.CountDocuments(ctx, filter); err != nil {
+		// an update holding only conditions, such as a patch of test operations
+		return asDomainError(err, collection, "unable to update document")
+	}
+
+	if matched > 0 {
+		c.reindex(ctx, dbc, collection, id, opts)
+
+		return nil
+	}
+
+	if err := unmatched(ctx, coll, collection, u, byID); err != nil {
+		return err
+	}
+
+	return notFound(collection, id)
+}
+
+func (c *client) Patch(ctx context.Context, collection string, id interface{}, patch []byte, opts ...db.Option) error {
+	u, err := c.parsePatch(ctx, collection, id, patch, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.Update(ctx, collection, id, u, opts...)
+}
+
+// parsePatch translates the patch into an Update; a merge patch of objects depends on the members of the
+// document they patch, so those are read from the primary first.
+func (c *client) parsePatch(ctx context.Context, collection string, id interface{}, patch []byte, opts []db.Option) (*db.Update, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(patch), []byte("{")) {
+		return db.ParsePatch(patch)
+	}
+
+	targets, err := db.MergeTargets(patch)
+	if err != nil || len(targets) == 0 {
+		return db.ParseMergePatch(patch)
+	}
+
+	grant, err := c.authorize(ctx, collection, db.OpUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := c.encryptFilter(collection, grant.Restrict(bson.M{"_id": id}))
+	if err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := bson.M{}
+	for _, target := range targets {
+		fields[strings.SplitN(target, ".", 2)[0]] = 1
+	}
+
+	primary, err := coll.Clone(options.Collection().SetReadPreference(readpref.Primary()))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+
+	err = primary.FindOne(ctx, filter, options.FindOne().SetProjection(fields)).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		// the Update reports the missing document, or inserts it
+		return db.ParseMergePatch(patch)
+	}
+
+	if err != nil {
+		return nil, asDomainError(err, collection, "unable to patch document")
+	}
+
+	return db.ParseMergePatchOf(patch, doc)
+}
+
+func (c *client) FindOneAndUpdate(ctx context.Context, collection string, filter bson.M, u *db.Update, opts ...db.Option) (bson.M, error) {
+	o := db.NewOptions(opts...)
+
+	if len(u.Operators()) == 0 {
+		return nil, errors.NewDomainError(errors.ErrRequired, errors.Default, "update operators")
+	}
+
+	grant, err := c.prepareUpdate(ctx, collection, u, o)
+	if err != nil {
+		return nil, err
+	}
+
+	readGrant, err := c.authorize(ctx, collection, db.OpRead)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := readGrant.Restrict(grant.Restrict(filter))
+
+	if err := dbutil.Compat(ctx, c.settings().Compat, collection, dbutil.LintFilter(matching)); err != nil {
+		return nil, err
+	}
+
+	f, err := c.encryptFilter(collection, u.Filter(matching))
+	if err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fo := options.FindOneAndUpdate().SetUpsert(o.Upsert).SetReturnDocument(options.Before)
+	if o.Return == db.ReturnAfter {
+		fo.SetReturnDocument(options.After)
+	}
+
+	var doc bson.M
+
+	err = coll.FindOneAndUpdate(ctx, f, u.Operators(), fo).Decode(&doc)
+
+	switch {
+	case err == mongo.ErrNoDocuments && o.Upsert && o.Return == db.ReturnBefore:
+		// the document was inserted, so there is no document before the update
+		if _, ok := db.SearchIndexOf(collection); ok {
+			var inserted bson.M
+			if coll.FindOne(ctx, f, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&inserted) == nil {
+				c.reindex(ctx, dbc, collection, inserted["_id"], opts)
+			}
+		}
+
+		return nil, nil
+	case err == mongo.ErrNoDocuments:
+		if err := unmatched(ctx, coll, collection, u, matching); err != nil {
+			return nil, err
+		}
+
+		return nil, asDomainError(err, collection, "unable to update document")
+	case err != nil:
+		return nil, c.updateError(ctx, coll, collection, err, u, o, matching)
+	}
+
+	c.reindex(ctx, dbc, collection, doc["_id"], opts)
+
+	return c.readResult(collection, readGrant, doc)
+}
+
+func (c *client) FindOneAndDelete(ctx context.Context, collection string, filter bson.M, opts ...db.Option) (bson.M, error) {
+	grant, err := c.authorize(ctx, collection, db.OpDelete)
+	if err != nil {
+		return nil, err
+	}
+
+	readGrant, err := c.authorize(ctx, collection, db.OpRead)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := readGrant.Restrict(grant.Restrict(filter))
+
+	if err := dbutil.Compat(ctx, c.settings().Compat, collection, dbutil.LintFilter(matching)); err != nil {
+		return nil, err
+	}
+
+	f, err := c.encryptFilter(collection, matching)
+	if err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireWrite(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	if err := coll.FindOneAndDelete(ctx, f).Decode(&doc); err != nil {
+		return nil, asDomainError(err, collection, "unable to delete document")
+	}
+
+	c.index(ctx, dbc, collection, doc["_id"], nil, opts)
+
+	return c.readResult(collection, readGrant, doc)
+}
+
+// prepareUpdate authorizes the Update of the collection, also as an insert when upserting, validates it, checks
+// the features it uses against those supported by DocumentDB, maintains the shadow fields of the fields it sets
+// and encrypts the values it sets. The returned Grant restricts the documents the Update may modify.
+func (c *client) prepareUpdate(ctx context.Context, collection string, u *db.Update, o *db.Options) (*db.Grant, error) {
+	grant, err := c.authorize(ctx, collection, db.OpUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Upsert {
+		if _, err := c.authorize(ctx, collection, db.OpInsert); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := grant.CheckUpdate(u); err != nil {
+		return nil, err
+	}
+
+	if err := db.ValidateUpdate(collection, u); err != nil {
+		return nil, err
+	}
+
+	found := append(dbutil.LintUpdate(u.Operators()), dbutil.LintFilter(u.Conditions)...)
+	if err := dbutil.Compat(ctx, c.settings().Compat, collection, found); err != nil {
+		return nil, err
+	}
+
+	if err := c.checkShadows(collection); err != nil {
+		return nil, err
+	}
+
+	if err := c.checkSearchIndex(collection); err != nil {
+		return nil, err
+	}
+
+	if err := db.NormalizeUpdate(collection, u); err != nil {
+		return nil, err
+	}
+
+	if err := c.encryptUpdate(collection, u); err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// updateError maps the errors of an update; an upsert failing on a duplicate key because a document matching
+// the filter, but not the conditions of the Update, exists fails with ErrPreconditionNotMet.
+func (c *client) updateError(ctx context.Context, coll *mongo.Collection, collection string, err error, u *db.Update, o *db.Options, filter bson.M) error {
+	if o.Upsert && mongo.IsDuplicateKeyError(err) {
+		if err := unmatched(ctx, coll, collection, u, filter); err != nil {
+			return err
+		}
+	}
+
+	return asDomainError(err, collection, "unable to update document")
+}
+
+// unmatched determines why no document matched an Update: ErrPreconditionNotMet when a document matches the
+// filter but not the conditions of the Update; nil otherwise.
+func unmatched(ctx context.Context, coll *mongo.Collection, collection string, u *db.Update, filter bson.M) error {
+	if len(u.Conditions) == 0 {
+		return nil
+	}
+
+	n, err := coll.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return asDomainError(err, collection, "unable to update document")
+	}
+
+	if n > 0 {
+		return errors.NewDomainError(errors.ErrPreconditionNotMet, errors.Default)
+	}
+
+	return nil
+}
+
+// encryptUpdate encrypts the values set by the Update at, or above, the encrypted fields of the collection.
+// Encrypted values are opaque, so the Update can only set or unset them as a whole.
+func (c *client) encryptUpdate(collection string, u *db.Update) error {
+	enc := c.enc.Load()
+	if enc == nil {
+		return nil
+	}
+
+	fields := enc.Fields(collection)
+
+	for _, path := range u.Paths() {
+		_, set := u.Set[path]
+		_, setOnInsert := u.SetOnInsert[path]
+		_, unset := u.Unset[path]
+
+		for field := range fields {
+			switch {
+			case strings.HasPrefix(path, field+"."):
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, path, "a path outside encrypted field "+field)
+			case (path == field || strings.HasPrefix(field, path+".")) && !set && !setOnInsert && !unset:
+				return errors.NewDomainError(errors.ErrInvalid, errors.Default, path, "a path set as a whole as it is encrypted")
+			}
+		}
+	}
+
+	for _, set := range []bson.M{u.Set, u.SetOnInsert} {
+		for path, v := range set {
+			doc, err := enc.Encrypt(collection, nest(path, v))
+			if err != nil {
+				return err
+			}
+
+			set[path] = unnest(path, doc)
+		}
+	}
+
+	return nil
+}
+
+// nest provides the document holding the value at the path in dot notation.
+func nest(path string, v interface{}) bson.M {
+	names := strings.Split(path, ".")
+
+	for i := len(names) - 1; i > 0; i-- {
+		v = bson.M{names[i]: v}
+	}
+
+	return bson.M{names[0]: v}
+}
+
+// unnest provides the value at the path in dot notation of a document created by nest.
+func unnest(path string, doc bson.M) interface{} {
+	var v interface{} = doc
+
+	for _, name := range strings.Split(path, ".") {
+		v = v.(bson.M)[name]
+	}
+
+	return v
+}
@@ -0,0 +1,200 @@
+package docdb_poc
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitscm.cisco.com/mcmp/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	db "docdb_poc/db"
+	"docdb_poc/internal/mongo/encrypt"
+)
+
+func TestNest(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		v    interface{}
+		want bson.M
+	}{
+		{"name", "a", bson.M{"name": "a"}},
+		{"address.street", "Main", bson.M{"address": bson.M{"street": "Main"}}},
+		{"a.b.c", bson.M{"d": 1}, bson.M{"a": bson.M{"b": bson.M{"c": bson.M{"d": 1}}}}},
+	} {
+		doc := nest(tc.path, tc.v)
+		if !reflect.DeepEqual(doc, tc.want) {
+			t.Errorf("nest(%q) = %v, want %v", tc.path, doc, tc.want)
+		}
+
+		if v := unnest(tc.path, doc); !reflect.DeepEqual(v, tc.v) {
+			t.Errorf("unnest(%q) = %v, want %v", tc.path, v, tc.v)
+		}
+	}
+}
+
+func TestEncryptUpdate(t *testing.T) {
+	ring, err := encrypt.NewKeyRing("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := new(client)
+	c.enc.Store(encrypt.New(ring, encrypt.Schema{"users": {"ssn": encrypt.Random, "address.street": encrypt.Deterministic}}))
+
+	encrypted := func(v interface{}) bool {
+		b, ok := v.(primitive.Binary)
+
+		return ok && b.Subtype == encrypt.Subtype
+	}
+
+	for _, tc := range []struct {
+		name      string
+		ops       []db.UpdateOp
+		encrypted []string
+		plain     map[string]interface{}
+	}{
+		{"encrypted field", []db.UpdateOp{db.Set("ssn", "123-45-6789")}, []string{"ssn"}, nil},
+		{"on insert", []db.UpdateOp{db.SetOnInsert("ssn", "123-45-6789")}, []string{"ssn"}, nil},
+		{"embedded field", []db.UpdateOp{db.Set("address.street", "Main")}, []string{"address.street"}, nil},
+		{"parent document", []db.UpdateOp{db.Set("address", bson.M{"street": "Main", "city": "X"})}, []string{"address.street"}, map[string]interface{}{"address.city": "X"}},
+		{"other field", []db.UpdateOp{db.Set("name", "a")}, nil, map[string]interface{}{"name": "a"}},
+		{"unset", []db.UpdateOp{db.Unset("ssn")}, nil, nil},
+	} {
+		u, err := db.NewUpdate(tc.ops...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.encryptUpdate("users", u); err != nil {
+			t.Errorf("%s: encryptUpdate() failed: %v", tc.name, err)
+
+			continue
+		}
+
+		values := func(path string) interface{} {
+			if v, ok := u.Set[path]; ok {
+				return v
+			}
+
+			if v, ok := u.SetOnInsert[path]; ok {
+				return v
+			}
+
+			// the value of a path within a document set as a whole
+			for set, v := range u.Set {
+				if doc, ok := v.(bson.M); ok && strings.HasPrefix(path, set+".") {
+					return unnest(strings.TrimPrefix(path, set+"."), doc)
+				}
+			}
+
+			return nil
+		}
+
+		for _, path := range tc.encrypted {
+			if v := values(path); !encrypted(v) {
+				t.Errorf("%s: encryptUpdate() %s = %v, want encrypted", tc.name, path, v)
+			}
+		}
+
+		for path, want := range tc.plain {
+			if v := values(path); v != want {
+				t.Errorf("%s: encryptUpdate() %s = %v, want %v", tc.name, path, v, want)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		op   db.UpdateOp
+	}{
+		{"within an encrypted field", db.Set("ssn.last", "6789")},
+		{"increment", db.Increment("ssn", 1)},
+		{"push", db.Push("ssn", "a")},
+		{"push into a parent document", db.Push("address", "a")},
+	} {
+		u, err := db.NewUpdate(tc.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.encryptUpdate("users", u); err == nil {
+			t.Errorf("%s: encryptUpdate() succeeded, want error", tc.name)
+		}
+	}
+
+	u, err := db.NewUpdate(db.Increment("ssn", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := new(client).encryptUpdate("users", u); err != nil {
+		t.Errorf("encryptUpdate() without encryption = %v, want nil", err)
+	}
+}
+
+func TestUnmatched(t *testing.T) {
+	count := func(n int32) func(bson.M) bson.M {
+		return func(bson.M) bson.M {
+			batch := bson.A{}
+			if n > 0 {
+				batch = append(batch, bson.M{"_id": int32(1), "n": n})
+			}
+
+			return bson.M{"cursor": bson.M{"id": int64(0), "ns": "app.orders", "firstBatch": batch}}
+		}
+	}
+
+	conditional, err := db.NewUpdate(db.Set("status", "shipped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditional.Conditions = append(conditional.Conditions, bson.M{"status": "pending"})
+
+	unconditional, err := db.NewUpdate(db.Set("status", "shipped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		u         *db.Update
+		aggregate func(bson.M) bson.M
+		ok        bool
+		unmet     bool
+		counted   bool
+	}{
+		{"no conditions", unconditional, count(1), true, false, false},
+		{"document not matching the conditions", conditional, count(1), false, true, true},
+		{"no document", conditional, count(0), true, false, true},
+		{"count failed", conditional, nil, false, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newFakeServer(t)
+			if tc.aggregate != nil {
+				s.handle("aggregate", tc.aggregate)
+			}
+
+			coll := newTestClient(t, s, false).conn.Load().dbc.Collection("orders")
+
+			err := unmatched(context.Background(), coll, "orders", tc.u, bson.M{"_id": 1})
+			if (err == nil) != tc.ok || errors.IsType(errors.ErrPreconditionNotMet, err) != tc.unmet {
+				t.Errorf("unmatched() = %v, want nil %t and precondition not met %t", err, tc.ok, tc.unmet)
+			}
+
+			counted := false
+
+			for _, name := range s.received() {
+				counted = counted || name == "aggregate"
+			}
+
+			if counted != tc.counted {
+				t.Errorf("unmatched() counted the documents %t, want %t", counted, tc.counted)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package docdb_poc
+
+import (
+	"context"
+
+	wraperrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitscm.cisco.com/mcmp/utils/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	db "docdb_poc/db"
+)
+
+func (c *client) KNN(ctx context.Context, collection string, vq *db.VectorQuery, opts ...db.Option) ([]db.Neighbor, error) {
+	field, err := vq.Field(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	q := vq.Query
+	if q == nil {
+		q = search.NewQuery()
+	}
+
+	filter, grant, err := c.prepareRead(ctx, collection, db.Filters(collection, q))
+	if err != nil {
+		return nil, err
+	}
+
+	// the ranking of the documents would disclose the vectors of callers not granted the field
+	if err := grant.CheckFields(field.Path); err != nil {
+		return nil, err
+	}
+
+	dbc, done, err := c.acquireRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	coll, err := configuredCollection(dbc, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	knn := db.NewKNN(field, vq.Vector, vq.K)
+
+	// the vector index finds the nearest documents before any filter applies, so it is only used when the
+	// documents are not filtered
+	indexed := false
+	if len(filter) == 0 {
+		if indexed, err = vectorSearch(ctx, coll, field, vq, knn); err != nil {
+			return nil, err
+		}
+	}
+
+	if !indexed {
+		if err := scan(ctx, coll, filter, knn); err != nil {
+			return nil, err
+		}
+	}
+
+	found := knn.Neighbors()
+
+	for i := range found {
+		doc, err := c.readResult(collection, grant, found[i].Document)
+		if err != nil {
+			return nil, err
+		}
+
+		found[i].Document = db.SelectFields(doc, q.Fields())
+	}
+
+	return found, nil
+}
+
+// vectorSearch ranks the documents found by the vector index of the field; false when the server does not
+// support vector search.
+func vectorSearch(ctx context.Context, coll *mongo.Collection, field db.VectorField, vq *db.VectorQuery, knn *db.KNN) (bool, error) {
+	cur, err := coll.Aggregate(ctx, mongo.Pipeline{field.SearchStage(vq.Vector, vq.K)})
+
+	switch commandCode(err) {
+	case 0:
+		if err != nil {
+			return false, asDomainError(err, coll.Name(), "unable to search vectors")
+		}
+	case codeUnrecognizedStage, codeCommandNotSupported, codeFeatureNotSupported:
+		logrus.Debugf("Server does not support vector search; scanning %s: %v", coll.Name(), err)
+
+		return false, nil
+	default:
+		return false, asDomainError(err, coll.Name(), "unable to search vectors")
+	}
+
+	defer cur.Close(ctx)
+
+	// the documents are ranked again so that their scores are those of a scan
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return false, wraperrors.Wrap(err, "unable to read document")
+		}
+
+		knn.Add(doc)
+	}
+
+	if err := cur.Err(); err != nil {
+		return false, wraperrors.Wrap(err, "unable to read documents")
+	}
+
+	return true, nil
+}
+
+// scan ranks every document matching the filter.
+func scan(ctx context.Context, coll *mongo.Collection, filter bson.M, knn *db.KNN) error {
+	cur, err := coll.Find(ctx, filter)
+	if err != nil {
+		return asDomainError(err, coll.Name(), "unable to find documents")
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return wraperrors.Wrap(err, "unable to read document")
+		}
+
+		knn.Add(doc)
+	}
+
+	if err := cur.Err(); err != nil {
+		return wraperrors.Wrap(err, "unable to read documents")
+	}
+
+	return nil
+}